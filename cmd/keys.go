@@ -0,0 +1,51 @@
+package main
+
+import (
+	"DiaSync/utils"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runKeys handles the signing key admin commands:
+//
+//	diasync keys generate -dir <keys_dir> -alg RS256|EdDSA
+//	diasync keys promote -dir <keys_dir> -kid <kid>
+func runKeys(args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: diasync keys generate|promote [flags]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	dir := flags.String("dir", "", "signing keys directory")
+	alg := flags.String("alg", utils.AlgorithmEdDSA, "key algorithm for generate: RS256 or EdDSA")
+	kid := flags.String("kid", "", "key id for promote")
+
+	flags.Parse(args[1:])
+
+	if *dir == "" {
+		fmt.Println("-dir is required")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "generate":
+		newKid, err := utils.GenerateKey(*dir, *alg)
+
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(newKid)
+	case "promote":
+		err := utils.PromoteKey(*dir, *kid)
+
+		if err != nil {
+			panic(err)
+		}
+	default:
+		fmt.Println("unknown command " + args[0])
+		os.Exit(2)
+	}
+}
@@ -4,18 +4,31 @@ import (
 	"DiaSync/config"
 	"DiaSync/server"
 	"DiaSync/utils"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		runKeys(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	cfg := config.Init()
 
 	utils.Init(cfg)
 
 	storage := server.InitStorage(cfg.Db)
-	router := server.InitRouter(storage)
+	router := server.InitRouter(cfg, storage)
 	httpServer := server.InitHttpServer(cfg, router)
+	outbox := server.InitOutbox(cfg, storage)
 
 	go storage.Clear()
+	go outbox.Run()
 
 	if err := httpServer.ListenAndServe(); err != nil {
 		panic(err)
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"DiaSync/config"
+	"DiaSync/schema"
+	"DiaSync/server"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMigrate handles the schema migration commands:
+//
+//	diasync migrate up|down|status -p <config>
+//	diasync migrate goto|force -p <config> -version <n>
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: diasync migrate up|down|goto|force|status [flags]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	path := flags.String("p", "", "path to config file")
+	version := flags.Int64("version", -1, "target version for goto and force, 0 reverts everything")
+
+	flags.Parse(args[1:])
+
+	if (args[0] == "goto" || args[0] == "force") && *version < 0 {
+		fmt.Println("-version is required")
+		os.Exit(2)
+	}
+
+	cfg := config.Load(*path)
+	db := server.OpenDB(cfg.Db)
+	defer db.Close()
+
+	migrator, err := server.NewMigrator(db, schema.Migrations)
+
+	if err != nil {
+		panic(err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down()
+	case "goto":
+		err = migrator.Goto(*version)
+	case "force":
+		err = migrator.Force(*version)
+	case "status":
+		err = printMigrationStatus(migrator)
+	default:
+		fmt.Println("unknown command " + args[0])
+		os.Exit(2)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func printMigrationStatus(migrator *server.Migrator) error {
+	statuses, err := migrator.Status()
+
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		state := "pending"
+
+		if status.AppliedAt != nil {
+			state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		if !status.Known {
+			state += ", unknown to this server"
+		}
+
+		fmt.Printf("%06d_%s\t%s\n", status.Version, status.Name, state)
+	}
+
+	return nil
+}
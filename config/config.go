@@ -11,8 +11,11 @@ type Config struct {
 	Utils      `json:"utils"`
 	Db         `json:"db"`
 	HttpServer `json:"httpServer"`
+	RateLimit  `json:"rate_limit"`
 }
 
+// Db.AutoMigrate applies pending migrations on startup instead of refusing
+// to start until `diasync migrate up` is run.
 type Db struct {
 	Host        string        `json:"host"`
 	Port        int           `json:"port"`
@@ -20,32 +23,223 @@ type Db struct {
 	Password    string        `json:"password"`
 	Dbname      string        `json:"dbname"`
 	ClearPeriod time.Duration `json:"clear_period"`
+	AutoMigrate bool          `json:"auto_migrate"`
 }
 
+// HttpServer.PublicURL is the base of the emailed links, like
+// "https://id.diasync.ru". It defaults to http:// and ServerAdr, which only
+// works without a proxy in front of the server.
+// HttpServer.TrustedProxies lists the addresses or CIDRs of the proxies whose
+// X-Forwarded-For is believed. Without them the client IP is the peer address.
 type HttpServer struct {
-	ServerAdr   string        `json:"server_adr"`
-	Timeout     time.Duration `json:"timeout"`
-	IdleTimeout time.Duration `json:"idle_timeout"`
+	ServerAdr      string        `json:"server_adr"`
+	Timeout        time.Duration `json:"timeout"`
+	IdleTimeout    time.Duration `json:"idle_timeout"`
+	PublicURL      string        `json:"public_url"`
+	AppLinks       AppLinks      `json:"app_links"`
+	TrustedProxies []string      `json:"trusted_proxies"`
+}
+
+// AppLinks lets the DiaSync app finish the emailed flows. URL is the base of
+// its deep links, like "diasync://app": the landing pages offer it with the
+// path and token of the link, and magic links redirect to it. AppleAppIDs
+// (TEAMID.bundle.id) and AndroidPackage with AndroidCertFingerprints are
+// published in /.well-known, so phones open the emailed links in the app
+// right away.
+type AppLinks struct {
+	URL                     string   `json:"url"`
+	AppleAppIDs             []string `json:"apple_app_ids"`
+	AndroidPackage          string   `json:"android_package"`
+	AndroidCertFingerprints []string `json:"android_cert_fingerprints"`
+}
+
+// RateLimit.Store is "memory" (the default) or "postgres", which shares the
+// counters between instances. Routes maps a path like "/auth/login" to its
+// limits and overrides the built-in ones.
+type RateLimit struct {
+	Store  string                `json:"store"`
+	Routes map[string]RouteLimit `json:"routes"`
+}
+
+// RouteLimit limits the requests per client IP, email and device id
+// separately.
+type RouteLimit struct {
+	IP     Limit `json:"ip"`
+	Email  Limit `json:"email"`
+	Device Limit `json:"device"`
+}
+
+// Limit allows bursts of Requests requests, refilled evenly over Period
+// seconds. A zero limit isn't enforced.
+type Limit struct {
+	Requests int           `json:"requests"`
+	Period   time.Duration `json:"period"`
 }
 
 type Utils struct {
-	Email `json:"email"`
-	Token `json:"token"`
+	Email          `json:"email"`
+	Token          `json:"token"`
+	PasswordHash   `json:"password_hash"`
+	MFA            `json:"mfa"`
+	WebAuthn       `json:"webauthn"`
+	MagicLink      `json:"magic_link"`
+	OIDC           `json:"oidc"`
+	Lockout        `json:"lockout"`
+	PasswordPolicy `json:"password_policy"`
+	Enumeration    `json:"enumeration"`
+	Outbox         `json:"outbox"`
 }
 
+// Email.Transport is "smtp" (the default), "file" writing every email to Dir
+// or "stdout". DefaultLocale is "ru" (the default) or "en", used for users
+// without a supported locale.
+//
+// TLS is "starttls" (the default), "implicit" for port 465 or "none". The
+// server certificate is checked against TLSCAFile or the system roots unless
+// TLSSkipVerify is set. Up to PoolSize connections are kept open for
+// IdleTimeout seconds. ListUnsubscribe is a mailto: or https: URI added to
+// notifications.
 type Email struct {
-	AppPassword string `json:"app_password"`
-	Sender      string `json:"sender"`
-	SmtpServer  string `json:"smtp_server"`
-	SmtpAdr     string `json:"smtp_adr"`
+	AppPassword     string        `json:"app_password"`
+	Sender          string        `json:"sender"`
+	SmtpServer      string        `json:"smtp_server"`
+	SmtpAdr         string        `json:"smtp_adr"`
+	Transport       string        `json:"transport"`
+	Dir             string        `json:"dir"`
+	DefaultLocale   string        `json:"default_locale"`
+	TLS             string        `json:"tls"`
+	TLSSkipVerify   bool          `json:"tls_skip_verify"`
+	TLSCAFile       string        `json:"tls_ca_file"`
+	Timeout         time.Duration `json:"timeout"`
+	PoolSize        int           `json:"pool_size"`
+	IdleTimeout     time.Duration `json:"idle_timeout"`
+	ListUnsubscribe string        `json:"list_unsubscribe"`
+	DKIM            DKIM          `json:"dkim"`
+}
+
+// DKIM signs every email for Domain with the RSA key in KeyFile (PEM), whose
+// public key is published at <Selector>._domainkey.<Domain>.
+type DKIM struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	KeyFile  string `json:"key_file"`
 }
 
 type Token struct {
-	AccessExpire      time.Duration `json:"access_expire"`
-	RefreshExpire     time.Duration `json:"refresh_expire"`
-	VerifyEmailExpire time.Duration `json:"verify_email_expire"`
-	PasswordExpire    time.Duration `json:"password_expire"`
-	SecretKey         string        `json:"secret_key"`
+	AccessExpire        time.Duration `json:"access_expire"`
+	RefreshExpire       time.Duration `json:"refresh_expire"`
+	VerifyEmailExpire   time.Duration `json:"verify_email_expire"`
+	PasswordExpire      time.Duration `json:"password_expire"`
+	InviteExpire        time.Duration `json:"invite_expire"`
+	EmailChangeExpire   time.Duration `json:"email_change_expire"`
+	EmailUndoExpire     time.Duration `json:"email_undo_expire"`
+	SecureAccountExpire time.Duration `json:"secure_account_expire"`
+	SecretKey           string        `json:"secret_key"`
+	KeysDir             string        `json:"keys_dir"`
+	Issuer              string        `json:"issuer"`
+	Audience            string        `json:"audience"`
+}
+
+type PasswordHash struct {
+	Algorithm   string `json:"algorithm"`
+	Memory      uint32 `json:"memory"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism"`
+	SaltLength  uint32 `json:"salt_length"`
+	KeyLength   uint32 `json:"key_length"`
+	BcryptCost  int    `json:"bcrypt_cost"`
+}
+
+// MFA.RequiredRoles lists the roles that can't sign in without a second
+// factor, e.g. ["clinician", "admin"].
+// MFA.SecretKeyFile holds the base64 AES-256 key encrypting the TOTP secrets,
+// it is required.
+type MFA struct {
+	RequiredRoles   []string      `json:"required_roles"`
+	ChallengeExpire time.Duration `json:"challenge_expire"`
+	SecretKeyFile   string        `json:"secret_key_file"`
+	MaxAttempts     int           `json:"max_attempts"`
+}
+
+// WebAuthn enables passkeys when RPID is set. RPOrigins lists every origin
+// allowed in the client data, including the android:apk-key-hash origin of
+// the app.
+type WebAuthn struct {
+	RPID            string        `json:"rp_id"`
+	RPDisplayName   string        `json:"rp_display_name"`
+	RPOrigins       []string      `json:"rp_origins"`
+	ChallengeExpire time.Duration `json:"challenge_expire"`
+}
+
+// MagicLink enables passwordless login with an emailed link and code. Every
+// code allows MaxAttempts wrong guesses before the link is void.
+type MagicLink struct {
+	Enabled     bool          `json:"enabled"`
+	Expire      time.Duration `json:"expire"`
+	MaxAttempts int           `json:"max_attempts"`
+}
+
+// OIDC lists the identity providers whose ID tokens are accepted, keyed by
+// the provider name used in the API, e.g. "google" or "apple". An issued
+// nonce has to be used within NonceExpire seconds.
+type OIDC struct {
+	Providers    map[string]OIDCProvider `json:"providers"`
+	JWKSCacheTTL time.Duration           `json:"jwks_cache_ttl"`
+	NonceExpire  time.Duration           `json:"nonce_expire"`
+}
+
+// OIDCProvider.ClientIDs are the audiences of the app's ID tokens, one per
+// platform. JWKSFile is read instead of JWKSURL if set, e.g. in tests.
+type OIDCProvider struct {
+	Issuers   []string `json:"issuers"`
+	ClientIDs []string `json:"client_ids"`
+	JWKSURL   string   `json:"jwks_url"`
+	JWKSFile  string   `json:"jwks_file"`
+}
+
+// Lockout blocks password logins of a user for BaseDelay seconds after
+// Threshold failed attempts in a row. Every further failure doubles the delay
+// up to MaxDelay.
+type Lockout struct {
+	Threshold int           `json:"threshold"`
+	BaseDelay time.Duration `json:"base_delay"`
+	MaxDelay  time.Duration `json:"max_delay"`
+}
+
+// Outbox delivers the queued emails every Interval seconds, BatchSize at a
+// time. A failed email is retried after BaseDelay seconds, doubling up to
+// MaxDelay, and dead-lettered after MaxAttempts attempts. Sent and
+// dead-lettered emails are dropped after Retention seconds.
+type Outbox struct {
+	Interval    time.Duration `json:"interval"`
+	BatchSize   int           `json:"batch_size"`
+	MaxAttempts int           `json:"max_attempts"`
+	BaseDelay   time.Duration `json:"base_delay"`
+	MaxDelay    time.Duration `json:"max_delay"`
+	Retention   time.Duration `json:"retention"`
+}
+
+// PasswordPolicy is checked whenever a password is set. BreachedDir holds the
+// breached password hashes split by prefix like the Pwned Passwords range
+// API, one <PREFIX>.txt file of "SUFFIX:COUNT" lines per 5 hex digit prefix.
+type PasswordPolicy struct {
+	MinLength     int    `json:"min_length"`
+	MaxLength     int    `json:"max_length"`
+	RequireLower  bool   `json:"require_lower"`
+	RequireUpper  bool   `json:"require_upper"`
+	RequireDigit  bool   `json:"require_digit"`
+	RequireSymbol bool   `json:"require_symbol"`
+	AllowEmail    bool   `json:"allow_email"`
+	BreachedDir   string `json:"breached_dir"`
+}
+
+// Enumeration.RevealAccounts lets responses tell that an account exists, e.g.
+// 409 on signup with a registered email. Endpoints that email only existing
+// accounts take at least MinResponseTime milliseconds, which should cover
+// sending an email.
+type Enumeration struct {
+	RevealAccounts  bool          `json:"reveal_accounts"`
+	MinResponseTime time.Duration `json:"min_response_time"`
 }
 
 func Init() Config {
@@ -53,7 +247,12 @@ func Init() Config {
 
 	flag.Parse()
 
-	file, err := os.ReadFile(*path)
+	return Load(*path)
+}
+
+// Load reads the config file, for commands parsing their own flags.
+func Load(path string) Config {
+	file, err := os.ReadFile(path)
 
 	if err != nil {
 		panic("Can't read config")
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *AuthController) ChangePassword(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.ChangePasswordR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.ChangePassword(principal, request)
+
+	if passwordPolicyError(context, err) {
+		return
+	}
+
+	if err != nil {
+		accountError(context, err, "couldn't change password")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) ChangeEmail(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.ChangeEmailR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.ChangeEmail(principal, request)
+
+	if err != nil {
+		accountError(context, err, "couldn't change email")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) ConfirmEmailChange(context *gin.Context) {
+	if isLinkPageForm(context) {
+		ac.submitLinkPage(context)
+		return
+	}
+
+	err := ac.authService.ConfirmEmailChange(context.Query("token"))
+
+	if err != nil {
+		accountError(context, err, "couldn't change email")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) UndoEmailChange(context *gin.Context) {
+	if isLinkPageForm(context) {
+		ac.submitLinkPage(context)
+		return
+	}
+
+	err := ac.authService.UndoEmailChange(context.Query("token"))
+
+	if err != nil {
+		accountError(context, err, "couldn't restore email")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+// SecureAccount signs the user out everywhere with the link of a security
+// alert.
+func (ac *AuthController) SecureAccount(context *gin.Context) {
+	if isLinkPageForm(context) {
+		ac.submitLinkPage(context)
+		return
+	}
+
+	err := ac.authService.SecureAccount(context.Query("token"))
+
+	if err != nil {
+		accountError(context, err, "couldn't secure account")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+// accountError answers a wrong current password with 403 rather than 401,
+// the access token itself is fine.
+func accountError(context *gin.Context, err error, message string) {
+	var lockedOut *service.LockedOutError
+
+	switch {
+	case errors.As(err, &lockedOut):
+		middleware.TooManyRequests(context, lockedOut.RetryAfter, err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrAccountLocked):
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	case errors.Is(err, utils.ErrInvalidToken):
+		context.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		context.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
@@ -0,0 +1,338 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_ChangePassword(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.ChangePasswordR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"current_password":"ddd", "new_password":"correct horse battery"}`,
+			inputRequest: models.ChangePasswordR{CurrentPassword: "ddd", NewPassword: "correct horse battery"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR) {
+				s.EXPECT().ChangePassword(principal, request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"new_password":"correct horse battery"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "Wrong current password",
+			inputBody:    `{"current_password":"ddd", "new_password":"correct horse battery"}`,
+			inputRequest: models.ChangePasswordR{CurrentPassword: "ddd", NewPassword: "correct horse battery"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR) {
+				s.EXPECT().ChangePassword(principal, request).Return(service.ErrInvalidCredentials)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"invalid credentials"}`,
+		},
+		{
+			name:         "Too many attempts",
+			inputBody:    `{"current_password":"ddd", "new_password":"correct horse battery"}`,
+			inputRequest: models.ChangePasswordR{CurrentPassword: "ddd", NewPassword: "correct horse battery"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR) {
+				s.EXPECT().ChangePassword(principal, request).Return(&service.LockedOutError{RetryAfter: time.Minute})
+			},
+			expectedStatusCode:  429,
+			expectedRequestBody: `{"message":"too many failed attempts"}`,
+		},
+		{
+			name:         "Weak password",
+			inputBody:    `{"current_password":"ddd", "new_password":"eee"}`,
+			inputRequest: models.ChangePasswordR{CurrentPassword: "ddd", NewPassword: "eee"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangePasswordR) {
+				s.EXPECT().ChangePassword(principal, request).Return(&utils.PasswordPolicyError{
+					Violations: []utils.PasswordViolation{{Code: utils.ViolationTooShort, Message: "too short"}}})
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"weak password","violations":[{"code":"too_short","message":"too short"}]}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/password", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.ChangePassword)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/password", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_ChangeEmail(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangeEmailR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.ChangeEmailR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"new_email":"Dmitry", "password":"ddd"}`,
+			inputRequest: models.ChangeEmailR{NewEmail: "Dmitry", Password: "ddd"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangeEmailR) {
+				s.EXPECT().ChangeEmail(principal, request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"password":"ddd"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangeEmailR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "Email taken",
+			inputBody:    `{"new_email":"Dmitry", "password":"ddd"}`,
+			inputRequest: models.ChangeEmailR{NewEmail: "Dmitry", Password: "ddd"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangeEmailR) {
+				s.EXPECT().ChangeEmail(principal, request).Return(service.ErrEmailTaken)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"email already registered"}`,
+		},
+		{
+			name:         "Server error",
+			inputBody:    `{"new_email":"Dmitry", "password":"ddd"}`,
+			inputRequest: models.ChangeEmailR{NewEmail: "Dmitry", Password: "ddd"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.ChangeEmailR) {
+				s.EXPECT().ChangeEmail(principal, request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't change email"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/email", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.ChangeEmail)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/email", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_ConfirmEmailChange(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, token string)
+
+	var testCases = []struct {
+		name                string
+		token               string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:  "OK",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().ConfirmEmailChange(token).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:  "Invalid token",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().ConfirmEmailChange(token).Return(utils.ErrInvalidToken)
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"invalid token"}`,
+		},
+		{
+			name:  "Email taken",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().ConfirmEmailChange(token).Return(service.ErrEmailTaken)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"email already registered"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.token)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/auth/confirm-email-change", authController.ConfirmEmailChange)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/confirm-email-change?token="+tt.token, nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_SecureAccount(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, token string)
+
+	var testCases = []struct {
+		name                string
+		token               string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:  "OK",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().SecureAccount(token).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:  "Invalid token",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().SecureAccount(token).Return(utils.ErrInvalidToken)
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"invalid token"}`,
+		},
+		{
+			name:  "Server error",
+			token: "TTT",
+			mockBehavior: func(s *mock_service.MockAuthorization, token string) {
+				s.EXPECT().SecureAccount(token).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't secure account"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.token)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/auth/secure-account", authController.SecureAccount)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/secure-account?token="+tt.token, nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
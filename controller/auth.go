@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"DiaSync/middleware"
 	"DiaSync/models"
 	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,12 +14,45 @@ import (
 type Authorization interface {
 	Signup(*gin.Context)
 	Login(*gin.Context)
+	LoginMFA(*gin.Context)
+	EnrollTOTPChallenge(*gin.Context)
 	Logout(*gin.Context)
 	ReplacementTokens(*gin.Context)
 	VerifyEmail(*gin.Context)
 	ResetPassword(*gin.Context)
 	VerifyNewPassword(*gin.Context)
 	RepeatEmailVerify(*gin.Context)
+	Me(*gin.Context)
+	ChangeRole(*gin.Context)
+	CreateInvitation(*gin.Context)
+	ListSessions(*gin.Context)
+	RevokeSession(*gin.Context)
+	RevokeOtherSessions(*gin.Context)
+	LockUser(*gin.Context)
+	UnlockUser(*gin.Context)
+	EnrollTOTP(*gin.Context)
+	ConfirmTOTP(*gin.Context)
+	DisableMFA(*gin.Context)
+	RegenerateRecoveryCodes(*gin.Context)
+	BeginPasskeyRegistration(*gin.Context)
+	FinishPasskeyRegistration(*gin.Context)
+	BeginPasskeyLogin(*gin.Context)
+	FinishPasskeyLogin(*gin.Context)
+	SendMagicLink(*gin.Context)
+	LoginMagicLink(*gin.Context)
+	BeginOIDCLogin(*gin.Context)
+	LoginOIDC(*gin.Context)
+	ListIdentities(*gin.Context)
+	LinkIdentity(*gin.Context)
+	UnlinkIdentity(*gin.Context)
+	ChangePassword(*gin.Context)
+	ChangeEmail(*gin.Context)
+	ConfirmEmailChange(*gin.Context)
+	UndoEmailChange(*gin.Context)
+	SecureAccount(*gin.Context)
+	LinkPage(*gin.Context)
+	ListFailedEmails(*gin.Context)
+	RetryEmail(*gin.Context)
 }
 
 func NewAuthController(authService service.Authorization) Authorization {
@@ -36,8 +72,26 @@ func (ac *AuthController) Signup(context *gin.Context) {
 		return
 	}
 
+	if user.Locale == "" {
+		user.Locale = context.GetHeader("Accept-Language")
+	}
+
 	err = ac.authService.CreateUser(user)
 
+	if passwordPolicyError(context, err) {
+		return
+	}
+
+	if errors.Is(err, service.ErrRoleNotAllowed) || errors.Is(err, service.ErrInvalidInvitation) {
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrEmailTaken) {
+		context.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't create the user"})
 		return
@@ -56,15 +110,34 @@ func (ac *AuthController) Login(context *gin.Context) {
 		return
 	}
 
-	access_token, refresh_token, err := ac.authService.GenerateTokens(userInfo)
+	userInfo.IP = context.ClientIP()
+	userInfo.UserAgent = context.Request.UserAgent()
+
+	result, err := ac.authService.GenerateTokens(userInfo)
+
+	var lockedOut *service.LockedOutError
+
+	if errors.As(err, &lockedOut) {
+		middleware.TooManyRequests(context, lockedOut.RetryAfter, err.Error())
+		return
+	}
+
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrAccountLocked) {
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
 
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't generate tokens"})
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"access_token": access_token,
-		"refresh_token": refresh_token})
+	context.JSON(http.StatusOK, result)
 }
 
 func (ac *AuthController) Logout(context *gin.Context) {
@@ -97,8 +170,17 @@ func (ac *AuthController) ReplacementTokens(context *gin.Context) {
 		return
 	}
 
+	request.IP = context.ClientIP()
+	request.UserAgent = context.Request.UserAgent()
+
 	access_token, refresh_token, err := ac.authService.ReplacementTokens(request)
 
+	if errors.Is(err, service.ErrTokenReuse) || errors.Is(err, service.ErrSessionExpired) ||
+		errors.Is(err, service.ErrInvalidRefreshToken) {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't replacement tokens"})
 		return
@@ -108,6 +190,11 @@ func (ac *AuthController) ReplacementTokens(context *gin.Context) {
 }
 
 func (ac *AuthController) VerifyEmail(context *gin.Context) {
+	if isLinkPageForm(context) {
+		ac.submitLinkPage(context)
+		return
+	}
+
 	verifyToken := context.Query("token")
 
 	err := ac.authService.VerifyEmail(verifyToken)
@@ -141,9 +228,25 @@ func (ac *AuthController) ResetPassword(context *gin.Context) {
 }
 
 func (ac *AuthController) VerifyNewPassword(context *gin.Context) {
-	token := context.Query("token")
+	if isLinkPageForm(context) {
+		ac.submitLinkPage(context)
+		return
+	}
+
+	var request models.NewPasswordR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
 
-	err := ac.authService.VerifyNewPassword(token)
+	err = ac.authService.VerifyNewPassword(request)
+
+	if passwordPolicyError(context, err) {
+		return
+	}
 
 	if err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
@@ -172,3 +275,192 @@ func (ac *AuthController) RepeatEmailVerify(context *gin.Context) {
 
 	context.Status(http.StatusOK)
 }
+
+func (ac *AuthController) Me(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	context.JSON(http.StatusOK, principal)
+}
+
+func (ac *AuthController) ChangeRole(context *gin.Context) {
+	var request models.ChangeRoleR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.ChangeRole(request)
+
+	if errors.Is(err, service.ErrInvalidRole) {
+		context.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't change role"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) CreateInvitation(context *gin.Context) {
+	var request models.InvitationR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.CreateInvitation(request)
+
+	if errors.Is(err, service.ErrInvalidRole) {
+		context.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't create invitation"})
+		return
+	}
+
+	context.Status(http.StatusCreated)
+}
+
+func (ac *AuthController) ListSessions(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	sessions, err := ac.authService.ListSessions(principal)
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't list sessions"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (ac *AuthController) RevokeSession(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	err := ac.authService.RevokeSession(principal, context.Param("id"))
+
+	if errors.Is(err, service.ErrSessionNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't revoke session"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) RevokeOtherSessions(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	err := ac.authService.RevokeOtherSessions(principal)
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't revoke sessions"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) LockUser(context *gin.Context) {
+	var request models.LockUserR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.LockUser(request)
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't lock user"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) UnlockUser(context *gin.Context) {
+	var request models.LockUserR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.UnlockUser(request)
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't unlock user"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+// passwordPolicyError answers with every broken rule if the password was
+// rejected by the policy.
+func passwordPolicyError(context *gin.Context, err error) bool {
+	var policyErr *utils.PasswordPolicyError
+
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	context.JSON(http.StatusBadRequest, gin.H{"message": "weak password", "violations": policyErr.Violations})
+
+	return true
+}
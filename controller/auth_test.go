@@ -1,13 +1,16 @@
 package controller
 
 import (
+	"DiaSync/middleware"
 	"DiaSync/models"
 	"DiaSync/service"
 	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
 	"bytes"
 	"errors"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
@@ -38,6 +41,21 @@ func TestAuthController_Signup(t *testing.T) {
 			expectedStatusCode:  201,
 			expectedRequestBody: ``,
 		},
+		{
+			name:      "OK with locale",
+			inputBody: `{"email":"Dima", "password":"ddd", "role":"viewer", "locale":"en"}`,
+			inputUser: models.User{
+				Email:    "Dima",
+				Password: "ddd",
+				Role:     "viewer",
+				Locale:   "en",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.User) {
+				s.EXPECT().CreateUser(user).Return(nil)
+			},
+			expectedStatusCode:  201,
+			expectedRequestBody: ``,
+		},
 		{
 			name:      "Incorrect Request",
 			inputBody: `{"email":"Dima", "role":"viewer"}`,
@@ -61,6 +79,51 @@ func TestAuthController_Signup(t *testing.T) {
 			expectedStatusCode:  500,
 			expectedRequestBody: `{"message":"couldn't create the user"}`,
 		},
+		{
+			name:      "Role not allowed",
+			inputBody: `{"email":"Dima", "password":"ddd", "role":"admin"}`,
+			inputUser: models.User{
+				Email:    "Dima",
+				Password: "ddd",
+				Role:     "admin",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.User) {
+				s.EXPECT().CreateUser(user).Return(service.ErrRoleNotAllowed)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"role not allowed"}`,
+		},
+		{
+			name:      "Email taken",
+			inputBody: `{"email":"Dima", "password":"ddd", "role":"viewer"}`,
+			inputUser: models.User{
+				Email:    "Dima",
+				Password: "ddd",
+				Role:     "viewer",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.User) {
+				s.EXPECT().CreateUser(user).Return(service.ErrEmailTaken)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"email already registered"}`,
+		},
+		{
+			name:      "Weak password",
+			inputBody: `{"email":"Dima", "password":"ddd", "role":"viewer"}`,
+			inputUser: models.User{
+				Email:    "Dima",
+				Password: "ddd",
+				Role:     "viewer",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.User) {
+				s.EXPECT().CreateUser(user).Return(&utils.PasswordPolicyError{Violations: []utils.PasswordViolation{
+					{Code: utils.ViolationTooShort, Message: "password must be at least 8 characters long"},
+				}})
+			},
+			expectedStatusCode: 400,
+			expectedRequestBody: `{"message":"weak password","violations":[{"code":"too_short",` +
+				`"message":"password must be at least 8 characters long"}]}`,
+		},
 	}
 
 	for _, tt := range testCases {
@@ -111,13 +174,29 @@ func TestAuthController_Login(t *testing.T) {
 				Email:    "Dima",
 				Password: "ddd",
 				DeviceID: "DDD",
+				IP:       "192.0.2.1",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
-				s.EXPECT().GenerateTokens(user).Return("asdasdads", "sadasfasfda", nil)
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda"}, nil)
 			},
 			expectedStatusCode:  200,
 			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda"}`,
 		},
+		{
+			name:      "MFA challenge",
+			inputBody: `{"email":"Dima", "password":"ddd", "device_id":"DDD"}`,
+			inputUser: models.LoginR{
+				Email:    "Dima",
+				Password: "ddd",
+				DeviceID: "DDD",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{MFAToken: "MMM", MFAEnrollment: true}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"mfa_token":"MMM","mfa_enrollment_required":true}`,
+		},
 		{
 			name:      "Incorrect request",
 			inputBody: `{"email":"Dima", "password":"ddd"}`,
@@ -138,13 +217,59 @@ func TestAuthController_Login(t *testing.T) {
 				Email:    "Dima",
 				Password: "ddd",
 				DeviceID: "DDD",
+				IP:       "192.0.2.1",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
-				s.EXPECT().GenerateTokens(user).Return("", "", errors.New("Server error"))
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{}, errors.New("Server error"))
 			},
 			expectedStatusCode:  500,
 			expectedRequestBody: `{"message":"couldn't generate tokens"}`,
 		},
+		{
+			name:      "Account locked",
+			inputBody: `{"email":"Dima", "password":"ddd", "device_id":"DDD"}`,
+			inputUser: models.LoginR{
+				Email:    "Dima",
+				Password: "ddd",
+				DeviceID: "DDD",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{}, service.ErrAccountLocked)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"account locked"}`,
+		},
+		{
+			name:      "Invalid credentials",
+			inputBody: `{"email":"Dima", "password":"ddd", "device_id":"DDD"}`,
+			inputUser: models.LoginR{
+				Email:    "Dima",
+				Password: "ddd",
+				DeviceID: "DDD",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{}, service.ErrInvalidCredentials)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid credentials"}`,
+		},
+		{
+			name:      "Too many attempts",
+			inputBody: `{"email":"Dima", "password":"ddd", "device_id":"DDD"}`,
+			inputUser: models.LoginR{
+				Email:    "Dima",
+				Password: "ddd",
+				DeviceID: "DDD",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, user models.LoginR) {
+				s.EXPECT().GenerateTokens(user).Return(models.LoginResult{}, &service.LockedOutError{RetryAfter: 90 * time.Second})
+			},
+			expectedStatusCode:  429,
+			expectedRequestBody: `{"message":"too many failed attempts"}`,
+		},
 	}
 
 	for _, tt := range testCases {
@@ -269,6 +394,7 @@ func TestAuthController_ReplacementToken(t *testing.T) {
 			inputUser: models.ReplacementTokensR{
 				RefreshToken: "asdasdasfmkm",
 				DeviceID:     "DDD",
+				IP:           "192.0.2.1",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, request models.ReplacementTokensR) {
 				s.EXPECT().ReplacementTokens(request).Return("sfdfadfdsaf", "ojoiewjeq", nil)
@@ -293,6 +419,7 @@ func TestAuthController_ReplacementToken(t *testing.T) {
 			inputUser: models.ReplacementTokensR{
 				RefreshToken: "asdasdasfmkm",
 				DeviceID:     "DDD",
+				IP:           "192.0.2.1",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, request models.ReplacementTokensR) {
 				s.EXPECT().ReplacementTokens(request).Return("", "", errors.New("Server error"))
@@ -300,6 +427,34 @@ func TestAuthController_ReplacementToken(t *testing.T) {
 			expectedStatusCode:  500,
 			expectedRequestBody: `{"message":"couldn't replacement tokens"}`,
 		},
+		{
+			name:      "Token reuse",
+			inputBody: `{"refresh_token":"asdasdasfmkm", "device_id":"DDD"}`,
+			inputUser: models.ReplacementTokensR{
+				RefreshToken: "asdasdasfmkm",
+				DeviceID:     "DDD",
+				IP:           "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ReplacementTokensR) {
+				s.EXPECT().ReplacementTokens(request).Return("", "", service.ErrTokenReuse)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"refresh token reuse detected"}`,
+		},
+		{
+			name:      "Invalid token",
+			inputBody: `{"refresh_token":"asdasdasfmkm", "device_id":"DDD"}`,
+			inputUser: models.ReplacementTokensR{
+				RefreshToken: "asdasdasfmkm",
+				DeviceID:     "DDD",
+				IP:           "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ReplacementTokensR) {
+				s.EXPECT().ReplacementTokens(request).Return("", "", service.ErrInvalidRefreshToken)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid refresh token"}`,
+		},
 	}
 
 	for _, tt := range testCases {
@@ -345,10 +500,9 @@ func TestAuthController_ResetPassword(t *testing.T) {
 	}{
 		{
 			name:      "OK",
-			inputBody: `{"email":"asdasdasfmkm@gmail.com", "new_password":"III"}`,
+			inputBody: `{"email":"asdasdasfmkm@gmail.com"}`,
 			inputUser: models.ResetPasswordR{
-				Email:       "asdasdasfmkm@gmail.com",
-				NewPassword: "III",
+				Email: "asdasdasfmkm@gmail.com",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, request models.ResetPasswordR) {
 				s.EXPECT().ResetPassword(request).Return(nil)
@@ -358,10 +512,8 @@ func TestAuthController_ResetPassword(t *testing.T) {
 		},
 		{
 			name:      "Bad request",
-			inputBody: `{"email":"asdaskap;oqpm@yandex.ru"}`,
-			inputUser: models.ResetPasswordR{
-				Email: "asdaskap;oqpm@yandex.ru",
-			},
+			inputBody: `{"new_password":"III"}`,
+			inputUser: models.ResetPasswordR{},
 			mockBehavior: func(s *mock_service.MockAuthorization, request models.ResetPasswordR) {
 
 			},
@@ -370,10 +522,9 @@ func TestAuthController_ResetPassword(t *testing.T) {
 		},
 		{
 			name:      "Internal server error",
-			inputBody: `{"email":"soojwqdmqwpjmlme@yandex.ru", "new_password":"III"}`,
+			inputBody: `{"email":"soojwqdmqwpjmlme@yandex.ru"}`,
 			inputUser: models.ResetPasswordR{
-				Email:       "soojwqdmqwpjmlme@yandex.ru",
-				NewPassword: "III",
+				Email: "soojwqdmqwpjmlme@yandex.ru",
 			},
 			mockBehavior: func(s *mock_service.MockAuthorization, request models.ResetPasswordR) {
 				s.EXPECT().ResetPassword(request).Return(errors.New("kadkolokad"))
@@ -550,29 +701,47 @@ func TestAuthController_VerifyEmail(t *testing.T) {
 }
 
 func TestAuthController_VerifyNewPassword(t *testing.T) {
-	type mockBehavior func(s *mock_service.MockAuthorization, newPasswordToken string)
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.NewPasswordR)
 
 	var testCases = []struct {
 		name                string
-		newPasswordToken    string
+		inputBody           string
+		inputRequest        models.NewPasswordR
 		mockBehavior        mockBehavior
 		expectedStatusCode  int
 		expectedRequestBody string
 	}{
 		{
-			name:             "OK",
-			newPasswordToken: "JWONQW132NJ12NO213.O123NOJN1K.KONJKIN3O231NOL",
-			mockBehavior: func(s *mock_service.MockAuthorization, newPasswordToken string) {
-				s.EXPECT().VerifyNewPassword(newPasswordToken).Return(nil)
+			name:      "OK",
+			inputBody: `{"token":"9f2c1e7a4b", "new_password":"III"}`,
+			inputRequest: models.NewPasswordR{
+				Token:       "9f2c1e7a4b",
+				NewPassword: "III",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.NewPasswordR) {
+				s.EXPECT().VerifyNewPassword(request).Return(nil)
 			},
 			expectedStatusCode:  200,
 			expectedRequestBody: ``,
 		},
 		{
-			name:             "Bad request",
-			newPasswordToken: "JWONQW132NJ12NO213.O123NOJN1K.KONJKIN3O231NOL",
-			mockBehavior: func(s *mock_service.MockAuthorization, newPasswordToken string) {
-				s.EXPECT().VerifyNewPassword(newPasswordToken).Return(errors.New("invalid token"))
+			name:      "Missing password",
+			inputBody: `{"token":"9f2c1e7a4b"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.NewPasswordR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Bad request",
+			inputBody: `{"token":"9f2c1e7a4b", "new_password":"III"}`,
+			inputRequest: models.NewPasswordR{
+				Token:       "9f2c1e7a4b",
+				NewPassword: "III",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.NewPasswordR) {
+				s.EXPECT().VerifyNewPassword(request).Return(errors.New("invalid token"))
 			},
 			expectedStatusCode:  400,
 			expectedRequestBody: `{"message":"invalid token"}`,
@@ -585,7 +754,7 @@ func TestAuthController_VerifyNewPassword(t *testing.T) {
 			defer c.Finish()
 
 			auth := mock_service.NewMockAuthorization(c)
-			tt.mockBehavior(auth, tt.newPasswordToken)
+			tt.mockBehavior(auth, tt.inputRequest)
 
 			authService := service.Authorization(auth)
 			authController := NewAuthController(authService)
@@ -594,7 +763,559 @@ func TestAuthController_VerifyNewPassword(t *testing.T) {
 			r.POST("/verify-newpassword", authController.VerifyNewPassword)
 
 			w := httptest.NewRecorder()
-			req := httptest.NewRequest("POST", "/verify-newpassword?token="+tt.newPasswordToken, nil)
+			req := httptest.NewRequest("POST", "/verify-newpassword", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_Me(t *testing.T) {
+	var testCases = []struct {
+		name                string
+		principal           *models.Principal
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:                "OK",
+			principal:           &models.Principal{ID: "U1", Email: "Dima", Role: "viewer", DeviceID: "DDD", SessionID: "SSS"},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"id":"U1","email":"Dima","role":"viewer","device_id":"DDD","session_id":"SSS"}`,
+		},
+		{
+			name:                "Not authorized",
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.GET("/me", func(context *gin.Context) {
+				if tt.principal != nil {
+					context.Set(middleware.PrincipalKey, *tt.principal)
+				}
+			}, authController.Me)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_ChangeRole(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.ChangeRoleR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.ChangeRoleR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"email":"Dima", "role":"clinician"}`,
+			inputRequest: models.ChangeRoleR{
+				Email: "Dima",
+				Role:  "clinician",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ChangeRoleR) {
+				s.EXPECT().ChangeRole(request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"email":"Dima"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ChangeRoleR) {
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Invalid role",
+			inputBody: `{"email":"Dima", "role":"viewer"}`,
+			inputRequest: models.ChangeRoleR{
+				Email: "Dima",
+				Role:  "viewer",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ChangeRoleR) {
+				s.EXPECT().ChangeRole(request).Return(service.ErrInvalidRole)
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"invalid role"}`,
+		},
+		{
+			name:      "User not found",
+			inputBody: `{"email":"Dima", "role":"clinician"}`,
+			inputRequest: models.ChangeRoleR{
+				Email: "Dima",
+				Role:  "clinician",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ChangeRoleR) {
+				s.EXPECT().ChangeRole(request).Return(service.ErrUserNotFound)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"user not found"}`,
+		},
+		{
+			name:      "Server error",
+			inputBody: `{"email":"Dima", "role":"clinician"}`,
+			inputRequest: models.ChangeRoleR{
+				Email: "Dima",
+				Role:  "clinician",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.ChangeRoleR) {
+				s.EXPECT().ChangeRole(request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't change role"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.PUT("/admin/users/role", authController.ChangeRole)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", "/admin/users/role", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_CreateInvitation(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.InvitationR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.InvitationR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"email":"Dima", "role":"clinician", "locale":"ru"}`,
+			inputRequest: models.InvitationR{
+				Email:  "Dima",
+				Role:   "clinician",
+				Locale: "ru",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.InvitationR) {
+				s.EXPECT().CreateInvitation(request).Return(nil)
+			},
+			expectedStatusCode:  201,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"email":"Dima"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.InvitationR) {
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Invalid role",
+			inputBody: `{"email":"Dima", "role":"viewer"}`,
+			inputRequest: models.InvitationR{
+				Email: "Dima",
+				Role:  "viewer",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.InvitationR) {
+				s.EXPECT().CreateInvitation(request).Return(service.ErrInvalidRole)
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"invalid role"}`,
+		},
+		{
+			name:      "Server error",
+			inputBody: `{"email":"Dima", "role":"clinician"}`,
+			inputRequest: models.InvitationR{
+				Email: "Dima",
+				Role:  "clinician",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.InvitationR) {
+				s.EXPECT().CreateInvitation(request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't create invitation"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/admin/invitations", authController.CreateInvitation)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/admin/invitations", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_LockUser(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.LockUserR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.LockUserR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().LockUser(request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "User not found",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().LockUser(request).Return(service.ErrUserNotFound)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"user not found"}`,
+		},
+		{
+			name:         "Server error",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().LockUser(request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't lock user"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/admin/users/lock", authController.LockUser)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/admin/users/lock", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_UnlockUser(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.LockUserR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.LockUserR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().UnlockUser(request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "User not found",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().UnlockUser(request).Return(service.ErrUserNotFound)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"user not found"}`,
+		},
+		{
+			name:         "Server error",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.LockUserR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LockUserR) {
+				s.EXPECT().UnlockUser(request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't unlock user"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/admin/users/unlock", authController.UnlockUser)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/admin/users/unlock", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_ListSessions(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().ListSessions(principal).Return([]models.SessionInfo{{
+					ID:         "SSS",
+					DeviceID:   "DDD",
+					DeviceName: "Pixel",
+					Platform:   "android",
+					IP:         "192.0.2.1",
+					UserAgent:  "okhttp",
+					CreatedAt:  createdAt,
+					LastUsedAt: &createdAt,
+					Current:    true,
+				}}, nil)
+			},
+			expectedStatusCode: 200,
+			expectedRequestBody: `{"sessions":[{"id":"SSS","device_id":"DDD","device_name":"Pixel","platform":"android",` +
+				`"ip":"192.0.2.1","user_agent":"okhttp","created_at":"2024-01-01T00:00:00Z",` +
+				`"last_used_at":"2024-01-01T00:00:00Z","current":true}]}`,
+		},
+		{
+			name: "Server error",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().ListSessions(principal).Return(nil, errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't list sessions"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.GET("/me/sessions", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.ListSessions)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me/sessions", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_RevokeSession(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().RevokeSession(principal, "OOO").Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name: "Not found",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().RevokeSession(principal, "OOO").Return(service.ErrSessionNotFound)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"session not found"}`,
+		},
+		{
+			name: "Server error",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().RevokeSession(principal, "OOO").Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't revoke session"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.DELETE("/me/sessions/:id", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.RevokeSession)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("DELETE", "/me/sessions/OOO", nil)
 
 			r.ServeHTTP(w, req)
 
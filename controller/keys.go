@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"DiaSync/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public signing keys for services verifying access tokens.
+func JWKS(context *gin.Context) {
+	context.JSON(http.StatusOK, utils.JWKS())
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *AuthController) SendMagicLink(context *gin.Context) {
+	var request models.MagicLinkR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.SendMagicLink(request)
+
+	if err != nil {
+		magicLinkError(context, err, "couldn't send magic link")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+// LoginMagicLink accepts the token from the link or the email and the code.
+func (ac *AuthController) LoginMagicLink(context *gin.Context) {
+	var request models.MagicLinkLoginR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil || request.Token == "" && (request.Email == "" || request.Code == "") {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	request.IP = context.ClientIP()
+	request.UserAgent = context.Request.UserAgent()
+
+	result, err := ac.authService.LoginMagicLink(request)
+
+	if err != nil {
+		magicLinkError(context, err, "couldn't generate tokens")
+		return
+	}
+
+	context.JSON(http.StatusOK, result)
+}
+
+func magicLinkError(context *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrMagicLinkDisabled):
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, utils.ErrInvalidToken):
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrAccountLocked):
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrTooManyAttempts):
+		context.JSON(http.StatusTooManyRequests, gin.H{"message": err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
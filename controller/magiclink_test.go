@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_SendMagicLink(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.MagicLinkR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.MagicLinkR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"email":"Dima", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkR{Email: "Dima", DeviceID: "DDD"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkR) {
+				s.EXPECT().SendMagicLink(request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"email":"Dima"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "Disabled",
+			inputBody:    `{"email":"Dima", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkR{Email: "Dima", DeviceID: "DDD"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkR) {
+				s.EXPECT().SendMagicLink(request).Return(service.ErrMagicLinkDisabled)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"magic link login is disabled"}`,
+		},
+		{
+			name:         "Attempts used up",
+			inputBody:    `{"email":"Dima", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkR{Email: "Dima", DeviceID: "DDD"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkR) {
+				s.EXPECT().SendMagicLink(request).Return(service.ErrTooManyAttempts)
+			},
+			expectedStatusCode:  429,
+			expectedRequestBody: `{"message":"too many failed attempts"}`,
+		},
+		{
+			name:         "Server error",
+			inputBody:    `{"email":"Dima", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkR{Email: "Dima", DeviceID: "DDD"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkR) {
+				s.EXPECT().SendMagicLink(request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't send magic link"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/magic-link", authController.SendMagicLink)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/magic-link", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_LoginMagicLink(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.MagicLinkLoginR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "Link",
+			inputBody:    `{"token":"TTT", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkLoginR{Token: "TTT", DeviceID: "DDD", IP: "192.0.2.1"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+				s.EXPECT().LoginMagicLink(request).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda"}`,
+		},
+		{
+			name:         "Code",
+			inputBody:    `{"email":"Dima", "code":"123456", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkLoginR{Email: "Dima", Code: "123456", DeviceID: "DDD", IP: "192.0.2.1"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+				s.EXPECT().LoginMagicLink(request).Return(models.LoginResult{MFAToken: "MMM"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"mfa_token":"MMM"}`,
+		},
+		{
+			name:      "Code without email",
+			inputBody: `{"code":"123456", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "No device",
+			inputBody: `{"token":"TTT"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "Invalid code",
+			inputBody:    `{"email":"Dima", "code":"000000", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkLoginR{Email: "Dima", Code: "000000", DeviceID: "DDD", IP: "192.0.2.1"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+				s.EXPECT().LoginMagicLink(request).Return(models.LoginResult{}, utils.ErrInvalidToken)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid token"}`,
+		},
+		{
+			name:         "Account locked",
+			inputBody:    `{"token":"TTT", "device_id":"DDD"}`,
+			inputRequest: models.MagicLinkLoginR{Token: "TTT", DeviceID: "DDD", IP: "192.0.2.1"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.MagicLinkLoginR) {
+				s.EXPECT().LoginMagicLink(request).Return(models.LoginResult{}, service.ErrAccountLocked)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"account locked"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/magic-link/verify", authController.LoginMagicLink)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/magic-link/verify", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginMFA exchanges the challenge token returned by Login and a TOTP or
+// recovery code for tokens.
+func (ac *AuthController) LoginMFA(context *gin.Context) {
+	var request models.LoginMFAR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	request.IP = context.ClientIP()
+	request.UserAgent = context.Request.UserAgent()
+
+	result, err := ac.authService.LoginMFA(request)
+
+	if err != nil {
+		mfaError(context, err, "couldn't generate tokens")
+		return
+	}
+
+	context.JSON(http.StatusOK, result)
+}
+
+// EnrollTOTPChallenge lets a user who must use MFA enroll during the login.
+func (ac *AuthController) EnrollTOTPChallenge(context *gin.Context) {
+	var request models.MFAChallengeR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	enrollment, err := ac.authService.EnrollTOTPChallenge(request)
+
+	if err != nil {
+		mfaError(context, err, "couldn't start enrollment")
+		return
+	}
+
+	context.JSON(http.StatusOK, enrollment)
+}
+
+func (ac *AuthController) EnrollTOTP(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	enrollment, err := ac.authService.EnrollTOTP(principal)
+
+	if err != nil {
+		mfaError(context, err, "couldn't start enrollment")
+		return
+	}
+
+	context.JSON(http.StatusOK, enrollment)
+}
+
+func (ac *AuthController) ConfirmTOTP(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.MFACodeR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	codes, err := ac.authService.ConfirmTOTP(principal, request)
+
+	if err != nil {
+		mfaError(context, err, "couldn't enable mfa")
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (ac *AuthController) DisableMFA(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.MFACodeR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.DisableMFA(principal, request)
+
+	if err != nil {
+		mfaError(context, err, "couldn't disable mfa")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) RegenerateRecoveryCodes(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.MFACodeR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	codes, err := ac.authService.RegenerateRecoveryCodes(principal, request)
+
+	if err != nil {
+		mfaError(context, err, "couldn't generate recovery codes")
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// mfaError maps the errors shared by the MFA endpoints, anything else is
+// reported with message.
+func mfaError(context *gin.Context, err error, message string) {
+	var lockedOut *service.LockedOutError
+
+	switch {
+	case errors.As(err, &lockedOut):
+		middleware.TooManyRequests(context, lockedOut.RetryAfter, err.Error())
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, utils.ErrInvalidToken),
+		errors.Is(err, utils.ErrInvalidTokenType):
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrMFARequired):
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		context.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrMFANotEnabled):
+		context.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
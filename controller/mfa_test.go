@@ -0,0 +1,378 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_LoginMFA(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.LoginMFAR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.LoginMFAR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"mfa_token":"MMM", "code":"123456"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "123456",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda"}`,
+		},
+		{
+			name:      "Enrollment completed",
+			inputBody: `{"mfa_token":"MMM", "code":"123456"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "123456",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda",
+					RecoveryCodes: []string{"0a1b2-c3d4e"}}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda","recovery_codes":["0a1b2-c3d4e"]}`,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"mfa_token":"MMM"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Invalid code",
+			inputBody: `{"mfa_token":"MMM", "code":"000000"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "000000",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{}, service.ErrInvalidMFACode)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid mfa code"}`,
+		},
+		{
+			name:      "Locked out",
+			inputBody: `{"mfa_token":"MMM", "code":"000000"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "000000",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{}, &service.LockedOutError{RetryAfter: 30 * time.Second})
+			},
+			expectedStatusCode:  429,
+			expectedRequestBody: `{"message":"too many failed attempts"}`,
+		},
+		{
+			name:      "Invalid token",
+			inputBody: `{"mfa_token":"MMM", "code":"123456"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "123456",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{}, utils.ErrInvalidToken)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid token"}`,
+		},
+		{
+			name:      "Server error",
+			inputBody: `{"mfa_token":"MMM", "code":"123456"}`,
+			inputRequest: models.LoginMFAR{
+				MFAToken: "MMM",
+				Code:     "123456",
+				IP:       "192.0.2.1",
+			},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.LoginMFAR) {
+				s.EXPECT().LoginMFA(request).Return(models.LoginResult{}, errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't generate tokens"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/login/mfa", authController.LoginMFA)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/login/mfa", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_EnrollTOTP(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().EnrollTOTP(principal).Return(models.TOTPEnrollment{Secret: "SECRET", URI: "otpauth://totp/x"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"secret":"SECRET","uri":"otpauth://totp/x"}`,
+		},
+		{
+			name: "Already enabled",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal) {
+				s.EXPECT().EnrollTOTP(principal).Return(models.TOTPEnrollment{}, service.ErrMFAAlreadyEnabled)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"mfa already enabled"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/mfa/totp", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.EnrollTOTP)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/mfa/totp", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_ConfirmTOTP(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.MFACodeR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"code":"123456"}`,
+			inputRequest: models.MFACodeR{Code: "123456"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().ConfirmTOTP(principal, request).Return([]string{"0a1b2-c3d4e", "5f6a7-b8c9d"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"recovery_codes":["0a1b2-c3d4e","5f6a7-b8c9d"]}`,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:         "Enrollment not started",
+			inputBody:    `{"code":"123456"}`,
+			inputRequest: models.MFACodeR{Code: "123456"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().ConfirmTOTP(principal, request).Return(nil, service.ErrMFANotEnabled)
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"mfa not enabled"}`,
+		},
+		{
+			name:         "Invalid code",
+			inputBody:    `{"code":"000000"}`,
+			inputRequest: models.MFACodeR{Code: "000000"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().ConfirmTOTP(principal, request).Return(nil, service.ErrInvalidMFACode)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid mfa code"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/mfa/totp/confirm", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.ConfirmTOTP)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/mfa/totp/confirm", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_DisableMFA(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "clinician", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.MFACodeR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"code":"123456"}`,
+			inputRequest: models.MFACodeR{Code: "123456"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().DisableMFA(principal, request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:         "Required for the role",
+			inputBody:    `{"code":"123456"}`,
+			inputRequest: models.MFACodeR{Code: "123456"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().DisableMFA(principal, request).Return(service.ErrMFARequired)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"mfa is required for the role"}`,
+		},
+		{
+			name:         "Server error",
+			inputBody:    `{"code":"123456"}`,
+			inputRequest: models.MFACodeR{Code: "123456"},
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.MFACodeR) {
+				s.EXPECT().DisableMFA(principal, request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't disable mfa"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/mfa/disable", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.DisableMFA)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/mfa/disable", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
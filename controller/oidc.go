@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BeginOIDCLogin returns the nonce to request the ID token with.
+func (ac *AuthController) BeginOIDCLogin(context *gin.Context) {
+	nonce, err := ac.authService.BeginOIDCLogin()
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't start login"})
+		return
+	}
+
+	context.JSON(http.StatusOK, nonce)
+}
+
+// LoginOIDC exchanges an Apple or Google ID token for tokens.
+func (ac *AuthController) LoginOIDC(context *gin.Context) {
+	var request models.OIDCLoginR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	request.IP = context.ClientIP()
+	request.UserAgent = context.Request.UserAgent()
+
+	result, err := ac.authService.LoginOIDC(request)
+
+	if err != nil {
+		identityError(context, err, "couldn't generate tokens")
+		return
+	}
+
+	context.JSON(http.StatusOK, result)
+}
+
+func (ac *AuthController) ListIdentities(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	identities, err := ac.authService.ListIdentities(principal)
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't list identities"})
+		return
+	}
+
+	context.JSON(http.StatusOK, identities)
+}
+
+func (ac *AuthController) LinkIdentity(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.LinkIdentityR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.LinkIdentity(principal, request)
+
+	if err != nil {
+		identityError(context, err, "couldn't link identity")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func (ac *AuthController) UnlinkIdentity(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	err := ac.authService.UnlinkIdentity(principal, context.Param("provider"))
+
+	if err != nil {
+		identityError(context, err, "couldn't unlink identity")
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
+
+func identityError(context *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrUnknownProvider), errors.Is(err, service.ErrIdentityNotFound):
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, utils.ErrInvalidIDToken):
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrIdentityEmailUnverified):
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrIdentityConflict), errors.Is(err, service.ErrIdentityLinked):
+		context.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
@@ -0,0 +1,301 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_LoginOIDC(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.OIDCLoginR)
+
+	request := models.OIDCLoginR{
+		Provider: "apple",
+		IDToken:  "III",
+		Nonce:    "NNN",
+		DeviceID: "DDD",
+		IP:       "192.0.2.1",
+	}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"provider":"apple", "id_token":"III", "nonce":"NNN", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+				s.EXPECT().LoginOIDC(request).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda"}`,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"provider":"apple", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "No nonce",
+			inputBody: `{"provider":"apple", "id_token":"III", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Unknown provider",
+			inputBody: `{"provider":"apple", "id_token":"III", "nonce":"NNN", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+				s.EXPECT().LoginOIDC(request).Return(models.LoginResult{}, utils.ErrUnknownProvider)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"unknown identity provider"}`,
+		},
+		{
+			name:      "Invalid token",
+			inputBody: `{"provider":"apple", "id_token":"III", "nonce":"NNN", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+				s.EXPECT().LoginOIDC(request).Return(models.LoginResult{}, utils.ErrInvalidIDToken)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid id token"}`,
+		},
+		{
+			name:      "Unverified account",
+			inputBody: `{"provider":"apple", "id_token":"III", "nonce":"NNN", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+				s.EXPECT().LoginOIDC(request).Return(models.LoginResult{}, service.ErrIdentityConflict)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"an account with the email exists, sign in to link the identity"}`,
+		},
+		{
+			name:      "Server error",
+			inputBody: `{"provider":"apple", "id_token":"III", "nonce":"NNN", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.OIDCLoginR) {
+				s.EXPECT().LoginOIDC(request).Return(models.LoginResult{}, errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't generate tokens"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, request)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/oidc", authController.LoginOIDC)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/oidc", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_BeginOIDCLogin(t *testing.T) {
+	var testCases = []struct {
+		name                string
+		err                 error
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:                "OK",
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"nonce":"NNN"}`,
+		},
+		{
+			name:                "Server error",
+			err:                 errors.New("Server error"),
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't start login"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+
+			nonce := models.OIDCNonce{}
+
+			if tt.err == nil {
+				nonce.Nonce = "NNN"
+			}
+
+			auth.EXPECT().BeginOIDCLogin().Return(nonce, tt.err)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/oidc/nonce", authController.BeginOIDCLogin)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/oidc/nonce", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_LinkIdentity(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.LinkIdentityR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+	request := models.LinkIdentityR{Provider: "google", IDToken: "III", Nonce: "NNN"}
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.LinkIdentityR) {
+				s.EXPECT().LinkIdentity(principal, request).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name: "Linked to another user",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.LinkIdentityR) {
+				s.EXPECT().LinkIdentity(principal, request).Return(service.ErrIdentityLinked)
+			},
+			expectedStatusCode:  409,
+			expectedRequestBody: `{"message":"identity already linked"}`,
+		},
+		{
+			name: "Invalid token",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.LinkIdentityR) {
+				s.EXPECT().LinkIdentity(principal, request).Return(utils.ErrInvalidIDToken)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid id token"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, request)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/me/identities", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.LinkIdentity)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/me/identities", bytes.NewBufferString(`{"provider":"google", "id_token":"III", "nonce":"NNN"}`))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_UnlinkIdentity(t *testing.T) {
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+
+	var testCases = []struct {
+		name                string
+		err                 error
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{name: "OK", expectedStatusCode: 200},
+		{name: "Not linked", err: service.ErrIdentityNotFound, expectedStatusCode: 404,
+			expectedRequestBody: `{"message":"identity not found"}`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			auth.EXPECT().UnlinkIdentity(principal, "apple").Return(tt.err)
+
+			authController := NewAuthController(auth)
+
+			r := gin.New()
+			r.DELETE("/me/identities/:provider", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.UnlinkIdentity)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("DELETE", "/me/identities/apple", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"DiaSync/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *AuthController) ListFailedEmails(context *gin.Context) {
+	emails, err := ac.authService.ListFailedEmails()
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't list emails"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"emails": emails})
+}
+
+func (ac *AuthController) RetryEmail(context *gin.Context) {
+	id, err := strconv.ParseInt(context.Param("id"), 10, 64)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.RetryEmail(id)
+
+	if errors.Is(err, service.ErrEmailNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": "couldn't retry email"})
+		return
+	}
+
+	context.Status(http.StatusOK)
+}
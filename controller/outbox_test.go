@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_ListFailedEmails(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization)
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().ListFailedEmails().Return([]models.OutboxEmail{{
+					ID:            7,
+					To:            "Dima",
+					Subject:       "Confirm your email",
+					Text:          "secret link",
+					HTML:          "secret link",
+					Attempts:      8,
+					LastError:     "550 mailbox unavailable",
+					NextAttemptAt: createdAt,
+					DeadAt:        &createdAt,
+					CreatedAt:     createdAt,
+				}}, nil)
+			},
+			expectedStatusCode: 200,
+			expectedRequestBody: `{"emails":[{"id":7,"to":"Dima","subject":"Confirm your email","notification":false,"attempts":8,` +
+				`"last_error":"550 mailbox unavailable","next_attempt_at":"2024-01-01T00:00:00Z",` +
+				`"dead_at":"2024-01-01T00:00:00Z","created_at":"2024-01-01T00:00:00Z"}]}`,
+		},
+		{
+			name: "Server error",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().ListFailedEmails().Return(nil, errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't list emails"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.GET("/admin/emails", authController.ListFailedEmails)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/admin/emails", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_RetryEmail(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization)
+
+	var testCases = []struct {
+		name                string
+		id                  string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			id:   "7",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().RetryEmail(int64(7)).Return(nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: ``,
+		},
+		{
+			name:                "Incorrect id",
+			id:                  "abc",
+			mockBehavior:        func(s *mock_service.MockAuthorization) {},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name: "Not found",
+			id:   "7",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().RetryEmail(int64(7)).Return(service.ErrEmailNotFound)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"failed email not found"}`,
+		},
+		{
+			name: "Server error",
+			id:   "7",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().RetryEmail(int64(7)).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't retry email"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/admin/emails/:id/retry", authController.RetryEmail)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/admin/emails/"+tt.id+"/retry", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+//go:embed templates/link_page.html
+var pageFiles embed.FS
+
+var linkPageTemplate = template.Must(template.ParseFS(pageFiles, "templates/link_page.html"))
+
+// linkPage is the landing page of an emailed link: a form confirming the
+// action, or its result when Submit is empty.
+type linkPage struct {
+	Locale        string
+	Title         string
+	Message       string
+	Errors        []string
+	Action        string
+	Submit        string
+	Password      bool
+	PasswordLabel string
+	ConfirmLabel  string
+	AppLink       template.URL
+	OpenInApp     string
+}
+
+// flowTexts describe the page of one kind of link. A flow without submit
+// can't be finished in the browser.
+type flowTexts struct {
+	title, prompt, submit, done string
+}
+
+// pageTexts are the strings of the landing pages in one locale.
+type pageTexts struct {
+	flows         map[string]flowTexts
+	invalidTitle  string
+	invalid       string
+	failed        string
+	emailTaken    string
+	weakPassword  string
+	mismatch      string
+	passwordLabel string
+	confirmLabel  string
+	openInApp     string
+}
+
+var linkPageTexts = map[string]pageTexts{
+	"ru": {
+		flows: map[string]flowTexts{
+			utils.LinkVerifyEmail: {"Подтверждение email", "Нажмите кнопку, чтобы подтвердить адрес.",
+				"Подтвердить", "Email подтверждён. Теперь можно войти в приложение."},
+			utils.LinkResetPassword: {"Новый пароль", "Придумайте новый пароль для DiaSync.", "Сохранить",
+				"Пароль изменён. Войдите в приложение с новым паролем."},
+			utils.LinkMagicLink: {"Вход по ссылке", "Откройте ссылку на устройстве, где запрашивали вход, " +
+				"или введите в приложении код из письма.", "", ""},
+			utils.LinkConfirmEmailChange: {"Смена email", "Нажмите кнопку, чтобы перейти на этот адрес.",
+				"Сменить email", "Email изменён."},
+			utils.LinkUndoEmailChange: {"Возврат email", "Нажмите кнопку, чтобы вернуть прежний адрес и " +
+				"выйти из аккаунта на всех устройствах.", "Вернуть адрес",
+				"Прежний email восстановлен, все сессии завершены. Войдите заново и смените пароль."},
+			utils.LinkSecureAccount: {"Защита аккаунта", "Нажмите кнопку, чтобы выйти из аккаунта на всех " +
+				"устройствах.", "Выйти везде",
+				"Все сессии завершены. Войдите заново и смените пароль."},
+		},
+		invalidTitle:  "Ссылка недействительна",
+		invalid:       "Ссылка устарела или уже использована. Запросите новую в приложении.",
+		failed:        "Что-то пошло не так. Попробуйте позже.",
+		emailTaken:    "Этот адрес уже занят другим аккаунтом.",
+		weakPassword:  "Пароль не подходит:",
+		mismatch:      "Пароли не совпадают.",
+		passwordLabel: "Новый пароль",
+		confirmLabel:  "Повторите пароль",
+		openInApp:     "Открыть в приложении",
+	},
+	"en": {
+		flows: map[string]flowTexts{
+			utils.LinkVerifyEmail: {"Email confirmation", "Press the button to confirm your address.",
+				"Confirm", "Your email is confirmed. You can sign in to the app now."},
+			utils.LinkResetPassword: {"New password", "Choose a new password for DiaSync.", "Save",
+				"Your password is changed. Sign in to the app with the new password."},
+			utils.LinkMagicLink: {"Sign in link", "Open the link on the device you're signing in on, " +
+				"or enter the code from the email in the app.", "", ""},
+			utils.LinkConfirmEmailChange: {"Email change", "Press the button to switch to this address.",
+				"Change email", "Your email is changed."},
+			utils.LinkUndoEmailChange: {"Email restore", "Press the button to restore your previous " +
+				"address and sign out on every device.", "Restore address",
+				"Your previous email is restored and every session is ended. Sign in again and change " +
+					"your password."},
+			utils.LinkSecureAccount: {"Account protection", "Press the button to sign out on every device.",
+				"Sign out everywhere", "Every session is ended. Sign in again and change your password."},
+		},
+		invalidTitle:  "Invalid link",
+		invalid:       "The link has expired or was already used. Request a new one in the app.",
+		failed:        "Something went wrong. Please try again later.",
+		emailTaken:    "The address is already used by another account.",
+		weakPassword:  "The password doesn't fit:",
+		mismatch:      "The passwords don't match.",
+		passwordLabel: "New password",
+		confirmLabel:  "Repeat the password",
+		openInApp:     "Open in the app",
+	},
+}
+
+// LinkPage answers an emailed link opened in a browser. It only shows a form
+// posting back to the link: mail scanners following links must not use the
+// token up. A magic link can't be finished in the browser and redirects to
+// the app if there is one.
+func (ac *AuthController) LinkPage(context *gin.Context) {
+	path := context.FullPath()
+	token := context.Query("token")
+	locale, texts := localeTexts(context)
+
+	if token == "" {
+		renderLinkPage(context, http.StatusBadRequest, linkPage{Locale: locale, Title: texts.invalidTitle,
+			Message: texts.invalid})
+		return
+	}
+
+	if appLink := utils.AppLink(path, token); path == utils.LinkMagicLink && appLink != "" {
+		context.Redirect(http.StatusFound, appLink)
+		return
+	}
+
+	renderLinkPage(context, http.StatusOK, linkFormPage(context, locale, texts))
+}
+
+// linkFormPage asks to confirm the flow of the link, with the app link if
+// there is an app.
+func linkFormPage(context *gin.Context, locale string, texts pageTexts) linkPage {
+	path := context.FullPath()
+	flow := texts.flows[path]
+
+	return linkPage{
+		Locale:        locale,
+		Title:         flow.title,
+		Message:       flow.prompt,
+		Action:        context.Request.URL.RequestURI(),
+		Submit:        flow.submit,
+		Password:      path == utils.LinkResetPassword,
+		PasswordLabel: texts.passwordLabel,
+		ConfirmLabel:  texts.confirmLabel,
+		AppLink:       template.URL(utils.AppLink(path, context.Query("token"))),
+		OpenInApp:     texts.openInApp,
+	}
+}
+
+// isLinkPageForm reports whether the request was posted by the form of
+// LinkPage rather than by the app.
+func isLinkPageForm(context *gin.Context) bool {
+	return context.ContentType() == binding.MIMEPOSTForm
+}
+
+// submitLinkPage finishes the flow of the link posted by its page and shows
+// the result.
+func (ac *AuthController) submitLinkPage(context *gin.Context) {
+	path := context.FullPath()
+	token := context.Query("token")
+	locale, texts := localeTexts(context)
+	flow := texts.flows[path]
+
+	page := linkPage{Locale: locale, Title: flow.title, Message: flow.done}
+
+	var err error
+
+	switch path {
+	case utils.LinkVerifyEmail:
+		err = ac.authService.VerifyEmail(token)
+	case utils.LinkResetPassword:
+		password := context.PostForm("new_password")
+
+		if password != context.PostForm("new_password_confirm") {
+			err = errPasswordMismatch
+			break
+		}
+
+		err = ac.authService.VerifyNewPassword(models.NewPasswordR{Token: token, NewPassword: password})
+	case utils.LinkConfirmEmailChange:
+		err = ac.authService.ConfirmEmailChange(token)
+	case utils.LinkUndoEmailChange:
+		err = ac.authService.UndoEmailChange(token)
+	case utils.LinkSecureAccount:
+		err = ac.authService.SecureAccount(token)
+	}
+
+	var policyErr *utils.PasswordPolicyError
+
+	switch {
+	case err == nil:
+		renderLinkPage(context, http.StatusOK, page)
+	case errors.Is(err, errPasswordMismatch):
+		page = linkFormPage(context, locale, texts)
+		page.Errors = []string{texts.mismatch}
+		renderLinkPage(context, http.StatusBadRequest, page)
+	case errors.As(err, &policyErr):
+		page = linkFormPage(context, locale, texts)
+		page.Errors = []string{texts.weakPassword}
+
+		for _, violation := range policyErr.Violations {
+			page.Errors = append(page.Errors, violation.Message)
+		}
+
+		renderLinkPage(context, http.StatusBadRequest, page)
+	case errors.Is(err, utils.ErrInvalidToken):
+		renderLinkPage(context, http.StatusBadRequest, linkPage{Locale: locale, Title: texts.invalidTitle,
+			Message: texts.invalid})
+	case errors.Is(err, service.ErrEmailTaken):
+		page.Message = texts.emailTaken
+		renderLinkPage(context, http.StatusConflict, page)
+	default:
+		page.Message = texts.failed
+		renderLinkPage(context, http.StatusInternalServerError, page)
+	}
+}
+
+var errPasswordMismatch = errors.New("passwords don't match")
+
+func localeTexts(context *gin.Context) (string, pageTexts) {
+	locale := mailer.MatchLocale(context.GetHeader("Accept-Language"))
+
+	return locale, linkPageTexts[locale]
+}
+
+// renderLinkPage keeps the token in the URL out of caches and referrers.
+func renderLinkPage(context *gin.Context, status int, page linkPage) {
+	context.Header("Cache-Control", "no-store")
+	context.Header("Referrer-Policy", "no-referrer")
+	context.Header("X-Frame-Options", "DENY")
+	context.Header("Content-Security-Policy",
+		"default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	context.Header("Content-Type", "text/html; charset=utf-8")
+	context.Status(status)
+
+	linkPageTemplate.Execute(context.Writer, page)
+}
+
+// AppleAppSiteAssociation lets iOS open the emailed links in the app.
+func AppleAppSiteAssociation(context *gin.Context) {
+	association, ok := utils.AppleAppSiteAssociation()
+
+	if !ok {
+		context.Status(http.StatusNotFound)
+		return
+	}
+
+	context.JSON(http.StatusOK, association)
+}
+
+// AssetLinks lets Android open the emailed links in the app.
+func AssetLinks(context *gin.Context) {
+	statements, ok := utils.AssetLinks()
+
+	if !ok {
+		context.Status(http.StatusNotFound)
+		return
+	}
+
+	context.JSON(http.StatusOK, statements)
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"DiaSync/config"
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_LinkPage(t *testing.T) {
+	defer utils.InitLinks(config.HttpServer{})
+
+	var testCases = []struct {
+		name               string
+		appURL             string
+		path               string
+		acceptLanguage     string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedBody       []string
+	}{
+		{
+			name:               "Verify email",
+			path:               "/auth/verify-email?token=abc",
+			expectedStatusCode: 200,
+			expectedBody: []string{`<form method="post" action="/auth/verify-email?token=abc">`,
+				"Подтвердить"},
+		},
+		{
+			name:               "English",
+			path:               "/auth/verify-email?token=abc",
+			acceptLanguage:     "en-US,en;q=0.9",
+			expectedStatusCode: 200,
+			expectedBody:       []string{`<html lang="en">`, "Confirm"},
+		},
+		{
+			name:               "Reset password with app",
+			appURL:             "diasync://app",
+			path:               "/auth/verify-newpassword?token=abc",
+			expectedStatusCode: 200,
+			expectedBody: []string{`name="new_password"`, `name="new_password_confirm"`,
+				`href="diasync://app/auth/verify-newpassword?token=abc"`},
+		},
+		{
+			name:               "Magic link",
+			path:               "/auth/magic-link/verify?token=abc",
+			expectedStatusCode: 200,
+			expectedBody:       []string{"Вход по ссылке"},
+		},
+		{
+			name:               "Magic link with app",
+			appURL:             "diasync://app",
+			path:               "/auth/magic-link/verify?token=abc",
+			expectedStatusCode: 302,
+			expectedLocation:   "diasync://app/auth/magic-link/verify?token=abc",
+		},
+		{
+			name:               "No token",
+			path:               "/auth/confirm-email-change",
+			expectedStatusCode: 400,
+			expectedBody:       []string{"Ссылка недействительна"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.InitLinks(config.HttpServer{AppLinks: config.AppLinks{URL: tt.appURL}})
+
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			authController := NewAuthController(service.Authorization(mock_service.NewMockAuthorization(c)))
+
+			r := gin.New()
+
+			for _, path := range utils.LinkPaths {
+				r.GET(path, authController.LinkPage)
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if location := w.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("got location %s expected %s", location, tt.expectedLocation)
+			}
+
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(w.Body.String(), expected) {
+					t.Errorf("got = %s expected to contain %s", w.Body.String(), expected)
+				}
+			}
+
+			if w.Code != 302 && w.Header().Get("Referrer-Policy") != "no-referrer" {
+				t.Error("page may leak the token in the referrer")
+			}
+		})
+	}
+}
+
+func TestAuthController_SubmitLinkPage(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization)
+
+	var testCases = []struct {
+		name               string
+		path               string
+		form               url.Values
+		mockBehavior       mockBehavior
+		expectedStatusCode int
+		expectedBody       []string
+	}{
+		{
+			name: "Verify email",
+			path: "/auth/verify-email?token=abc",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().VerifyEmail("abc").Return(nil)
+			},
+			expectedStatusCode: 200,
+			expectedBody:       []string{"Email подтверждён"},
+		},
+		{
+			name: "Used token",
+			path: "/auth/verify-email?token=abc",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().VerifyEmail("abc").Return(utils.ErrInvalidToken)
+			},
+			expectedStatusCode: 400,
+			expectedBody:       []string{"Ссылка недействительна"},
+		},
+		{
+			name: "Reset password",
+			path: "/auth/verify-newpassword?token=abc",
+			form: url.Values{"new_password": {"Secret-123"}, "new_password_confirm": {"Secret-123"}},
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().VerifyNewPassword(models.NewPasswordR{Token: "abc", NewPassword: "Secret-123"}).Return(nil)
+			},
+			expectedStatusCode: 200,
+			expectedBody:       []string{"Пароль изменён"},
+		},
+		{
+			name:               "Passwords mismatch",
+			path:               "/auth/verify-newpassword?token=abc",
+			form:               url.Values{"new_password": {"Secret-123"}, "new_password_confirm": {"Secret-321"}},
+			mockBehavior:       func(s *mock_service.MockAuthorization) {},
+			expectedStatusCode: 400,
+			expectedBody:       []string{"Пароли не совпадают", `name="new_password"`},
+		},
+		{
+			name: "Weak password",
+			path: "/auth/verify-newpassword?token=abc",
+			form: url.Values{"new_password": {"123"}, "new_password_confirm": {"123"}},
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().VerifyNewPassword(models.NewPasswordR{Token: "abc", NewPassword: "123"}).Return(
+					&utils.PasswordPolicyError{Violations: []utils.PasswordViolation{
+						{Code: utils.ViolationTooShort, Message: "password must be at least 8 characters long"},
+					}})
+			},
+			expectedStatusCode: 400,
+			expectedBody:       []string{"Пароль не подходит", "password must be at least 8 characters long"},
+		},
+		{
+			name: "Email taken",
+			path: "/auth/confirm-email-change?token=abc",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().ConfirmEmailChange("abc").Return(service.ErrEmailTaken)
+			},
+			expectedStatusCode: 409,
+			expectedBody:       []string{"уже занят"},
+		},
+		{
+			name: "Server error",
+			path: "/auth/undo-email-change?token=abc",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().UndoEmailChange("abc").Return(errors.New("Server error"))
+			},
+			expectedStatusCode: 500,
+			expectedBody:       []string{"Что-то пошло не так"},
+		},
+		{
+			name: "Secure account",
+			path: "/auth/secure-account?token=abc",
+			mockBehavior: func(s *mock_service.MockAuthorization) {
+				s.EXPECT().SecureAccount("abc").Return(nil)
+			},
+			expectedStatusCode: 200,
+			expectedBody:       []string{"Все сессии завершены"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth)
+
+			authController := NewAuthController(service.Authorization(auth))
+
+			r := gin.New()
+			r.POST("/auth/verify-email", authController.VerifyEmail)
+			r.POST("/auth/verify-newpassword", authController.VerifyNewPassword)
+			r.POST("/auth/confirm-email-change", authController.ConfirmEmailChange)
+			r.POST("/auth/undo-email-change", authController.UndoEmailChange)
+			r.POST("/auth/secure-account", authController.SecureAccount)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(w.Body.String(), expected) {
+					t.Errorf("got = %s expected to contain %s", w.Body.String(), expected)
+				}
+			}
+		})
+	}
+}
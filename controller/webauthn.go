@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ac *AuthController) BeginPasskeyRegistration(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	options, err := ac.authService.BeginPasskeyRegistration(principal)
+
+	if err != nil {
+		passkeyError(context, err, "couldn't start registration")
+		return
+	}
+
+	context.JSON(http.StatusOK, options)
+}
+
+func (ac *AuthController) FinishPasskeyRegistration(context *gin.Context) {
+	principal, ok := middleware.GetPrincipal(context)
+
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+		return
+	}
+
+	var request models.PasskeyRegistrationR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	err = ac.authService.FinishPasskeyRegistration(principal, request)
+
+	if err != nil {
+		passkeyError(context, err, "couldn't register passkey")
+		return
+	}
+
+	context.Status(http.StatusCreated)
+}
+
+func (ac *AuthController) BeginPasskeyLogin(context *gin.Context) {
+	var request models.PasskeyLoginBeginR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	options, err := ac.authService.BeginPasskeyLogin(request)
+
+	if err != nil {
+		passkeyError(context, err, "couldn't start login")
+		return
+	}
+
+	context.JSON(http.StatusOK, options)
+}
+
+func (ac *AuthController) FinishPasskeyLogin(context *gin.Context) {
+	var request models.PasskeyLoginR
+
+	err := context.ShouldBindJSON(&request)
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "incorrect data"})
+		return
+	}
+
+	request.IP = context.ClientIP()
+	request.UserAgent = context.Request.UserAgent()
+
+	result, err := ac.authService.FinishPasskeyLogin(request)
+
+	if err != nil {
+		passkeyError(context, err, "couldn't generate tokens")
+		return
+	}
+
+	context.JSON(http.StatusOK, result)
+}
+
+func passkeyError(context *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrPasskeysDisabled):
+		context.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, utils.ErrInvalidPasskey), errors.Is(err, utils.ErrPasskeyCloned):
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrAccountLocked):
+		context.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, gin.H{"message": message})
+	}
+}
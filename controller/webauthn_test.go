@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"DiaSync/middleware"
+	"DiaSync/models"
+	"DiaSync/service"
+	mock_service "DiaSync/service/mocks"
+	"DiaSync/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthController_BeginPasskeyLogin(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.PasskeyLoginBeginR)
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		inputRequest        models.PasskeyLoginBeginR
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:         "OK",
+			inputBody:    `{"email":"Dima"}`,
+			inputRequest: models.PasskeyLoginBeginR{Email: "Dima"},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginBeginR) {
+				s.EXPECT().BeginPasskeyLogin(request).Return(models.WebAuthnOptions{ChallengeID: "CCC",
+					Options: json.RawMessage(`{"publicKey":{"challenge":"AAA"}}`)}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"challenge_id":"CCC","options":{"publicKey":{"challenge":"AAA"}}}`,
+		},
+		{
+			name:         "Disabled",
+			inputBody:    `{}`,
+			inputRequest: models.PasskeyLoginBeginR{},
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginBeginR) {
+				s.EXPECT().BeginPasskeyLogin(request).Return(models.WebAuthnOptions{}, utils.ErrPasskeysDisabled)
+			},
+			expectedStatusCode:  404,
+			expectedRequestBody: `{"message":"passkeys are disabled"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, tt.inputRequest)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/webauthn/login/begin", authController.BeginPasskeyLogin)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/webauthn/login/begin", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_FinishPasskeyLogin(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, request models.PasskeyLoginR)
+
+	request := models.PasskeyLoginR{
+		ChallengeID: "CCC",
+		Credential:  json.RawMessage(`{"id":"AAA"}`),
+		DeviceID:    "DDD",
+		IP:          "192.0.2.1",
+	}
+
+	var testCases = []struct {
+		name                string
+		inputBody           string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"challenge_id":"CCC", "credential":{"id":"AAA"}, "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginR) {
+				s.EXPECT().FinishPasskeyLogin(request).Return(models.LoginResult{AccessToken: "asdasdads", RefreshToken: "sadasfasfda"}, nil)
+			},
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"access_token":"asdasdads","refresh_token":"sadasfasfda"}`,
+		},
+		{
+			name:      "Incorrect request",
+			inputBody: `{"challenge_id":"CCC", "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginR) {
+
+			},
+			expectedStatusCode:  400,
+			expectedRequestBody: `{"message":"incorrect data"}`,
+		},
+		{
+			name:      "Invalid passkey",
+			inputBody: `{"challenge_id":"CCC", "credential":{"id":"AAA"}, "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginR) {
+				s.EXPECT().FinishPasskeyLogin(request).Return(models.LoginResult{}, utils.ErrInvalidPasskey)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid passkey"}`,
+		},
+		{
+			name:      "Cloned passkey",
+			inputBody: `{"challenge_id":"CCC", "credential":{"id":"AAA"}, "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginR) {
+				s.EXPECT().FinishPasskeyLogin(request).Return(models.LoginResult{}, utils.ErrPasskeyCloned)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"passkey sign counter went back"}`,
+		},
+		{
+			name:      "Account locked",
+			inputBody: `{"challenge_id":"CCC", "credential":{"id":"AAA"}, "device_id":"DDD"}`,
+			mockBehavior: func(s *mock_service.MockAuthorization, request models.PasskeyLoginR) {
+				s.EXPECT().FinishPasskeyLogin(request).Return(models.LoginResult{}, service.ErrAccountLocked)
+			},
+			expectedStatusCode:  403,
+			expectedRequestBody: `{"message":"account locked"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, request)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/webauthn/login/finish", authController.FinishPasskeyLogin)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/webauthn/login/finish", bytes.NewBufferString(tt.inputBody))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestAuthController_FinishPasskeyRegistration(t *testing.T) {
+	type mockBehavior func(s *mock_service.MockAuthorization, principal models.Principal, request models.PasskeyRegistrationR)
+
+	principal := models.Principal{ID: "U1", Email: "Dima", Role: "patient", DeviceID: "DDD", SessionID: "SSS"}
+	request := models.PasskeyRegistrationR{ChallengeID: "CCC", Name: "Pixel", Credential: json.RawMessage(`{"id":"AAA"}`)}
+
+	var testCases = []struct {
+		name                string
+		mockBehavior        mockBehavior
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name: "OK",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.PasskeyRegistrationR) {
+				s.EXPECT().FinishPasskeyRegistration(principal, request).Return(nil)
+			},
+			expectedStatusCode:  201,
+			expectedRequestBody: ``,
+		},
+		{
+			name: "Invalid passkey",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.PasskeyRegistrationR) {
+				s.EXPECT().FinishPasskeyRegistration(principal, request).Return(utils.ErrInvalidPasskey)
+			},
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"invalid passkey"}`,
+		},
+		{
+			name: "Server error",
+			mockBehavior: func(s *mock_service.MockAuthorization, principal models.Principal, request models.PasskeyRegistrationR) {
+				s.EXPECT().FinishPasskeyRegistration(principal, request).Return(errors.New("Server error"))
+			},
+			expectedStatusCode:  500,
+			expectedRequestBody: `{"message":"couldn't register passkey"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			auth := mock_service.NewMockAuthorization(c)
+			tt.mockBehavior(auth, principal, request)
+
+			authService := service.Authorization(auth)
+			authController := NewAuthController(authService)
+
+			r := gin.New()
+			r.POST("/auth/webauthn/register/finish", func(context *gin.Context) {
+				context.Set(middleware.PrincipalKey, principal)
+			}, authController.FinishPasskeyRegistration)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/webauthn/register/finish",
+				bytes.NewBufferString(`{"challenge_id":"CCC", "name":"Pixel", "credential":{"id":"AAA"}}`))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBadDKIMKey = errors.New("dkim key must be an RSA private key in PEM")
+
+// dkimHeaders are signed if the message has them.
+var dkimHeaders = []string{"from", "to", "subject", "date", "message-id", "mime-version", "content-type",
+	"list-unsubscribe"}
+
+// DKIMSigner signs messages with rsa-sha256 and relaxed canonicalization of
+// the header and the body (RFC 6376).
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+}
+
+func LoadDKIMSigner(cfg config.DKIM) (*DKIMSigner, error) {
+	file, err := os.ReadFile(cfg.KeyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(file)
+
+	if block == nil {
+		return nil, ErrBadDKIMKey
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	if err != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, ErrBadDKIMKey
+		}
+
+		var ok bool
+		key, ok = parsed.(*rsa.PrivateKey)
+
+		if !ok {
+			return nil, ErrBadDKIMKey
+		}
+	}
+
+	return &DKIMSigner{domain: cfg.Domain, selector: cfg.Selector, key: key}, nil
+}
+
+// Sign returns the DKIM-Signature header field of the message with the
+// header fields and body.
+func (s *DKIMSigner) Sign(header []string, body []byte) (string, error) {
+	fields := map[string]string{}
+
+	for _, field := range header {
+		name, _, _ := strings.Cut(field, ":")
+		fields[strings.ToLower(strings.TrimSpace(name))] = field
+	}
+
+	hash := sha256.New()
+	signed := []string{}
+
+	for _, name := range dkimHeaders {
+		if field, ok := fields[name]; ok {
+			hash.Write([]byte(relaxedHeader(field) + "\r\n"))
+			signed = append(signed, name)
+		}
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	signature := "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=" + s.domain + "; s=" + s.selector +
+		"; t=" + strconv.FormatInt(time.Now().Unix(), 10) + "; h=" + strings.Join(signed, ":") +
+		"; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+
+	// the signature field itself is signed with an empty b= and no CRLF
+	hash.Write([]byte(relaxedHeader(signature)))
+
+	b, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash.Sum(nil))
+
+	if err != nil {
+		return "", err
+	}
+
+	return signature + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// relaxedHeader lowercases the name, unfolds the value and reduces every run
+// of whitespace to a single space.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+}
+
+// relaxedBody reduces the whitespace inside lines, drops it at their end and
+// drops the empty lines at the end of the body.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	for i, line := range lines {
+		var reduced strings.Builder
+		space := false
+
+		for _, r := range line {
+			if r == ' ' || r == '\t' {
+				space = true
+				continue
+			}
+
+			if space {
+				reduced.WriteByte(' ')
+				space = false
+			}
+
+			reduced.WriteRune(r)
+		}
+
+		lines[i] = reduced.String()
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The examples of RFC 6376, section 3.4.5.
+func TestRelaxedCanonicalization(t *testing.T) {
+	if got := relaxedHeader("A: X"); got != "a:X" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := relaxedHeader("B : Y\t\r\n\tZ  "); got != "b:Y Z" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := string(relaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))); got != " C\r\nD E\r\n" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("got %q for an empty body", got)
+	}
+}
+
+func TestDKIMSigner_Sign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+
+	composer, err := NewComposer(config.Email{Sender: "noreply@diasync.ru",
+		DKIM: config.DKIM{Domain: "diasync.ru", Selector: "mail", KeyFile: keyFile}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := composer.Message(Email{To: "dmitrkozyrev2@gmail.com", Subject: "Subject", Text: "Text",
+		HTML: "<p>Text</p>"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, body, _ := bytes.Cut(message, []byte("\r\n\r\n"))
+	fields := strings.Split(string(header), "\r\n")
+	signature := fields[0]
+
+	if !strings.HasPrefix(signature, "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=diasync.ru; s=mail;") {
+		t.Fatalf("got %s", signature)
+	}
+
+	tags := map[string]string{}
+
+	for _, tag := range strings.Split(strings.TrimPrefix(signature, "DKIM-Signature:"), ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+		tags[name] = value
+	}
+
+	if tags["h"] != "from:to:subject:date:message-id:mime-version:content-type" {
+		t.Errorf("got signed headers %s", tags["h"])
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		t.Errorf("got body hash %s", tags["bh"])
+	}
+
+	hash := sha256.New()
+
+	for _, field := range fields[1:] {
+		hash.Write([]byte(relaxedHeader(field) + "\r\n"))
+	}
+
+	hash.Write([]byte(relaxedHeader(strings.TrimSuffix(signature, tags["b"]))))
+	b, _ := base64.StdEncoding.DecodeString(tags["b"])
+
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash.Sum(nil), b); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadDKIMSigner_BadKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+
+	if _, err := LoadDKIMSigner(config.DKIM{KeyFile: keyFile}); err != ErrBadDKIMKey {
+		t.Errorf("got %v, want %v", err, ErrBadDKIMKey)
+	}
+}
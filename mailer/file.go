@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"DiaSync/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every email to an .eml file in the directory, for
+// development without an SMTP server.
+type FileMailer struct {
+	dir      string
+	composer Composer
+}
+
+func NewFileMailer(dir string, composer Composer) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o700)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir, composer: composer}, nil
+}
+
+func (m *FileMailer) Send(email Email) error {
+	message, err := m.composer.Message(email)
+
+	if err != nil {
+		return err
+	}
+
+	suffix, err := utils.RandomString(6)
+
+	if err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + suffix + ".eml"
+
+	return os.WriteFile(filepath.Join(m.dir, name), message, 0o600)
+}
+
+// WriterMailer writes the emails one after another, e.g. to stdout.
+type WriterMailer struct {
+	mu       sync.Mutex
+	writer   io.Writer
+	composer Composer
+}
+
+func NewWriterMailer(writer io.Writer, composer Composer) *WriterMailer {
+	return &WriterMailer{writer: writer, composer: composer}
+}
+
+func (m *WriterMailer) Send(email Email) error {
+	message, err := m.composer.Message(email)
+
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = m.writer.Write(append(message, '\n'))
+
+	return err
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+)
+
+// Locales are the languages of the templates.
+var Locales = []string{"ru", "en"}
+
+var ErrUnknownLocale = errors.New("unknown email locale")
+
+var defaultLocale = "ru"
+
+func initLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+
+	if !isLocale(locale) {
+		return ErrUnknownLocale
+	}
+
+	defaultLocale = locale
+
+	return nil
+}
+
+func isLocale(locale string) bool {
+	for _, supported := range Locales {
+		if supported == locale {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchLocale returns the first supported language of a locale like "en-US"
+// or an Accept-Language header like "de-DE,en;q=0.8", the default locale if
+// none is supported. Quality values are ignored, clients list the preferred
+// language first.
+func MatchLocale(header string) string {
+	for _, entry := range strings.Split(header, ",") {
+		tag, _, _ := strings.Cut(entry, ";")
+		language, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		language = strings.ToLower(language)
+
+		if isLocale(language) {
+			return language
+		}
+	}
+
+	return defaultLocale
+}
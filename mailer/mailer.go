@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"errors"
+	"os"
+)
+
+var ErrUnknownTransport = errors.New("unknown email transport")
+
+// Email is a rendered message, sent as multipart text and HTML. A
+// Notification isn't requested by the recipient and may be unsubscribed from.
+type Email struct {
+	To           string
+	Subject      string
+	Text         string
+	HTML         string
+	Notification bool
+}
+
+// Mailer delivers rendered emails. OutboxWorker only talks to this interface,
+// so tests can use MemoryMailer instead of a live SMTP server.
+type Mailer interface {
+	Send(Email) error
+}
+
+// New returns the mailer of the configured transport: "smtp" (the default),
+// "file" writing .eml files to email.dir, or "stdout".
+func New(cfg config.Email) (Mailer, error) {
+	err := initLocale(cfg.DefaultLocale)
+
+	if err != nil {
+		return nil, err
+	}
+
+	composer, err := NewComposer(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Transport {
+	case "", "smtp":
+		return NewSMTPMailer(cfg, composer)
+	case "file":
+		return NewFileMailer(cfg.Dir, composer)
+	case "stdout":
+		return NewWriterMailer(os.Stdout, composer), nil
+	}
+
+	return nil, ErrUnknownTransport
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import "sync"
+
+// MemoryMailer keeps the sent emails, for tests.
+type MemoryMailer struct {
+	mu     sync.Mutex
+	emails []Email
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(email Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails = append(m.emails, email)
+
+	return nil
+}
+
+// Sent returns the emails sent so far.
+func (m *MemoryMailer) Sent() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Email(nil), m.emails...)
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"DiaSync/utils"
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Composer encodes emails as RFC 5322 messages with the header fields shared
+// by every email of a mailer.
+type Composer struct {
+	From            mail.Address
+	ListUnsubscribe string
+	DKIM            *DKIMSigner
+}
+
+func NewComposer(cfg config.Email) (Composer, error) {
+	from, err := mail.ParseAddress(cfg.Sender)
+
+	if err != nil {
+		return Composer{}, err
+	}
+
+	composer := Composer{From: *from, ListUnsubscribe: cfg.ListUnsubscribe}
+
+	if cfg.DKIM.KeyFile != "" {
+		composer.DKIM, err = LoadDKIMSigner(cfg.DKIM)
+	}
+
+	return composer, err
+}
+
+// Message encodes the email as a multipart/alternative MIME message with
+// quoted-printable UTF-8 parts, the plain text one first. Notifications get
+// List-Unsubscribe, and the message is DKIM signed if a key is configured.
+func (c Composer) Message(email Email) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", email.Text},
+		{"text/html; charset=UTF-8", email.HTML},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+
+		_, err = encoder.Write([]byte(part.content))
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = encoder.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = parts.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := c.messageID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	header := []string{
+		"From: " + c.From.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("UTF-8", email.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID,
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=\"" + parts.Boundary() + "\"",
+	}
+
+	if email.Notification && c.ListUnsubscribe != "" {
+		header = append(header, "List-Unsubscribe: <"+c.ListUnsubscribe+">")
+	}
+
+	if c.DKIM != nil {
+		signature, err := c.DKIM.Sign(header, body.Bytes())
+
+		if err != nil {
+			return nil, err
+		}
+
+		header = append([]string{signature}, header...)
+	}
+
+	var message bytes.Buffer
+
+	message.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// messageID is unique across instances, its domain is the sender's.
+func (c Composer) messageID() (string, error) {
+	random, err := utils.RandomString(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	return "<" + random + "@" + c.From.Address[strings.LastIndex(c.From.Address, "@")+1:] + ">", nil
+}
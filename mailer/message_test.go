@@ -0,0 +1,150 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testComposer(t *testing.T) Composer {
+	composer, err := NewComposer(config.Email{Sender: "DiaSync <noreply@diasync.ru>",
+		ListUnsubscribe: "mailto:unsubscribe@diasync.ru"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return composer
+}
+
+func TestComposer_Message(t *testing.T) {
+	email := Email{To: "dmitrkozyrev2@gmail.com", Subject: "Подтвердите email", Text: "Текст\n",
+		HTML: "<p>Текст</p>"}
+
+	message, err := testComposer(t).Message(email)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(message))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+
+	if err != nil || subject != email.Subject {
+		t.Errorf("got subject %q, %v", subject, err)
+	}
+
+	from, _ := parsed.Header.AddressList("From")
+	to, _ := parsed.Header.AddressList("To")
+
+	if len(from) != 1 || from[0].Name != "DiaSync" || len(to) != 1 || to[0].Address != email.To {
+		t.Errorf("got from %s to %s", parsed.Header.Get("From"), parsed.Header.Get("To"))
+	}
+
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Error(err)
+	}
+
+	if id := parsed.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@diasync.ru>") {
+		t.Errorf("got message id %s", id)
+	}
+
+	if parsed.Header.Get("List-Unsubscribe") != "" {
+		t.Error("List-Unsubscribe added to a requested email")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %s, %v", mediaType, err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	expected := []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", "Текст\r\n"},
+		{"text/html; charset=UTF-8", email.HTML},
+	}
+
+	for _, want := range expected {
+		part, err := reader.NextPart()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, _ := io.ReadAll(part)
+
+		if part.Header.Get("Content-Type") != want.contentType || string(content) != want.content {
+			t.Errorf("got %s %q, want %s %q", part.Header.Get("Content-Type"), content, want.contentType,
+				want.content)
+		}
+	}
+
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("got %v, want only two parts", err)
+	}
+}
+
+func TestComposer_MessageNotification(t *testing.T) {
+	message, err := testComposer(t).Message(Email{To: "dmitrkozyrev2@gmail.com", Subject: "Subject",
+		Notification: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _ := mail.ReadMessage(bytes.NewReader(message))
+
+	if got := parsed.Header.Get("List-Unsubscribe"); got != "<mailto:unsubscribe@diasync.ru>" {
+		t.Errorf("got List-Unsubscribe %q", got)
+	}
+}
+
+func TestComposer_MessageRejectsHeaderInjection(t *testing.T) {
+	_, err := testComposer(t).Message(Email{To: "dmitrkozyrev2@gmail.com\r\nBcc: all@mail.com"})
+
+	if err == nil {
+		t.Error("got no error for a recipient with a line break")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	fileMailer, err := NewFileMailer(dir, testComposer(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		err = fileMailer.Send(Email{To: "dmitrkozyrev2@gmail.com", Subject: "Subject", Text: "Text"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	content, _ := os.ReadFile(files[0])
+
+	if _, err := mail.ReadMessage(bytes.NewReader(content)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,248 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+var (
+	ErrUnknownTLSMode = errors.New("unknown smtp tls mode")
+	ErrNoStartTLS     = errors.New("smtp server doesn't support STARTTLS")
+	ErrBadCAFile      = errors.New("no certificates in the smtp tls_ca_file")
+)
+
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "implicit"
+	TLSNone     = "none"
+)
+
+// SMTPMailer sends through an SMTP server with PLAIN authentication as the
+// sender. Connections are kept open between emails, so a batch is sent over
+// one connection instead of a handshake per email.
+type SMTPMailer struct {
+	composer    Composer
+	addr        string
+	host        string
+	password    string
+	tlsMode     string
+	tlsConfig   *tls.Config
+	timeout     time.Duration
+	idleTimeout time.Duration
+	idle        chan *smtpConn
+}
+
+type smtpConn struct {
+	conn   net.Conn
+	client *smtp.Client
+	usedAt time.Time
+}
+
+func NewSMTPMailer(cfg config.Email, composer Composer) (*SMTPMailer, error) {
+	m := &SMTPMailer{
+		composer:    composer,
+		addr:        cfg.SmtpAdr,
+		host:        cfg.SmtpServer,
+		password:    cfg.AppPassword,
+		tlsMode:     cfg.TLS,
+		tlsConfig:   &tls.Config{ServerName: cfg.SmtpServer, InsecureSkipVerify: cfg.TLSSkipVerify},
+		timeout:     30 * time.Second,
+		idleTimeout: time.Minute,
+		idle:        make(chan *smtpConn, 2),
+	}
+
+	switch cfg.TLS {
+	case "":
+		m.tlsMode = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, ErrUnknownTLSMode
+	}
+
+	if cfg.TLSCAFile != "" {
+		file, err := os.ReadFile(cfg.TLSCAFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.tlsConfig.RootCAs = x509.NewCertPool()
+
+		if !m.tlsConfig.RootCAs.AppendCertsFromPEM(file) {
+			return nil, ErrBadCAFile
+		}
+	}
+
+	if cfg.Timeout != 0 {
+		m.timeout = cfg.Timeout * time.Second
+	}
+
+	if cfg.IdleTimeout != 0 {
+		m.idleTimeout = cfg.IdleTimeout * time.Second
+	}
+
+	if cfg.PoolSize != 0 {
+		m.idle = make(chan *smtpConn, cfg.PoolSize)
+	}
+
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(email Email) error {
+	message, err := m.composer.Message(email)
+
+	if err != nil {
+		return err
+	}
+
+	to, err := mail.ParseAddress(email.To)
+
+	if err != nil {
+		return err
+	}
+
+	c, err := m.get()
+
+	if err != nil {
+		return err
+	}
+
+	err = m.send(c, to.Address, message)
+
+	if err != nil {
+		c.client.Close()
+		return err
+	}
+
+	m.put(c)
+
+	return nil
+}
+
+func (m *SMTPMailer) send(c *smtpConn, to string, message []byte) error {
+	c.conn.SetDeadline(time.Now().Add(m.timeout))
+
+	err := c.client.Mail(m.composer.From.Address)
+
+	if err != nil {
+		return err
+	}
+
+	err = c.client.Rcpt(to)
+
+	if err != nil {
+		return err
+	}
+
+	writer, err := c.client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(message)
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// get returns an idle connection that still answers RSET, or a new one.
+func (m *SMTPMailer) get() (*smtpConn, error) {
+	for {
+		select {
+		case c := <-m.idle:
+			if time.Since(c.usedAt) > m.idleTimeout {
+				c.client.Quit()
+				continue
+			}
+
+			c.conn.SetDeadline(time.Now().Add(m.timeout))
+
+			if c.client.Reset() == nil {
+				return c, nil
+			}
+
+			c.client.Close()
+		default:
+			return m.dial()
+		}
+	}
+}
+
+// put keeps the connection for the next email unless the pool is full.
+func (m *SMTPMailer) put(c *smtpConn) {
+	c.usedAt = time.Now()
+
+	select {
+	case m.idle <- c:
+	default:
+		c.client.Quit()
+	}
+}
+
+// dial connects and authenticates. STARTTLS is required in its mode, the
+// connection never falls back to plain text.
+func (m *SMTPMailer) dial() (*smtpConn, error) {
+	dialer := &net.Dialer{Timeout: m.timeout}
+
+	var conn net.Conn
+	var err error
+
+	if m.tlsMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.addr, m.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", m.addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(m.timeout))
+
+	client, err := smtp.NewClient(conn, m.host)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = m.handshake(client)
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+func (m *SMTPMailer) handshake(client *smtp.Client) error {
+	if m.tlsMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrNoStartTLS
+		}
+
+		err := client.StartTLS(m.tlsConfig)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.password == "" {
+		return nil
+	}
+
+	return client.Auth(smtp.PlainAuth("", m.composer.From.Address, m.password, m.host))
+}
@@ -0,0 +1,319 @@
+package mailer
+
+import (
+	"DiaSync/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts every email except to reject, recording what it got.
+type fakeSMTP struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+	reject    string
+
+	mu          sync.Mutex
+	connections int
+	messages    []fakeMessage
+}
+
+type fakeMessage struct {
+	from, to string
+	tls      bool
+	authed   bool
+	data     []byte
+}
+
+// newFakeSMTP listens with implicit TLS or in plain text, offering STARTTLS
+// if startTLS is set. caFile is the certificate to trust.
+func newFakeSMTP(t *testing.T, implicit, startTLS bool) (server *fakeSMTP, caFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+
+	server = &fakeSMTP{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		startTLS:  startTLS,
+	}
+
+	if implicit {
+		server.listener, err = tls.Listen("tcp", "127.0.0.1:0", server.tlsConfig)
+	} else {
+		server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { server.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := server.listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			server.mu.Lock()
+			server.connections++
+			server.mu.Unlock()
+
+			go server.handle(conn, implicit)
+		}
+	}()
+
+	return server, caFile
+}
+
+func (s *fakeSMTP) handle(conn net.Conn, isTLS bool) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+
+	var message fakeMessage
+
+	for {
+		line, err := text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		command, argument, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+
+			if s.startTLS && !isTLS {
+				text.PrintfLine("250-STARTTLS")
+			}
+
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+
+			if tlsConn.Handshake() != nil {
+				return
+			}
+
+			conn, isTLS = tlsConn, true
+			text = textproto.NewConn(tlsConn)
+		case "AUTH":
+			message.authed = true
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.from = argument
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			if strings.Contains(argument, s.reject) && s.reject != "" {
+				text.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+
+			message.to = argument
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			message.data, err = text.ReadDotBytes()
+
+			if err != nil {
+				return
+			}
+
+			message.tls = isTLS
+
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+
+			message = fakeMessage{authed: message.authed}
+			text.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() (int, []fakeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections, append([]fakeMessage(nil), s.messages...)
+}
+
+func newTestSMTPMailer(t *testing.T, server *fakeSMTP, cfg config.Email) *SMTPMailer {
+	cfg.Sender = "noreply@diasync.ru"
+	cfg.AppPassword = "app password"
+	cfg.SmtpServer = "localhost"
+	cfg.SmtpAdr = server.listener.Addr().String()
+	cfg.Timeout = 5
+
+	composer, err := NewComposer(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smtpMailer, err := NewSMTPMailer(cfg, composer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return smtpMailer
+}
+
+var testEmail = Email{To: "dmitrkozyrev2@gmail.com", Subject: "Confirm your email", Text: "Text\n.\nend",
+	HTML: "<p>Text</p>"}
+
+func TestSMTPMailer_StartTLS(t *testing.T) {
+	server, caFile := newFakeSMTP(t, false, true)
+	smtpMailer := newTestSMTPMailer(t, server, config.Email{TLSCAFile: caFile})
+
+	for range 3 {
+		if err := smtpMailer.Send(testEmail); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connections, messages := server.received()
+
+	if connections != 1 || len(messages) != 3 {
+		t.Fatalf("got %d messages over %d connections, want 3 over 1", len(messages), connections)
+	}
+
+	message := messages[0]
+
+	if !message.tls || !message.authed || message.from != "FROM:<noreply@diasync.ru>" ||
+		message.to != "TO:<dmitrkozyrev2@gmail.com>" {
+		t.Errorf("got %+v", message)
+	}
+
+	if !strings.Contains(string(message.data), "Text\n.\nend") {
+		t.Errorf("body lost the dot line: %s", message.data)
+	}
+}
+
+func TestSMTPMailer_ImplicitTLS(t *testing.T) {
+	server, caFile := newFakeSMTP(t, true, false)
+	smtpMailer := newTestSMTPMailer(t, server, config.Email{TLS: TLSImplicit, TLSCAFile: caFile})
+
+	if err := smtpMailer.Send(testEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, messages := server.received(); len(messages) != 1 || !messages[0].tls {
+		t.Errorf("got %+v", messages)
+	}
+}
+
+func TestSMTPMailer_Verification(t *testing.T) {
+	server, _ := newFakeSMTP(t, true, false)
+
+	err := newTestSMTPMailer(t, server, config.Email{TLS: TLSImplicit}).Send(testEmail)
+
+	var unknownAuthority x509.UnknownAuthorityError
+
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("got %v, want an untrusted certificate", err)
+	}
+
+	err = newTestSMTPMailer(t, server, config.Email{TLS: TLSImplicit, TLSSkipVerify: true}).Send(testEmail)
+
+	if err != nil {
+		t.Errorf("got %v with verification skipped", err)
+	}
+}
+
+func TestSMTPMailer_NoStartTLS(t *testing.T) {
+	server, _ := newFakeSMTP(t, false, false)
+
+	if err := newTestSMTPMailer(t, server, config.Email{}).Send(testEmail); err != ErrNoStartTLS {
+		t.Errorf("got %v, want %v", err, ErrNoStartTLS)
+	}
+
+	if _, messages := server.received(); len(messages) != 0 {
+		t.Errorf("sent %d messages in plain text", len(messages))
+	}
+}
+
+func TestSMTPMailer_ReconnectsAfterError(t *testing.T) {
+	server, caFile := newFakeSMTP(t, false, true)
+	server.reject = "bounce@mail.com"
+	smtpMailer := newTestSMTPMailer(t, server, config.Email{TLSCAFile: caFile})
+
+	if err := smtpMailer.Send(Email{To: "bounce@mail.com"}); err == nil {
+		t.Fatal("got no error for a rejected recipient")
+	}
+
+	if err := smtpMailer.Send(testEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	if connections, messages := server.received(); connections != 2 || len(messages) != 1 {
+		t.Errorf("got %d messages over %d connections, want 1 over 2", len(messages), connections)
+	}
+}
+
+func TestSMTPMailer_IdleTimeout(t *testing.T) {
+	server, caFile := newFakeSMTP(t, false, true)
+	smtpMailer := newTestSMTPMailer(t, server, config.Email{TLSCAFile: caFile})
+	smtpMailer.idleTimeout = time.Nanosecond
+
+	for range 2 {
+		if err := smtpMailer.Send(testEmail); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if connections, _ := server.received(); connections != 2 {
+		t.Errorf("got %d connections, want a new one after the idle timeout", connections)
+	}
+}
+
+func TestNewSMTPMailer_UnknownTLSMode(t *testing.T) {
+	if _, err := NewSMTPMailer(config.Email{TLS: "ssl"}, Composer{}); err != ErrUnknownTLSMode {
+		t.Errorf("got %v, want %v", err, ErrUnknownTLSMode)
+	}
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateInvitation    = "invitation"
+	TemplateMagicLink     = "magic_link"
+	TemplateSignupAttempt = "signup_attempt"
+	TemplateEmailChange   = "email_change"
+	TemplateEmailChanged  = "email_changed"
+	TemplateSecurityAlert = "security_alert"
+)
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// notifications tell about something the recipient didn't ask for. Security
+// mail, like the email change with its undo link, must not be unsubscribed
+// from and isn't one.
+var notifications = map[string]bool{
+	TemplateSignupAttempt: true,
+}
+
+// Data fills the templates, each one uses only the fields it needs. Event is
+// the type of the security event a security alert tells about.
+type Data struct {
+	Link   string
+	Code   string
+	Role   string
+	Email  string
+	Event  string
+	Device string
+	IP     string
+	Time   string
+}
+
+// Every templates/<locale>/<name>.tmpl defines "subject", "text" and "body".
+// The HTML part is the "body" inside the "html" layout of the locale.
+//
+//go:embed templates
+var templateFiles embed.FS
+
+type localizedTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = parseTemplates()
+
+func parseTemplates() map[string]map[string]localizedTemplate {
+	names := []string{TemplateVerifyEmail, TemplatePasswordReset, TemplateInvitation, TemplateMagicLink,
+		TemplateSignupAttempt, TemplateEmailChange, TemplateEmailChanged, TemplateSecurityAlert}
+
+	parsed := map[string]map[string]localizedTemplate{}
+
+	for _, locale := range Locales {
+		parsed[locale] = map[string]localizedTemplate{}
+		layout := "templates/" + locale + "/layout.tmpl"
+
+		for _, name := range names {
+			file := "templates/" + locale + "/" + name + ".tmpl"
+
+			parsed[locale][name] = localizedTemplate{
+				text: texttemplate.Must(texttemplate.ParseFS(templateFiles, file)),
+				html: htmltemplate.Must(htmltemplate.ParseFS(templateFiles, layout, file)),
+			}
+		}
+	}
+
+	return parsed
+}
+
+// Render returns the email of the template in the locale, the default locale
+// is used for an unsupported one. The recipient is left to the caller.
+func Render(name, locale string, data Data) (Email, error) {
+	template, ok := templates[MatchLocale(locale)][name]
+
+	if !ok {
+		return Email{}, ErrUnknownTemplate
+	}
+
+	var subject, text, html bytes.Buffer
+
+	err := template.text.ExecuteTemplate(&subject, "subject", data)
+
+	if err != nil {
+		return Email{}, err
+	}
+
+	err = template.text.ExecuteTemplate(&text, "text", data)
+
+	if err != nil {
+		return Email{}, err
+	}
+
+	err = template.html.ExecuteTemplate(&html, "html", data)
+
+	if err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		Subject:      strings.TrimSpace(subject.String()),
+		Text:         strings.TrimSpace(text.String()) + "\n",
+		HTML:         html.String(),
+		Notification: notifications[name],
+	}, nil
+}
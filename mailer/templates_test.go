@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := Data{Link: "http://localhost/auth/verify?token=abc", Code: "123456", Role: "clinician",
+		Email: "dmitrkozyrev2@gmail.com"}
+
+	for _, locale := range Locales {
+		for name := range templates[locale] {
+			t.Run(locale+" "+name, func(t *testing.T) {
+				email, err := Render(name, locale, data)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if email.Subject == "" || strings.Contains(email.Subject, "\n") {
+					t.Errorf("bad subject %q", email.Subject)
+				}
+
+				if email.Text == "" || !strings.Contains(email.HTML, "<title>"+email.Subject+"</title>") {
+					t.Errorf("got text %q html %q", email.Text, email.HTML)
+				}
+
+				if strings.Contains(email.Text, "<no value>") || strings.Contains(email.HTML, "<no value>") {
+					t.Error("template uses a missing field")
+				}
+			})
+		}
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	data := Data{Link: "http://localhost/auth/verify-email?token=abc"}
+
+	english, _ := Render(TemplateVerifyEmail, "en-US", data)
+	russian, _ := Render(TemplateVerifyEmail, "ru", data)
+	fallback, _ := Render(TemplateVerifyEmail, "de", data)
+
+	if english.Subject != "Confirm your email" || russian.Subject != "Подтвердите email" {
+		t.Errorf("got %q and %q", english.Subject, russian.Subject)
+	}
+
+	if fallback.Subject != russian.Subject {
+		t.Errorf("got %q, want the default locale", fallback.Subject)
+	}
+
+	if !strings.Contains(english.Text, data.Link) || !strings.Contains(english.HTML, `href="`+data.Link+`"`) {
+		t.Errorf("link missing in %q", english.Text)
+	}
+
+	if _, err := Render("unknown", "en", data); err != ErrUnknownTemplate {
+		t.Errorf("got %v, want %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	email, err := Render(TemplateEmailChange, "en", Data{Link: "javascript:alert(1)", Email: "<b>x</b>@mail.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(email.HTML, "<b>x</b>") || strings.Contains(email.HTML, `href="javascript:`) {
+		t.Errorf("unescaped html %s", email.HTML)
+	}
+
+	if !strings.Contains(email.Text, "<b>x</b>@mail.com") {
+		t.Errorf("text part escaped: %s", email.Text)
+	}
+}
+
+func TestRenderSecurityAlert(t *testing.T) {
+	data := Data{Link: "http://localhost/auth/secure-account?token=abc", Event: "new_device",
+		Device: "Pixel 8 (android)", IP: "10.0.0.1", Time: "2024-05-01 10:00 UTC"}
+
+	email, err := Render(TemplateSecurityAlert, "en", data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Subject != "New sign-in to DiaSync" || email.Notification {
+		t.Errorf("got subject %q", email.Subject)
+	}
+
+	for _, expected := range []string{"new device", "Pixel 8 (android)", "10.0.0.1", data.Time, data.Link} {
+		if !strings.Contains(email.Text, expected) {
+			t.Errorf("text %q doesn't contain %q", email.Text, expected)
+		}
+	}
+
+	data.Event = "login_locked_out"
+	email, _ = Render(TemplateSecurityAlert, "ru", data)
+
+	if email.Subject != "Аккаунт DiaSync заблокирован" || !strings.Contains(email.Text, "неверных паролей") {
+		t.Errorf("got %q: %q", email.Subject, email.Text)
+	}
+
+	data.Event = "mfa_locked_out"
+	email, _ = Render(TemplateSecurityAlert, "en", data)
+
+	if email.Subject != "Your DiaSync account is locked" || !strings.Contains(email.Text, "two-factor codes") {
+		t.Errorf("got %q: %q", email.Subject, email.Text)
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	var testCases = []struct {
+		header   string
+		expected string
+	}{
+		{"en", "en"},
+		{"en-US", "en"},
+		{"RU-ru", "ru"},
+		{"de-DE,en;q=0.8,ru;q=0.5", "en"},
+		{"de", defaultLocale},
+		{"", defaultLocale},
+	}
+
+	for _, tt := range testCases {
+		if got := MatchLocale(tt.header); got != tt.expected {
+			t.Errorf("MatchLocale(%q) = %s, want %s", tt.header, got, tt.expected)
+		}
+	}
+}
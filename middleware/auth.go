@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"DiaSync/models"
+	"DiaSync/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const PrincipalKey = "principal"
+
+// TokenOwners returns the active user with the id from an access token. Tokens
+// issued with an older token version than the user's were revoked by a
+// password or role change.
+type TokenOwners interface {
+	TokenOwner(string) (models.User, error)
+}
+
+// RequireAuth rejects requests without a valid Bearer access token and stores
+// the token owner in the context for the handlers below.
+func RequireAuth(owners TokenOwners) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		header := context.GetHeader("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+
+		if !found || token == "" {
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+			return
+		}
+
+		principal, err := utils.ParseAccessToken(token)
+
+		if err != nil {
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+			return
+		}
+
+		user, err := owners.TokenOwner(principal.ID)
+
+		if err != nil || user.TokenVersion != principal.TokenVersion {
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+			return
+		}
+
+		principal.Email = user.Email
+
+		context.Set(PrincipalKey, principal)
+		context.Next()
+	}
+}
+
+// GetPrincipal returns the principal stored by RequireAuth.
+func GetPrincipal(context *gin.Context) (models.Principal, bool) {
+	value, exists := context.Get(PrincipalKey)
+
+	if !exists {
+		return models.Principal{}, false
+	}
+
+	principal, ok := value.(models.Principal)
+
+	return principal, ok
+}
+
+// RequirePermission must be mounted after RequireAuth.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal, ok := GetPrincipal(context)
+
+		if !ok {
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized"})
+			return
+		}
+
+		if !utils.HasPermission(principal.Role, permission) {
+			context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "forbidden"})
+			return
+		}
+
+		context.Next()
+	}
+}
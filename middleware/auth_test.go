@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"DiaSync/config"
+	"DiaSync/models"
+	"DiaSync/utils"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenOwners map[string]models.User
+
+func (o tokenOwners) TokenOwner(userID string) (models.User, error) {
+	user, ok := o[userID]
+
+	if !ok {
+		return models.User{}, errors.New("user not found")
+	}
+
+	return user, nil
+}
+
+func TestRequireAuth(t *testing.T) {
+	utils.InitToken(config.Token{
+		AccessExpire:      60,
+		RefreshExpire:     60,
+		VerifyEmailExpire: 60,
+		SecretKey:         "secret",
+	})
+
+	accessToken, _ := utils.GenerateAccessToken("U1", "viewer", "DDD", "SSS", 1)
+	revokedToken, _ := utils.GenerateAccessToken("U1", "viewer", "DDD", "SSS", 0)
+	unknownToken, _ := utils.GenerateAccessToken("U2", "viewer", "DDD", "SSS", 1)
+	emailToken, _ := utils.GenerateAccessToken("Dima", "viewer", "DDD", "SSS", 1)
+	refreshToken, _ := utils.GenerateRefreshToken()
+	inviteToken, _ := utils.GenerateInviteToken("Dima", "clinician")
+
+	var testCases = []struct {
+		name                string
+		header              string
+		expectedStatusCode  int
+		expectedRequestBody string
+	}{
+		{
+			name:                "OK",
+			header:              "Bearer " + accessToken,
+			expectedStatusCode:  200,
+			expectedRequestBody: `{"id":"U1","email":"Dima","role":"viewer","device_id":"DDD","session_id":"SSS"}`,
+		},
+		{
+			name:                "No header",
+			header:              "",
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "No bearer prefix",
+			header:              accessToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "Revoked token version",
+			header:              "Bearer " + revokedToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "Unknown user",
+			header:              "Bearer " + unknownToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "Email subject",
+			header:              "Bearer " + emailToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "Refresh token",
+			header:              "Bearer " + refreshToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+		{
+			name:                "Invite token",
+			header:              "Bearer " + inviteToken,
+			expectedStatusCode:  401,
+			expectedRequestBody: `{"message":"not authorized"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/me", RequireAuth(tokenOwners{"U1": {ID: "U1", Email: "Dima", TokenVersion: 1}}), func(context *gin.Context) {
+				principal, _ := GetPrincipal(context)
+				context.JSON(http.StatusOK, principal)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if tt.expectedRequestBody != w.Body.String() {
+				t.Errorf("got = %s expected = %s", w.Body.String(), tt.expectedRequestBody)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	var testCases = []struct {
+		name               string
+		role               string
+		permission         string
+		expectedStatusCode int
+	}{
+		{"Patient reads readings", utils.RolePatient, utils.PermReadingsRead, 200},
+		{"Caregiver writes readings", utils.RoleCaregiver, utils.PermReadingsWrite, 403},
+		{"Clinician manages users", utils.RoleClinician, utils.PermUsersManage, 403},
+		{"Admin manages users", utils.RoleAdmin, utils.PermUsersManage, 200},
+		{"Unknown role", "viewer", utils.PermReadingsRead, 403},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/resource", func(context *gin.Context) {
+				context.Set(PrincipalKey, models.Principal{Email: "Dima", Role: tt.role})
+			}, RequirePermission(tt.permission), func(context *gin.Context) {
+				context.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/resource", nil)
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+		})
+	}
+}
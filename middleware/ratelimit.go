@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"DiaSync/config"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLimitedBody caps how much of the body is read to find the email and the
+// device id.
+const maxLimitedBody = 1 << 16
+
+// RateLimiter takes a token from the bucket of the key. If there is none, it
+// returns how long until the next one.
+type RateLimiter interface {
+	Allow(key string, limit config.Limit) (bool, time.Duration, error)
+}
+
+// defaultRouteLimits apply to routes missing in the rate_limit config. Routes
+// that send email are limited per address for an hour, so they can't be used
+// to spam a mailbox.
+var defaultRouteLimits = map[string]config.RouteLimit{
+	"/auth/login": {
+		IP:     config.Limit{Requests: 30, Period: 60},
+		Email:  config.Limit{Requests: 10, Period: 60},
+		Device: config.Limit{Requests: 10, Period: 60},
+	},
+	"/auth/reset-password": {
+		IP:    config.Limit{Requests: 10, Period: 60},
+		Email: config.Limit{Requests: 3, Period: 3600},
+	},
+	"/auth/repeat-verify-email": {
+		IP:    config.Limit{Requests: 10, Period: 60},
+		Email: config.Limit{Requests: 3, Period: 3600},
+	},
+	"/auth/magic-link": {
+		IP:    config.Limit{Requests: 10, Period: 60},
+		Email: config.Limit{Requests: 5, Period: 3600},
+	},
+	"/auth/oidc/nonce": {
+		IP: config.Limit{Requests: 10, Period: 60},
+	},
+	"/me/email": {
+		IP: config.Limit{Requests: 5, Period: 3600},
+	},
+}
+
+var defaultRouteLimit = config.RouteLimit{IP: config.Limit{Requests: 30, Period: 60}}
+
+// RateLimit rejects requests to the route with 429 once the client IP, the
+// email or the device id in the JSON body ran out of requests. The limits of
+// cfg replace the default ones of the route.
+func RateLimit(limiter RateLimiter, route string, cfg config.RateLimit) gin.HandlerFunc {
+	limit, ok := cfg.Routes[route]
+
+	if !ok {
+		limit, ok = defaultRouteLimits[route]
+	}
+
+	if !ok {
+		limit = defaultRouteLimit
+	}
+
+	for _, l := range []config.Limit{limit.IP, limit.Email, limit.Device} {
+		if l.Requests != 0 && l.Period <= 0 {
+			panic("Rate limit of " + route + " has no period")
+		}
+	}
+
+	return func(context *gin.Context) {
+		email, deviceID := limitedBodyKeys(context)
+
+		keys := []struct {
+			value string
+			limit config.Limit
+		}{
+			{"ip:" + context.ClientIP(), limit.IP},
+			{"email:" + email, limit.Email},
+			{"device:" + deviceID, limit.Device},
+		}
+
+		for _, key := range keys {
+			if key.limit.Requests == 0 || strings.HasSuffix(key.value, ":") {
+				continue
+			}
+
+			allowed, retryAfter, err := limiter.Allow(route+" "+key.value, key.limit)
+
+			// the limiter being down must not take the login down with it
+			if err != nil {
+				continue
+			}
+
+			if !allowed {
+				TooManyRequests(context, retryAfter, "too many requests")
+				return
+			}
+		}
+
+		context.Next()
+	}
+}
+
+// limitedBodyKeys reads the email and the device id from the JSON body and
+// puts the body back for the handler.
+func limitedBodyKeys(context *gin.Context) (string, string) {
+	if context.Request.Body == nil {
+		return "", ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(context.Request.Body, maxLimitedBody))
+
+	if err != nil {
+		return "", ""
+	}
+
+	context.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), context.Request.Body))
+
+	var request struct {
+		Email    string
+		DeviceID string `json:"device_id"`
+	}
+
+	json.Unmarshal(body, &request)
+
+	return strings.ToLower(strings.TrimSpace(request.Email)), request.DeviceID
+}
+
+// TooManyRequests aborts with 429, telling the client in Retry-After how many
+// seconds to wait.
+func TooManyRequests(context *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	context.Header("Retry-After", strconv.Itoa(seconds))
+	context.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": message})
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// MemoryRateLimiter keeps token buckets in the process. The limits aren't
+// shared between instances, see repository.RateLimitRepository.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+func (l *MemoryRateLimiter) Allow(key string, limit config.Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	capacity := float64(limit.Requests)
+	rate := capacity / (limit.Period * time.Second).Seconds()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+
+	if allowed {
+		b.tokens--
+	}
+
+	b.fullAt = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+
+	if allowed {
+		return true, 0, nil
+	}
+
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+}
+
+// sweep drops the buckets that are full again once a minute, they are
+// recreated full when needed.
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if !now.Before(b.fullAt) {
+			delete(l.buckets, key)
+		}
+	}
+}
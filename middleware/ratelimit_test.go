@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"DiaSync/config"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestMemoryRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter := NewMemoryRateLimiter()
+	limiter.now = clock.Now
+
+	limit := config.Limit{Requests: 3, Period: 60}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := limiter.Allow("key", limit); !allowed {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+
+	allowed, retryAfter, _ := limiter.Allow("key", limit)
+
+	if allowed || retryAfter != 20*time.Second {
+		t.Errorf("got %v %v, want rejection for 20s", allowed, retryAfter)
+	}
+
+	if allowed, _, _ := limiter.Allow("other", limit); !allowed {
+		t.Error("keys share a bucket")
+	}
+
+	clock.now = clock.now.Add(20 * time.Second)
+
+	if allowed, _, _ := limiter.Allow("key", limit); !allowed {
+		t.Error("token not refilled")
+	}
+
+	if allowed, _, _ := limiter.Allow("key", limit); allowed {
+		t.Error("refilled more than one token")
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	limiter.Allow("key", limit)
+
+	if len(limiter.buckets) != 1 {
+		t.Errorf("got %d buckets, want full ones swept", len(limiter.buckets))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.RateLimit{Routes: map[string]config.RouteLimit{
+		"/auth/login": {
+			IP:     config.Limit{Requests: 10, Period: 60},
+			Email:  config.Limit{Requests: 2, Period: 60},
+			Device: config.Limit{Requests: 3, Period: 60},
+		},
+	}}
+
+	r := gin.New()
+	r.POST("/auth/login", RateLimit(NewMemoryRateLimiter(), "/auth/login", cfg), func(context *gin.Context) {
+		body, _ := io.ReadAll(context.Request.Body)
+		context.String(200, string(body))
+	})
+
+	var testCases = []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedRetryAfter string
+	}{
+		{"First", `{"email":"Dima", "device_id":"D1"}`, 200, ""},
+		{"Same email", `{"email":" dima ", "device_id":"D2"}`, 200, ""},
+		{"Email limit", `{"email":"DIMA", "device_id":"D3"}`, 429, "30"},
+		{"Other email", `{"email":"Roma", "device_id":"D1"}`, 200, ""},
+		{"Device limit", `{"email":"Kolya", "device_id":"D1"}`, 200, ""},
+		{"Device exhausted", `{"email":"Petya", "device_id":"D1"}`, 429, "20"},
+		{"No email", `{}`, 200, ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/login", bytes.NewBufferString(tt.body))
+
+			r.ServeHTTP(w, req)
+
+			if tt.expectedStatusCode != w.Code {
+				t.Errorf("got = %d expected = %d", w.Code, tt.expectedStatusCode)
+			}
+
+			if w.Code == 200 && w.Body.String() != tt.body {
+				t.Errorf("handler got body %s, want %s", w.Body.String(), tt.body)
+			}
+
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.expectedRetryAfter {
+				t.Errorf("got Retry-After %q, want %q", retryAfter, tt.expectedRetryAfter)
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package models
 
+import "encoding/json"
+
 type LoginR struct {
-	Email    string `binding:"required"`
-	Password string `binding:"required"`
-	DeviceID string `json:"device_id" binding:"required"`
-	Role     string `json:"omitempty"`
+	Email      string `binding:"required"`
+	Password   string `binding:"required"`
+	DeviceID   string `json:"device_id" binding:"required"`
+	DeviceName string `json:"device_name"`
+	Platform   string `json:"platform"`
+	Role       string `json:"omitempty"`
+	IP         string `json:"-"`
+	UserAgent  string `json:"-"`
 }
 
 type LogoutR struct {
@@ -14,13 +20,155 @@ type LogoutR struct {
 type ReplacementTokensR struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 	DeviceID     string `json:"device_id" binding:"required"`
+	IP           string `json:"-"`
+	UserAgent    string `json:"-"`
 }
 
 type ResetPasswordR struct {
-	Email       string `binding:"required"`
+	Email string `binding:"required"`
+}
+
+type NewPasswordR struct {
+	Token       string `json:"token" binding:"required"`
 	NewPassword string `json:"new_password" binding:"required"`
 }
 
 type RepeatEmailVerifyR struct {
 	Email string `binding:"required"`
 }
+
+type ChangePasswordR struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailR struct {
+	NewEmail string `json:"new_email" binding:"required"`
+	Password string `binding:"required"`
+}
+
+// Principal is the owner of an access token. The token only carries the id,
+// Email is filled in from the user when the token is checked.
+type Principal struct {
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	DeviceID     string `json:"device_id"`
+	SessionID    string `json:"session_id"`
+	TokenVersion int    `json:"-"`
+}
+
+type ChangeRoleR struct {
+	Email string `binding:"required"`
+	Role  string `binding:"required"`
+}
+
+type InvitationR struct {
+	Email  string `binding:"required"`
+	Role   string `binding:"required"`
+	Locale string `json:"locale"`
+}
+
+type LockUserR struct {
+	Email string `binding:"required"`
+}
+
+// LoginResult holds the issued tokens or, when a second factor is needed,
+// the MFA challenge token to complete the login with. Recovery codes are
+// only set when MFA enrollment was completed during the login.
+type LoginResult struct {
+	AccessToken   string   `json:"access_token,omitempty"`
+	RefreshToken  string   `json:"refresh_token,omitempty"`
+	MFAToken      string   `json:"mfa_token,omitempty"`
+	MFAEnrollment bool     `json:"mfa_enrollment_required,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type LoginMFAR struct {
+	MFAToken  string `json:"mfa_token" binding:"required"`
+	Code      string `binding:"required"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+type MFAChallengeR struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type MFACodeR struct {
+	Code string `binding:"required"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// WebAuthnOptions starts a passkey ceremony. Options is passed as is to
+// navigator.credentials.create or get, the challenge id is sent back with
+// the authenticator response.
+type WebAuthnOptions struct {
+	ChallengeID string          `json:"challenge_id"`
+	Options     json.RawMessage `json:"options"`
+}
+
+type PasskeyRegistrationR struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Name        string          `json:"name"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type PasskeyLoginBeginR struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkR struct {
+	Email    string `binding:"required"`
+	DeviceID string `json:"device_id" binding:"required"`
+}
+
+// MagicLinkLoginR carries either the token from the link or the email and
+// the code from the same message.
+type MagicLinkLoginR struct {
+	Token      string `json:"token"`
+	Email      string `json:"email"`
+	Code       string `json:"code"`
+	DeviceID   string `json:"device_id" binding:"required"`
+	DeviceName string `json:"device_name"`
+	Platform   string `json:"platform"`
+	IP         string `json:"-"`
+	UserAgent  string `json:"-"`
+}
+
+// OIDCNonce is passed to the provider when the app requests an ID token, the
+// token is only accepted with a nonce issued by the server.
+type OIDCNonce struct {
+	Nonce string `json:"nonce"`
+}
+
+type OIDCLoginR struct {
+	Provider   string `json:"provider" binding:"required"`
+	IDToken    string `json:"id_token" binding:"required"`
+	Nonce      string `json:"nonce" binding:"required"`
+	DeviceID   string `json:"device_id" binding:"required"`
+	DeviceName string `json:"device_name"`
+	Platform   string `json:"platform"`
+	IP         string `json:"-"`
+	UserAgent  string `json:"-"`
+}
+
+type LinkIdentityR struct {
+	Provider string `json:"provider" binding:"required"`
+	IDToken  string `json:"id_token" binding:"required"`
+	Nonce    string `json:"nonce" binding:"required"`
+}
+
+type PasskeyLoginR struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+	DeviceID    string          `json:"device_id" binding:"required"`
+	DeviceName  string          `json:"device_name"`
+	Platform    string          `json:"platform"`
+	IP          string          `json:"-"`
+	UserAgent   string          `json:"-"`
+}
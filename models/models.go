@@ -1,13 +1,130 @@
 package models
 
+import "time"
+
+// User.LockedUntil is set after too many failed logins, unlike Locked it
+// expires on its own. Locale is the language of the emails, empty for the
+// default one.
 type User struct {
-	Email    string `binding:"required"`
-	Password string `binding:"required"`
-	Role     string `binding:"required"`
+	ID             string `json:"-"`
+	Email          string `binding:"required"`
+	Password       string `binding:"required"`
+	Role           string
+	InviteToken    string     `json:"invite_token"`
+	Locale         string     `json:"locale"`
+	Verified       bool       `json:"-"`
+	Locked         bool       `json:"-"`
+	TokenVersion   int        `json:"-"`
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"-"`
 }
 
 type Session struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
-	UserEmail    string `json:"user_email" binding:"required"`
-	DeviceID     string `json:"device_id" binding:"required"`
+	RefreshToken string     `json:"refresh_token" binding:"required"`
+	Selector     string     `json:"-"`
+	VerifierHash string     `json:"-"`
+	UserID       string     `json:"user_id" binding:"required"`
+	DeviceID     string     `json:"device_id" binding:"required"`
+	DeviceName   string     `json:"device_name"`
+	Platform     string     `json:"platform"`
+	IP           string     `json:"ip"`
+	UserAgent    string     `json:"user_agent"`
+	FamilyID     string     `json:"family_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	IssuedAt     time.Time  `json:"issued_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RotatedAt    *time.Time `json:"rotated_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+type Device struct {
+	ID        string
+	Name      string
+	Platform  string
+	IP        string
+	UserAgent string
+}
+
+// OutboxEmail is a rendered email waiting for delivery. Attempts counts the
+// deliveries started, DeadAt is set once the last one failed. Admins don't
+// see the body, it holds sign in links.
+type OutboxEmail struct {
+	ID            int64      `json:"id"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Text          string     `json:"-"`
+	HTML          string     `json:"-"`
+	Notification  bool       `json:"notification"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	DeadAt        *time.Time `json:"dead_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// SessionInfo is a signed in device as shown to the user. ID is the refresh
+// token family, it doesn't change when tokens are rotated.
+type SessionInfo struct {
+	ID         string     `json:"id"`
+	DeviceID   string     `json:"device_id"`
+	DeviceName string     `json:"device_name"`
+	Platform   string     `json:"platform"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Current    bool       `json:"current"`
+}
+
+// MFA is the second factor of a user. The TOTP secret is stored when
+// enrollment starts and only enforced once ConfirmedAt is set. LastUsedStep
+// is the last accepted TOTP time step, codes for it or earlier are rejected.
+type MFA struct {
+	UserID         string
+	TOTPSecret     string
+	ConfirmedAt    *time.Time
+	LastUsedStep   int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// WebAuthnCredential is a registered passkey. UserHandle is the random user
+// id given to the authenticator, it is the same for every passkey of a user.
+type WebAuthnCredential struct {
+	ID              []byte
+	UserHandle      []byte
+	UserID          string
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+// WebAuthnChallenge keeps the server side of a started ceremony until the
+// client finishes it. UserID is empty for a login with any passkey.
+type WebAuthnChallenge struct {
+	ID          string
+	UserID      string
+	Ceremony    string
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
+// Identity links an Apple or Google account to a user. Subject is the
+// provider's stable user id, Email is the address the provider reported and
+// may differ from the user's.
+type Identity struct {
+	Provider   string     `json:"provider"`
+	Subject    string     `json:"-"`
+	UserID     string     `json:"-"`
+	Email      string     `json:"email"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
@@ -5,17 +5,85 @@ import (
 	"DiaSync/utils"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSessionRotated     = errors.New("session already rotated")
+	ErrAccountLocked      = errors.New("account locked")
+	ErrLockedOut          = errors.New("too many failed logins")
+	ErrLockoutStarted     = errors.New("failed login started a lockout")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrMFAEnabled         = errors.New("mfa already enabled")
+	ErrMFACodeUsed        = errors.New("mfa code already used")
+	ErrSignCountUsed      = errors.New("passkey sign count already used")
+	ErrIdentityExists     = errors.New("identity already exists")
+	ErrEmailExists        = errors.New("email already exists")
+	ErrMagicLinkExhausted = errors.New("magic link attempts exhausted")
 )
 
 type Authorization interface {
-	ValidateCredentials(string, string) (string, error)
-	CreateSession(string, string, string) error
-	GenerateTokens(string, string, string) (string, string, error)
+	ValidateCredentials(string, string) (models.User, error)
+	CreateSession(models.Session) error
+	GenerateTokens(models.User, models.Device) (string, string, error)
+	AddDevice(string, string) (bool, error)
+	RotateTokens(models.Session, models.User) (string, string, error)
 	FindSession(string) (models.Session, error)
-	DeleteRefreshToken(string) error
+	ListSessions(string) ([]models.Session, error)
+	DeleteUserSession(string, string) error
+	DeleteOtherSessions(string, string) error
+	DeleteSessionFamily(string) error
+	RevokeSessionFamily(string) error
+	AddSecurityEvent(string, string, string) error
 	FindUser(string) (models.User, error)
+	FindUserByID(string) (models.User, error)
+	CreateOneTimeToken(*sql.Tx, string, string) (string, error)
+	OneTimeTokenEmail(string, string) (string, error)
+	CreateEmailChangeToken(*sql.Tx, string, string) (string, error)
+	ConfirmEmailChange(*sql.Tx, string) (models.User, string, string, error)
+	UndoEmailChange(string) (string, error)
+	SecureAccount(string) (string, error)
 	VerifyEmail(string) error
+	ResetPassword(string, string) error
 	SetPassword(string, string) error
+	ChangePassword(string, string) error
+	ChangeRole(string, string) error
+	LockUser(string) error
+	UnlockUser(string) error
+	FindMFA(string) (models.MFA, error)
+	UseMFAChallenge(string, time.Time) (int, error)
+	RecordFailedMFA(string) (bool, error)
+	ResetFailedMFA(string) error
+	StartTOTPEnrollment(string, string) error
+	ConfirmMFA(string, int64, []string) error
+	UseTOTPStep(string, int64) error
+	UseRecoveryCode(string, string) error
+	ReplaceRecoveryCodes(string, []string) error
+	DisableMFA(string) error
+	CreateWebAuthnChallenge(models.WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(string, string) (models.WebAuthnChallenge, error)
+	CreateWebAuthnCredential(models.WebAuthnCredential) error
+	FindWebAuthnCredential([]byte) (models.WebAuthnCredential, error)
+	ListWebAuthnCredentials(string) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(models.WebAuthnCredential) error
+	CreateMagicLink(*sql.Tx, string, string) (string, string, error)
+	ConsumeMagicLink(string, string) (string, error)
+	ConsumeMagicLinkCode(string, string, string) (string, error)
+	FindIdentity(string, string) (models.Identity, error)
+	ListIdentities(string) ([]models.Identity, error)
+	CreateIdentity(models.Identity) error
+	CreateIdentityUser(models.User, models.Identity) (string, error)
+	UseIdentity(string, string) error
+	DeleteIdentity(string, string) error
+	CreateOIDCNonce(string, time.Time) error
+	ConsumeOIDCNonce(string) error
+	QueueEmail(*sql.Tx, models.OutboxEmail) error
+	ClaimEmails(int, time.Time) ([]models.OutboxEmail, error)
+	MarkEmailSent(int64) error
+	FailEmail(int64, string, time.Time, bool) error
+	ListFailedEmails() ([]models.OutboxEmail, error)
+	RetryEmail(int64) error
 	BeginTx() (*sql.Tx, error)
 }
 
@@ -31,84 +99,1395 @@ func (s *AuthRepository) BeginTx() (*sql.Tx, error) {
 	return s.db.Begin()
 }
 
-func (s *AuthRepository) ValidateCredentials(email, password string) (string, error) {
-	row := s.db.QueryRow("SELECT password, role FROM Users WHERE email = $1;", email)
+// ValidateCredentials doesn't check the password while the user is locked out
+// after too many failed attempts. ErrLockedOut is returned with the user, so
+// the caller can tell when the lockout ends. ErrLockoutStarted is returned
+// with the user for the wrong password that locked the user out. An unknown
+// email is reported as a wrong password, after comparing a dummy hash to take
+// the same time.
+func (s *AuthRepository) ValidateCredentials(email, password string) (models.User, error) {
+	user, err := s.FindUser(email)
 
-	var retrievedPassword, retrievedRole string
-	err := row.Scan(&retrievedPassword, &retrievedRole)
+	if err == sql.ErrNoRows {
+		utils.CompareDummyHash(password)
+		return models.User{}, ErrInvalidCredentials
+	}
 
 	if err != nil {
-		return "", err
+		return models.User{}, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		utils.CompareDummyHash(password)
+		return user, ErrLockedOut
+	}
+
+	if user.Password == "" {
+		// signed up with an identity provider and never set a password
+		utils.CompareDummyHash(password)
 	}
 
-	passwordIsValid := utils.CheckPasswordHash(password, retrievedPassword)
+	passwordIsValid := utils.CheckPasswordHash(password, user.Password)
 
 	if !passwordIsValid {
-		return "", errors.New("credential invalid")
+		started, err := s.recordFailedLogin(user.ID)
+
+		if err != nil {
+			return models.User{}, err
+		}
+
+		if started {
+			return user, ErrLockoutStarted
+		}
+
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if user.Locked {
+		return models.User{}, ErrAccountLocked
+	}
+
+	if user.FailedAttempts > 0 {
+		_, err = s.db.Exec("UPDATE Users SET failed_attempts=0, locked_until=NULL WHERE id=$1", user.ID)
+
+		if err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if utils.NeedsRehash(user.Password) {
+		s.upgradePasswordHash(user.ID, password)
+	}
+
+	return user, nil
+}
+
+// recordFailedLogin counts the failure and locks password logins for as long
+// as the count calls for. GREATEST keeps the longer lockout when concurrent
+// failures finish out of order. It reports whether this failure was the first
+// one to lock the user out.
+func (s *AuthRepository) recordFailedLogin(userID string) (bool, error) {
+	var failedAttempts int
+
+	err := s.db.QueryRow(`UPDATE Users SET failed_attempts = failed_attempts + 1
+		WHERE id = $1 RETURNING failed_attempts;`, userID).Scan(&failedAttempts)
+
+	if err != nil {
+		return false, err
+	}
+
+	delay := utils.LockoutDelay(failedAttempts)
+
+	if delay == 0 {
+		return false, nil
+	}
+
+	_, err = s.db.Exec("UPDATE Users SET locked_until = GREATEST(locked_until, $2) WHERE id = $1;",
+		userID, time.Now().Add(delay))
+
+	if err != nil {
+		return false, err
 	}
 
-	return retrievedRole, nil
+	return utils.LockoutDelay(failedAttempts-1) == 0, nil
 }
 
-func (s *AuthRepository) CreateSession(refresh_token, user_email, deviceID string) error {
-	_, err := s.db.Exec("INSERT INTO sessions (refresh_token, user_email, deviceID) VALUES($1, $2, $3)", refresh_token, user_email, deviceID)
+// upgradePasswordHash replaces a legacy or outdated hash after a successful
+// login. A failure here must not block the login, the old hash stays valid.
+func (s *AuthRepository) upgradePasswordHash(userID, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+
+	if err != nil {
+		return
+	}
+
+	s.SetPassword(userID, hashedPassword)
+}
+
+const insertSessionQuery = `INSERT INTO Sessions (selector, verifier_hash, user_id, deviceID, device_name, platform,
+	ip, user_agent, family_id, parent_selector, created_at, issued_at, last_used_at, expires_at)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $12, $13)`
+
+func sessionArgs(session models.Session, parentSelector string) []any {
+	return []any{session.Selector, session.VerifierHash, session.UserID, session.DeviceID, session.DeviceName,
+		session.Platform, session.IP, session.UserAgent, session.FamilyID, parentSelector, session.CreatedAt,
+		session.IssuedAt, session.ExpiresAt}
+}
+
+const selectSessionColumns = `selector, verifier_hash, user_id, deviceID, device_name, platform, ip, user_agent,
+	family_id, created_at, issued_at, expires_at, last_used_at, rotated_at, revoked_at FROM Sessions`
+
+func scanSession(row interface{ Scan(...any) error }) (models.Session, error) {
+	var session models.Session
+
+	err := row.Scan(&session.Selector, &session.VerifierHash, &session.UserID, &session.DeviceID,
+		&session.DeviceName, &session.Platform, &session.IP, &session.UserAgent, &session.FamilyID,
+		&session.CreatedAt, &session.IssuedAt, &session.ExpiresAt, &session.LastUsedAt, &session.RotatedAt,
+		&session.RevokedAt)
+
+	return session, err
+}
+
+func (s *AuthRepository) CreateSession(session models.Session) error {
+	_, err := s.db.Exec(insertSessionQuery, sessionArgs(session, "")...)
 
 	return err
 }
 
-func (s *AuthRepository) GenerateTokens(email, role, deviceID string) (string, string, error) {
-	access_token, err := utils.GenerateAccessToken(email, role)
+func newSession(userID string, device models.Device, familyID string, createdAt time.Time) (models.Session, error) {
+	refresh_token, err := utils.GenerateRefreshToken()
+
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	selector, verifier, err := utils.SplitRefreshToken(refresh_token)
+
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return models.Session{
+		RefreshToken: refresh_token,
+		Selector:     selector,
+		VerifierHash: utils.HashVerifier(verifier),
+		UserID:       userID,
+		DeviceID:     device.ID,
+		DeviceName:   device.Name,
+		Platform:     device.Platform,
+		IP:           device.IP,
+		UserAgent:    device.UserAgent,
+		FamilyID:     familyID,
+		CreatedAt:    createdAt,
+		IssuedAt:     time.Now(),
+		ExpiresAt:    utils.RefreshExpiresAt(),
+	}, nil
+}
+
+// GenerateTokens starts a new refresh token family for the device. The family
+// id is the session id shown to the user and carried in the access token.
+func (s *AuthRepository) GenerateTokens(user models.User, device models.Device) (string, string, error) {
+	familyID, err := utils.RandomString(16)
 
 	if err != nil {
 		return "", "", err
 	}
 
-	refresh_token, err := utils.GenerateRefreshToken()
+	access_token, err := utils.GenerateAccessToken(user.ID, user.Role, device.ID, familyID, user.TokenVersion)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	session, err := newSession(user.ID, device, familyID, time.Now())
+
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.CreateSession(session)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return access_token, session.RefreshToken, nil
+}
+
+// AddDevice remembers the device of the user and reports whether it is new.
+// Devices stay known after their sessions are deleted.
+func (s *AuthRepository) AddDevice(userID, deviceID string) (bool, error) {
+	result, err := s.db.Exec(`INSERT INTO user_devices (user_id, device_id) VALUES($1, $2)
+		ON CONFLICT DO NOTHING;`, userID, deviceID)
+
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+
+	return affected == 1, err
+}
+
+// RotateTokens marks the refresh token as used and issues its successor in
+// the same family. The rotated row is kept, so presenting it again can be
+// detected as reuse. ErrSessionRotated is returned if the token was already
+// rotated by a concurrent request. IP and user agent are taken from old, so
+// the caller can update them.
+func (s *AuthRepository) RotateTokens(old models.Session, user models.User) (string, string, error) {
+	access_token, err := utils.GenerateAccessToken(user.ID, user.Role, old.DeviceID, old.FamilyID, user.TokenVersion)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	device := models.Device{
+		ID:        old.DeviceID,
+		Name:      old.DeviceName,
+		Platform:  old.Platform,
+		IP:        old.IP,
+		UserAgent: old.UserAgent,
+	}
+
+	session, err := newSession(old.UserID, device, old.FamilyID, old.CreatedAt)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	tx, err := s.db.Begin()
 
 	if err != nil {
 		return "", "", err
 	}
 
-	err = s.CreateSession(refresh_token, email, deviceID)
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE Sessions SET rotated_at=$1
+		WHERE selector=$2 AND rotated_at IS NULL AND revoked_at IS NULL;`, session.IssuedAt, old.Selector)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if affected == 0 {
+		return "", "", ErrSessionRotated
+	}
+
+	_, err = tx.Exec(insertSessionQuery, sessionArgs(session, old.Selector)...)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	err = tx.Commit()
 
 	if err != nil {
 		return "", "", err
 	}
 
-	return access_token, refresh_token, nil
+	return access_token, session.RefreshToken, nil
 }
 
+// FindSession looks the session up by the token selector and checks the
+// verifier against the stored hash. A wrong verifier is reported as a missing
+// session.
 func (s *AuthRepository) FindSession(refresh_token string) (models.Session, error) {
-	row := s.db.QueryRow("SELECT * FROM Sessions WHERE refresh_token = $1;", refresh_token)
+	selector, verifier, err := utils.SplitRefreshToken(refresh_token)
 
-	var session models.Session
+	if err != nil {
+		return models.Session{}, sql.ErrNoRows
+	}
 
-	err := row.Scan(&session.RefreshToken, &session.UserEmail, &session.DeviceID)
+	row := s.db.QueryRow("SELECT "+selectSessionColumns+" WHERE selector = $1;", selector)
 
-	return session, err
+	session, err := scanSession(row)
+
+	if err != nil {
+		return session, err
+	}
+
+	if !utils.CheckVerifier(verifier, session.VerifierHash) {
+		return models.Session{}, sql.ErrNoRows
+	}
+
+	session.RefreshToken = refresh_token
+
+	return session, nil
+}
+
+// ListSessions returns the current token of every signed in device.
+func (s *AuthRepository) ListSessions(userID string) ([]models.Session, error) {
+	rows, err := s.db.Query("SELECT "+selectSessionColumns+`
+		WHERE user_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_used_at DESC;`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []models.Session{}
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession removes a session family only if it belongs to the user.
+func (s *AuthRepository) DeleteUserSession(userID, familyID string) error {
+	result, err := s.db.Exec("DELETE FROM Sessions WHERE user_id = $1 AND family_id = $2;", userID, familyID)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
 
-func (s *AuthRepository) DeleteRefreshToken(refresh_token string) error {
-	_, err := s.db.Exec("DELETE FROM Sessions WHERE refresh_token = $1;", refresh_token)
+func (s *AuthRepository) DeleteOtherSessions(userID, familyID string) error {
+	_, err := s.db.Exec("DELETE FROM Sessions WHERE user_id = $1 AND family_id <> $2;", userID, familyID)
 	return err
 }
 
-func (s *AuthRepository) FindUser(email string) (models.User, error) {
-	row := s.db.QueryRow("SELECT * FROM Users WHERE email = $1;", email)
+// DeleteSessionFamily removes the session and every token rotated from it.
+func (s *AuthRepository) DeleteSessionFamily(familyID string) error {
+	_, err := s.db.Exec("DELETE FROM Sessions WHERE family_id = $1;", familyID)
+	return err
+}
 
+// RevokeSessionFamily keeps the rows, so any further use of a token from the
+// family is still recognised.
+func (s *AuthRepository) RevokeSessionFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE Sessions SET revoked_at=now() WHERE family_id = $1 AND revoked_at IS NULL;", familyID)
+	return err
+}
+
+func (s *AuthRepository) AddSecurityEvent(userID, event, details string) error {
+	_, err := s.db.Exec("INSERT INTO security_events (user_id, event, details) VALUES($1, $2, $3)", userID, event,
+		details)
+	return err
+}
+
+const selectUserColumns = `id, email, password, role, verified, locked, token_version, failed_attempts,
+	locked_until, locale FROM Users`
+
+func scanUser(row *sql.Row) (models.User, error) {
 	var user models.User
-	var trash string
-	err := row.Scan(&user.Email, &user.Password, &user.Role, &trash)
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.Verified, &user.Locked, &user.TokenVersion,
+		&user.FailedAttempts, &user.LockedUntil, &user.Locale)
 
 	return user, err
 }
 
-func (s *AuthRepository) VerifyEmail(email string) error {
-	_, err := s.db.Exec("UPDATE Users SET verified=TRUE WHERE email=$1;", email)
-	return err
+// FindUser looks the user up by the email they sign in with.
+func (s *AuthRepository) FindUser(email string) (models.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+selectUserColumns+" WHERE email = $1;", email))
+}
+
+// FindUserByID looks the user up by the id carried in tokens. An id that
+// isn't a UUID, like the email subject of tokens issued before user ids,
+// fails the query.
+func (s *AuthRepository) FindUserByID(userID string) (models.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+selectUserColumns+" WHERE id = $1;", userID))
+}
+
+// CreateOneTimeToken stores the hash of a new token for an emailed link and
+// returns the token. It runs in the caller's transaction, so the token is
+// discarded if the email can't be sent.
+func (s *AuthRepository) CreateOneTimeToken(tx *sql.Tx, userID, purpose string) (string, error) {
+	return createOneTimeToken(tx, userID, purpose, "")
+}
+
+// CreateEmailChangeToken is CreateOneTimeToken for the link confirming the
+// new address of the user.
+func (s *AuthRepository) CreateEmailChangeToken(tx *sql.Tx, userID, newEmail string) (string, error) {
+	return createOneTimeToken(tx, userID, utils.EmailChangeTokenType, newEmail)
+}
+
+func createOneTimeToken(tx *sql.Tx, userID, purpose, email string) (string, error) {
+	token, tokenHash, err := utils.GenerateOneTimeToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`INSERT INTO one_time_tokens (token_hash, purpose, user_id, email, expires_at)
+		VALUES($1, $2, $3, $4, $5)`, tokenHash, purpose, userID, email,
+		utils.OneTimeTokenExpiresAt(purpose))
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// OneTimeTokenEmail returns the user of a valid token without consuming it.
+func (s *AuthRepository) OneTimeTokenEmail(token, purpose string) (string, error) {
+	var email string
+
+	err := s.db.QueryRow(`SELECT Users.email FROM one_time_tokens JOIN Users ON Users.id = one_time_tokens.user_id
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > now();`,
+		utils.HashVerifier(token), purpose).Scan(&email)
+
+	if err == sql.ErrNoRows {
+		return "", utils.ErrInvalidToken
+	}
+
+	return email, err
+}
+
+// consumeOneTimeToken marks the token as used and returns its user. The
+// conditional update lets only one of concurrent requests consume the token.
+func consumeOneTimeToken(tx *sql.Tx, token, purpose string) (string, error) {
+	var userID string
+
+	err := tx.QueryRow(`UPDATE one_time_tokens SET consumed_at=now()
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > now()
+		RETURNING user_id`, utils.HashVerifier(token), purpose).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return "", utils.ErrInvalidToken
+	}
+
+	return userID, err
+}
+
+func (s *AuthRepository) VerifyEmail(token string) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	userID, err := consumeOneTimeToken(tx, token, utils.EmailVerifyTokenType)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Users SET verified=TRUE WHERE id=$1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword consumes the reset token and sets the new password in one
+// transaction, revoking every token of the user like ChangePassword.
+func (s *AuthRepository) ResetPassword(token, hashedPassword string) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	userID, err := consumeOneTimeToken(tx, token, utils.PasswordResetTokenType)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Users SET password=$1, failed_attempts=0, locked_until=NULL WHERE id=$2",
+		hashedPassword, userID)
+
+	if err != nil {
+		return err
+	}
+
+	err = revokeUserTokens(tx, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// consumeEmailChangeToken is consumeOneTimeToken for email change tokens. It
+// returns the user with their current email and the address of the token.
+func consumeEmailChangeToken(tx *sql.Tx, token, purpose string) (models.User, string, error) {
+	var user models.User
+	var tokenEmail string
+
+	err := tx.QueryRow(`UPDATE one_time_tokens SET consumed_at=now() FROM Users
+		WHERE Users.id = one_time_tokens.user_id AND token_hash = $1 AND purpose = $2 AND consumed_at IS NULL
+		AND expires_at > now()
+		RETURNING Users.id, Users.email, Users.locale, one_time_tokens.email`, utils.HashVerifier(token),
+		purpose).Scan(&user.ID, &user.Email, &user.Locale, &tokenEmail)
+
+	if err == sql.ErrNoRows {
+		return models.User{}, "", utils.ErrInvalidToken
+	}
+
+	return user, tokenEmail, err
 }
 
-func (s *AuthRepository) SetPassword(email, hashedPassword string) error {
-	_, err := s.db.Exec("UPDATE Users SET password=$1 WHERE email=$2", hashedPassword, email)
+// setUserEmail changes the email, ErrEmailExists is returned if another user
+// took the address meanwhile. A concurrent signup with the address is left
+// to the unique constraint.
+func setUserEmail(tx *sql.Tx, userID, email string) error {
+	var exists bool
+
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM Users WHERE email = $1 AND id <> $2);", email,
+		userID).Scan(&exists)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrEmailExists
+	}
+
+	_, err = tx.Exec("UPDATE Users SET email=$1, verified=TRUE WHERE id=$2;", email, userID)
+
 	return err
 }
+
+// ConfirmEmailChange moves the user to the confirmed address and returns the
+// user with the old email, the new email and a token restoring the old one.
+// Like a password change it revokes every token of the user, links sent to
+// the old address stop working as well. It runs in the caller's transaction,
+// so the change is undone if the old address can't be notified.
+func (s *AuthRepository) ConfirmEmailChange(tx *sql.Tx, token string) (models.User, string, string, error) {
+	user, newEmail, err := consumeEmailChangeToken(tx, token, utils.EmailChangeTokenType)
+
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+
+	err = setUserEmail(tx, user.ID, newEmail)
+
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+
+	err = revokeUserTokens(tx, user.ID)
+
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+
+	undoToken, err := createOneTimeToken(tx, user.ID, utils.EmailChangeUndoTokenType, user.Email)
+
+	if err != nil {
+		return models.User{}, "", "", err
+	}
+
+	return user, newEmail, undoToken, nil
+}
+
+// UndoEmailChange restores the address the undo token was sent to and
+// revokes every token of the user, whoever changed the email is signed out.
+func (s *AuthRepository) UndoEmailChange(token string) (string, error) {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	user, oldEmail, err := consumeEmailChangeToken(tx, token, utils.EmailChangeUndoTokenType)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = setUserEmail(tx, user.ID, oldEmail)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = revokeUserTokens(tx, user.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return oldEmail, tx.Commit()
+}
+
+// SecureAccount consumes the token of a security alert and revokes every
+// token of its user. It returns the id of the user.
+func (s *AuthRepository) SecureAccount(token string) (string, error) {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	userID, err := consumeOneTimeToken(tx, token, utils.SecureAccountTokenType)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = revokeUserTokens(tx, userID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
+
+func (s *AuthRepository) SetPassword(userID, hashedPassword string) error {
+	_, err := s.db.Exec("UPDATE Users SET password=$1 WHERE id=$2", hashedPassword, userID)
+	return err
+}
+
+// updateUserRevokingTokens applies the update and revokes the user's tokens
+// in the same transaction.
+func (s *AuthRepository) updateUserRevokingTokens(userID, query string, args ...any) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = revokeUserTokens(tx, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeUserTokens bumps the token version and deletes every session and
+// unused emailed link of the user, so all previously issued tokens stop
+// working at once.
+func revokeUserTokens(tx *sql.Tx, userID string) error {
+	_, err := tx.Exec("UPDATE Users SET token_version = token_version + 1 WHERE id = $1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Sessions WHERE user_id = $1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM one_time_tokens WHERE user_id = $1 AND consumed_at IS NULL;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM magic_links WHERE user_id = $1;", userID)
+
+	return err
+}
+
+func (s *AuthRepository) ChangePassword(userID, hashedPassword string) error {
+	return s.updateUserRevokingTokens(userID, "UPDATE Users SET password=$1 WHERE id=$2", hashedPassword, userID)
+}
+
+func (s *AuthRepository) ChangeRole(userID, role string) error {
+	return s.updateUserRevokingTokens(userID, "UPDATE Users SET role=$1 WHERE id=$2", role, userID)
+}
+
+func (s *AuthRepository) LockUser(userID string) error {
+	return s.updateUserRevokingTokens(userID, "UPDATE Users SET locked=TRUE WHERE id=$1", userID)
+}
+
+func (s *AuthRepository) UnlockUser(userID string) error {
+	result, err := s.db.Exec("UPDATE Users SET locked=FALSE, failed_attempts=0, locked_until=NULL WHERE id=$1",
+		userID)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FindMFA returns the MFA of the user with the decrypted TOTP secret.
+func (s *AuthRepository) FindMFA(userID string) (models.MFA, error) {
+	row := s.db.QueryRow(`SELECT user_id, totp_secret, confirmed_at, last_used_step, failed_attempts, locked_until
+		FROM user_mfa WHERE user_id = $1;`, userID)
+
+	var mfa models.MFA
+	var sealed string
+	err := row.Scan(&mfa.UserID, &sealed, &mfa.ConfirmedAt, &mfa.LastUsedStep, &mfa.FailedAttempts,
+		&mfa.LockedUntil)
+
+	if err != nil {
+		return mfa, err
+	}
+
+	mfa.TOTPSecret, _, err = utils.OpenTOTPSecret(mfa.UserID, sealed)
+
+	return mfa, err
+}
+
+// UseMFAChallenge counts a code tried with the MFA challenge token and
+// returns how many were tried, this one included. The row lives as long as
+// the token.
+func (s *AuthRepository) UseMFAChallenge(tokenID string, expiresAt time.Time) (int, error) {
+	var attempts int
+
+	err := s.db.QueryRow(`INSERT INTO mfa_challenges (token_id, attempts, expires_at) VALUES($1, 1, $2)
+		ON CONFLICT (token_id) DO UPDATE SET attempts = mfa_challenges.attempts + 1
+		RETURNING attempts;`, tokenID, expiresAt).Scan(&attempts)
+
+	return attempts, err
+}
+
+// RecordFailedMFA counts a wrong second factor code and locks the second
+// factor of the user like recordFailedLogin does password logins. It reports
+// whether this failure was the first one to lock the user out.
+func (s *AuthRepository) RecordFailedMFA(userID string) (bool, error) {
+	var failedAttempts int
+
+	err := s.db.QueryRow(`UPDATE user_mfa SET failed_attempts = failed_attempts + 1
+		WHERE user_id = $1 RETURNING failed_attempts;`, userID).Scan(&failedAttempts)
+
+	if err != nil {
+		return false, err
+	}
+
+	delay := utils.LockoutDelay(failedAttempts)
+
+	if delay == 0 {
+		return false, nil
+	}
+
+	_, err = s.db.Exec("UPDATE user_mfa SET locked_until = GREATEST(locked_until, $2) WHERE user_id = $1;",
+		userID, time.Now().Add(delay))
+
+	if err != nil {
+		return false, err
+	}
+
+	return utils.LockoutDelay(failedAttempts-1) == 0, nil
+}
+
+func (s *AuthRepository) ResetFailedMFA(userID string) error {
+	_, err := s.db.Exec("UPDATE user_mfa SET failed_attempts=0, locked_until=NULL WHERE user_id=$1;", userID)
+	return err
+}
+
+// StartTOTPEnrollment stores a new unconfirmed secret, encrypted. Restarting
+// an unfinished enrollment replaces the secret, ErrMFAEnabled is returned if
+// MFA is already confirmed.
+func (s *AuthRepository) StartTOTPEnrollment(userID, secret string) error {
+	sealed, err := utils.SealTOTPSecret(userID, secret)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`INSERT INTO user_mfa (user_id, totp_secret) VALUES($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0
+		WHERE user_mfa.confirmed_at IS NULL;`, userID, sealed)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrMFAEnabled
+	}
+
+	return nil
+}
+
+// ConfirmMFA enables MFA with the time step of the first valid code and
+// stores the recovery codes.
+func (s *AuthRepository) ConfirmMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE user_mfa SET confirmed_at=now(), last_used_step=$2
+		WHERE user_id = $1 AND confirmed_at IS NULL AND last_used_step < $2;`, userID, step)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrMFACodeUsed
+	}
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted code. The conditional
+// update rejects a replay of the same or an earlier code, also between
+// concurrent requests.
+func (s *AuthRepository) UseTOTPStep(userID string, step int64) error {
+	result, err := s.db.Exec(`UPDATE user_mfa SET last_used_step=$2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2;`, userID, step)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the code as used. ErrMFACodeUsed is returned for an
+// unknown or already used code.
+func (s *AuthRepository) UseRecoveryCode(userID, codeHash string) error {
+	result, err := s.db.Exec(`UPDATE recovery_codes SET used_at=now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`, userID, codeHash)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+func (s *AuthRepository) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, userID, codeHashes)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string, codeHashes []string) error {
+	_, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES($1, $2)", userID, codeHash)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *AuthRepository) DisableMFA(userID string) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_mfa WHERE user_id = $1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *AuthRepository) CreateWebAuthnChallenge(challenge models.WebAuthnChallenge) error {
+	_, err := s.db.Exec(`INSERT INTO webauthn_challenges (id, user_id, ceremony, session_data, expires_at)
+		VALUES($1, NULLIF($2::text, '')::uuid, $3, $4, $5)`, challenge.ID, challenge.UserID, challenge.Ceremony,
+		challenge.SessionData, challenge.ExpiresAt)
+
+	return err
+}
+
+// ConsumeWebAuthnChallenge deletes the challenge and returns it, so every
+// challenge can be answered once.
+func (s *AuthRepository) ConsumeWebAuthnChallenge(id, ceremony string) (models.WebAuthnChallenge, error) {
+	row := s.db.QueryRow(`DELETE FROM webauthn_challenges
+		WHERE id = $1 AND ceremony = $2 AND expires_at > now()
+		RETURNING id, COALESCE(user_id::text, ''), ceremony, session_data, expires_at;`, id, ceremony)
+
+	var challenge models.WebAuthnChallenge
+	err := row.Scan(&challenge.ID, &challenge.UserID, &challenge.Ceremony, &challenge.SessionData,
+		&challenge.ExpiresAt)
+
+	return challenge, err
+}
+
+const selectWebAuthnCredentialColumns = `id, user_handle, user_id, name, public_key, attestation_type, aaguid,
+	sign_count, transports, backup_eligible, backup_state, created_at, last_used_at FROM webauthn_credentials`
+
+func scanWebAuthnCredential(row interface{ Scan(...any) error }) (models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	var transports string
+
+	err := row.Scan(&credential.ID, &credential.UserHandle, &credential.UserID, &credential.Name,
+		&credential.PublicKey, &credential.AttestationType, &credential.AAGUID, &credential.SignCount, &transports,
+		&credential.BackupEligible, &credential.BackupState, &credential.CreatedAt, &credential.LastUsedAt)
+
+	if transports != "" {
+		credential.Transports = strings.Split(transports, ",")
+	}
+
+	return credential, err
+}
+
+func (s *AuthRepository) CreateWebAuthnCredential(credential models.WebAuthnCredential) error {
+	_, err := s.db.Exec(`INSERT INTO webauthn_credentials (id, user_handle, user_id, name, public_key,
+		attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, credential.ID, credential.UserHandle,
+		credential.UserID, credential.Name, credential.PublicKey, credential.AttestationType, credential.AAGUID,
+		credential.SignCount, strings.Join(credential.Transports, ","), credential.BackupEligible,
+		credential.BackupState)
+
+	return err
+}
+
+func (s *AuthRepository) FindWebAuthnCredential(id []byte) (models.WebAuthnCredential, error) {
+	row := s.db.QueryRow("SELECT "+selectWebAuthnCredentialColumns+" WHERE id = $1;", id)
+
+	return scanWebAuthnCredential(row)
+}
+
+func (s *AuthRepository) ListWebAuthnCredentials(userID string) ([]models.WebAuthnCredential, error) {
+	rows, err := s.db.Query("SELECT "+selectWebAuthnCredentialColumns+`
+		WHERE user_id = $1 ORDER BY created_at;`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// UpdateWebAuthnSignCount stores the counter of a successful login. The
+// conditional update makes two logins with the same counter, e.g. from a
+// cloned authenticator racing the real one, fail with ErrSignCountUsed.
+// Authenticators that don't count always send zero.
+func (s *AuthRepository) UpdateWebAuthnSignCount(credential models.WebAuthnCredential) error {
+	result, err := s.db.Exec(`UPDATE webauthn_credentials SET sign_count=$2, backup_state=$3, last_used_at=now()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0));`, credential.ID, credential.SignCount,
+		credential.BackupState)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrSignCountUsed
+	}
+
+	return nil
+}
+
+// CreateMagicLink stores the hashes of a new link token and code bound to the
+// device and returns both. Any earlier link of the user stops working, so
+// only the code from the latest email is accepted. The wrong codes of an
+// unused earlier link carry over, so asking for new links doesn't give more
+// guesses. ErrMagicLinkExhausted is returned while the link that used up the
+// attempts is still valid.
+func (s *AuthRepository) CreateMagicLink(tx *sql.Tx, userID, deviceID string) (string, string, error) {
+	var attempts int
+
+	err := tx.QueryRow(`SELECT COALESCE(MAX(attempts), 0) FROM magic_links
+		WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > now();`, userID).Scan(&attempts)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if attempts >= utils.MagicLinkMaxAttempts() {
+		return "", "", ErrMagicLinkExhausted
+	}
+
+	token, tokenHash, err := utils.GenerateOneTimeToken()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	code, err := utils.GenerateEmailCode()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = tx.Exec("DELETE FROM magic_links WHERE user_id = $1;", userID)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = tx.Exec(`INSERT INTO magic_links (token_hash, code_hash, user_id, device_id, attempts, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6)`, tokenHash, utils.HashVerifier(code), userID, deviceID, attempts,
+		utils.MagicLinkExpiresAt())
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, code, nil
+}
+
+// ConsumeMagicLink uses the link token on the device it was requested for and
+// returns the user. The link proves the address, so the email is verified.
+func (s *AuthRepository) ConsumeMagicLink(token, deviceID string) (string, error) {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRow(`UPDATE magic_links SET consumed_at=now()
+		WHERE token_hash = $1 AND device_id = $2 AND consumed_at IS NULL AND expires_at > now() AND attempts < $3
+		RETURNING user_id`, utils.HashVerifier(token), deviceID, utils.MagicLinkMaxAttempts()).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return "", utils.ErrInvalidToken
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return userID, verifyMagicLinkUser(tx, userID)
+}
+
+// ConsumeMagicLinkCode checks the code of the user's active link. A wrong
+// code counts as an attempt, the row lock keeps concurrent guesses from
+// exceeding the limit.
+func (s *AuthRepository) ConsumeMagicLinkCode(email, code, deviceID string) (string, error) {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var tokenHash, codeHash, userID string
+
+	err = tx.QueryRow(`SELECT token_hash, code_hash, user_id FROM magic_links
+		WHERE user_id = (SELECT id FROM Users WHERE email = $1) AND device_id = $2 AND consumed_at IS NULL AND expires_at > now()
+		AND attempts < $3
+		FOR UPDATE;`, email, deviceID, utils.MagicLinkMaxAttempts()).Scan(&tokenHash, &codeHash, &userID)
+
+	if err == sql.ErrNoRows {
+		return "", utils.ErrInvalidToken
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !utils.CheckVerifier(code, codeHash) {
+		_, err = tx.Exec("UPDATE magic_links SET attempts = attempts + 1 WHERE token_hash = $1;", tokenHash)
+
+		if err != nil {
+			return "", err
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			return "", err
+		}
+
+		return "", utils.ErrInvalidToken
+	}
+
+	_, err = tx.Exec("UPDATE magic_links SET consumed_at=now() WHERE token_hash = $1;", tokenHash)
+
+	if err != nil {
+		return "", err
+	}
+
+	return userID, verifyMagicLinkUser(tx, userID)
+}
+
+func verifyMagicLinkUser(tx *sql.Tx, userID string) error {
+	_, err := tx.Exec("UPDATE Users SET verified=TRUE WHERE id=$1;", userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const selectIdentityColumns = `provider, subject, user_id, email, created_at, last_used_at FROM user_identities`
+
+func scanIdentity(row interface{ Scan(...any) error }) (models.Identity, error) {
+	var identity models.Identity
+
+	err := row.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email,
+		&identity.CreatedAt, &identity.LastUsedAt)
+
+	return identity, err
+}
+
+func (s *AuthRepository) FindIdentity(provider, subject string) (models.Identity, error) {
+	row := s.db.QueryRow("SELECT "+selectIdentityColumns+`
+		WHERE provider = $1 AND subject = $2;`, provider, subject)
+
+	return scanIdentity(row)
+}
+
+func (s *AuthRepository) ListIdentities(userID string) ([]models.Identity, error) {
+	rows, err := s.db.Query("SELECT "+selectIdentityColumns+`
+		WHERE user_id = $1 ORDER BY created_at;`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	identities := []models.Identity{}
+
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+const insertIdentityQuery = `INSERT INTO user_identities (provider, subject, user_id, email, last_used_at)
+	VALUES($1, $2, $3, $4, now()) ON CONFLICT DO NOTHING`
+
+// CreateIdentity links the identity to its user. ErrIdentityExists is
+// returned if the identity is linked already or the user has another
+// identity of the provider.
+func (s *AuthRepository) CreateIdentity(identity models.Identity) error {
+	result, err := s.db.Exec(insertIdentityQuery, identity.Provider, identity.Subject, identity.UserID,
+		identity.Email)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrIdentityExists
+	}
+
+	return nil
+}
+
+// CreateIdentityUser creates a user signing up with an identity and returns
+// the new user id. The user has no password, the provider already verified
+// the email.
+func (s *AuthRepository) CreateIdentityUser(user models.User, identity models.Identity) (string, error) {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRow("INSERT INTO Users (email, password, role, verified) VALUES($1, '', $2, TRUE) RETURNING id",
+		user.Email, user.Role).Scan(&userID)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(insertIdentityQuery, identity.Provider, identity.Subject, userID, identity.Email)
+
+	if err != nil {
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
+
+func (s *AuthRepository) UseIdentity(provider, subject string) error {
+	_, err := s.db.Exec("UPDATE user_identities SET last_used_at=now() WHERE provider = $1 AND subject = $2;",
+		provider, subject)
+
+	return err
+}
+
+func (s *AuthRepository) DeleteIdentity(userID, provider string) error {
+	result, err := s.db.Exec("DELETE FROM user_identities WHERE user_id = $1 AND provider = $2;",
+		userID, provider)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *AuthRepository) CreateOIDCNonce(nonce string, expiresAt time.Time) error {
+	_, err := s.db.Exec("INSERT INTO oidc_nonces (nonce, expires_at) VALUES($1, $2);", nonce, expiresAt)
+	return err
+}
+
+// ConsumeOIDCNonce deletes the nonce, so every ID token carrying it is
+// accepted once.
+func (s *AuthRepository) ConsumeOIDCNonce(nonce string) error {
+	result, err := s.db.Exec("DELETE FROM oidc_nonces WHERE nonce = $1 AND expires_at > now();", nonce)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
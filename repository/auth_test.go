@@ -0,0 +1,142 @@
+package repository_test
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/schema"
+	"DiaSync/server"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB opens the database of DIASYNC_TEST_DB (key=value connection string)
+// in a new schema with every migration applied, dropped after the test. The
+// test is skipped without one.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("DIASYNC_TEST_DB")
+
+	if dsn == "" {
+		t.Skip("DIASYNC_TEST_DB is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("repository_test_%d", time.Now().UnixNano())
+
+	_, err = admin.Exec("CREATE SCHEMA " + name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", dsn+" search_path="+name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + name + " CASCADE")
+		admin.Close()
+	})
+
+	migrator, err := server.NewMigrator(db, schema.Migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestAuthRepository_ConfirmEmailChange(t *testing.T) {
+	db := testDB(t)
+	repo := repository.NewAuthRepository(db)
+
+	var userID string
+
+	err := db.QueryRow(`INSERT INTO Users (email, password, role, verified) VALUES('old@mail.com', '', $1, TRUE)
+		RETURNING id`, utils.RolePatient).Scan(&userID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := repo.FindUserByID(userID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, refreshToken, err := repo.GenerateTokens(user, models.Device{ID: "phone"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inTx := func(f func(tx *sql.Tx) error) {
+		tx, err := repo.BeginTx()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer tx.Rollback()
+
+		if err := f(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var token string
+
+	inTx(func(tx *sql.Tx) (err error) {
+		token, err = repo.CreateEmailChangeToken(tx, userID, "new@mail.com")
+		return err
+	})
+
+	inTx(func(tx *sql.Tx) error {
+		_, _, _, err := repo.ConfirmEmailChange(tx, token)
+		return err
+	})
+
+	if _, err := repo.FindSession(refreshToken); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, the refresh token must be revoked", err)
+	}
+
+	principal, err := utils.ParseAccessToken(accessToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := repo.FindUserByID(userID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RequireAuth rejects access tokens of another token version
+	if changed.Email != "new@mail.com" || principal.TokenVersion == changed.TokenVersion {
+		t.Errorf("got %s with token version %d, the access token must be revoked", changed.Email,
+			changed.TokenVersion)
+	}
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"DiaSync/models"
+	"database/sql"
+	"time"
+)
+
+// QueueEmail stores the email in the transaction that needs it, so it's sent
+// only if the transaction commits.
+func (s *AuthRepository) QueueEmail(tx *sql.Tx, email models.OutboxEmail) error {
+	_, err := tx.Exec(`INSERT INTO email_outbox (recipient, subject, text_body, html_body, notification)
+		VALUES($1, $2, $3, $4, $5);`, email.To, email.Subject, email.Text, email.HTML, email.Notification)
+
+	return err
+}
+
+const selectOutboxColumns = `id, recipient, subject, text_body, html_body, notification, attempts, last_error,
+	next_attempt_at, dead_at, created_at`
+
+func scanOutboxEmail(row interface{ Scan(...any) error }) (models.OutboxEmail, error) {
+	var email models.OutboxEmail
+
+	err := row.Scan(&email.ID, &email.To, &email.Subject, &email.Text, &email.HTML, &email.Notification,
+		&email.Attempts, &email.LastError, &email.NextAttemptAt, &email.DeadAt, &email.CreatedAt)
+
+	return email, err
+}
+
+func scanOutboxEmails(rows *sql.Rows, err error) ([]models.OutboxEmail, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	emails := []models.OutboxEmail{}
+
+	for rows.Next() {
+		email, err := scanOutboxEmail(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+// ClaimEmails takes up to limit due emails and counts the attempt. A claimed
+// email isn't due again until leaseUntil, SKIP LOCKED lets several workers
+// claim at once without sending an email twice.
+func (s *AuthRepository) ClaimEmails(limit int, leaseUntil time.Time) ([]models.OutboxEmail, error) {
+	return scanOutboxEmails(s.db.Query(`UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (SELECT id FROM email_outbox WHERE dead_at IS NULL AND sent_at IS NULL AND next_attempt_at <= now()
+		ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING `+selectOutboxColumns+`;`, limit, leaseUntil))
+}
+
+// MarkEmailSent records a delivered email and blanks its bodies, they hold
+// live links and codes.
+func (s *AuthRepository) MarkEmailSent(id int64) error {
+	_, err := s.db.Exec("UPDATE email_outbox SET sent_at = now(), text_body = '', html_body = '' WHERE id = $1;", id)
+	return err
+}
+
+// FailEmail records a failed attempt and either schedules the next one or
+// dead-letters the email.
+func (s *AuthRepository) FailEmail(id int64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	_, err := s.db.Exec(`UPDATE email_outbox SET last_error = $2, next_attempt_at = $3,
+		dead_at = CASE WHEN $4 THEN now() END WHERE id = $1;`, id, lastError, nextAttemptAt, dead)
+
+	return err
+}
+
+// ListFailedEmails returns the latest emails with a failed attempt, both
+// dead-lettered and still retried.
+func (s *AuthRepository) ListFailedEmails() ([]models.OutboxEmail, error) {
+	return scanOutboxEmails(s.db.Query("SELECT " + selectOutboxColumns + ` FROM email_outbox
+		WHERE last_error <> '' AND sent_at IS NULL ORDER BY created_at DESC LIMIT 100;`))
+}
+
+// RetryEmail makes a failed email due right away with all attempts again.
+func (s *AuthRepository) RetryEmail(id int64) error {
+	result, err := s.db.Exec(`UPDATE email_outbox SET attempts = 0, next_attempt_at = now(), dead_at = NULL
+		WHERE id = $1 AND last_error <> '' AND sent_at IS NULL;`, id)
+
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
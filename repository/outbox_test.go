@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"testing"
+	"time"
+)
+
+func TestAuthRepository_MarkEmailSent(t *testing.T) {
+	db := testDB(t)
+	repo := repository.NewAuthRepository(db)
+
+	tx, err := repo.BeginTx()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.QueueEmail(tx, models.OutboxEmail{To: "dmitrkozyrev2@gmail.com", Subject: "Reset password",
+		Text: "reset-token", HTML: "<a>reset-token</a>"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	emails, err := repo.ClaimEmails(10, time.Now())
+
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("got %v, %v", emails, err)
+	}
+
+	if err := repo.MarkEmailSent(emails[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var text, html string
+
+	err = db.QueryRow("SELECT text_body, html_body FROM email_outbox WHERE id = $1 AND sent_at IS NOT NULL",
+		emails[0].ID).Scan(&text, &html)
+
+	if err != nil || text != "" || html != "" {
+		t.Errorf("got %q, %q, %v, a sent email must keep no bodies", text, html, err)
+	}
+
+	// the lease of the claim is over, only a sent email isn't due again
+	if emails, err := repo.ClaimEmails(10, time.Now()); err != nil || len(emails) != 0 {
+		t.Errorf("got %v, %v, a sent email must not be claimed again", emails, err)
+	}
+}
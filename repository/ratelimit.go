@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"DiaSync/config"
+	"database/sql"
+	"time"
+)
+
+func NewRateLimitRepository(db *sql.DB) *RateLimitRepository {
+	return &RateLimitRepository{db}
+}
+
+// RateLimitRepository keeps the token buckets in Postgres, so every instance
+// of the server enforces the same limits.
+type RateLimitRepository struct {
+	db *sql.DB
+}
+
+// Allow refills the bucket for the time since its last use and takes a token
+// if there is one. Every SET expression sees the old row, so the refill is
+// computed the same way for tokens and allowed.
+func (s *RateLimitRepository) Allow(key string, limit config.Limit) (bool, time.Duration, error) {
+	capacity := float64(limit.Requests)
+	rate := capacity / (limit.Period * time.Second).Seconds()
+
+	var tokens float64
+	var allowed bool
+
+	err := s.db.QueryRow(`INSERT INTO rate_limits AS r (key, tokens, allowed, updated_at)
+		VALUES($1, $2 - 1, TRUE, now())
+		ON CONFLICT (key) DO UPDATE SET
+		tokens = LEAST($2, r.tokens + EXTRACT(EPOCH FROM now() - r.updated_at) * $3)
+			- CASE WHEN LEAST($2, r.tokens + EXTRACT(EPOCH FROM now() - r.updated_at) * $3) >= 1 THEN 1 ELSE 0 END,
+		allowed = LEAST($2, r.tokens + EXTRACT(EPOCH FROM now() - r.updated_at) * $3) >= 1,
+		updated_at = now()
+		RETURNING tokens, allowed;`, key, capacity, rate).Scan(&tokens, &allowed)
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	if allowed {
+		return true, 0, nil
+	}
+
+	return false, time.Duration((1 - tokens) / rate * float64(time.Second)), nil
+}
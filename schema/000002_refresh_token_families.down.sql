@@ -0,0 +1,12 @@
+DROP TABLE security_events;
+
+DROP INDEX sessions_family_id_idx;
+
+ALTER TABLE Sessions
+DROP COLUMN family_id,
+DROP COLUMN parent_token,
+DROP COLUMN issued_at,
+DROP COLUMN expires_at,
+DROP COLUMN last_used_at,
+DROP COLUMN rotated_at,
+DROP COLUMN revoked_at;
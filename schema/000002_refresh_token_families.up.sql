@@ -0,0 +1,19 @@
+-- Sessions created before this migration have no known expiry and expire immediately.
+ALTER TABLE Sessions
+ADD COLUMN family_id TEXT NOT NULL DEFAULT md5(random()::text),
+ADD COLUMN parent_token TEXT,
+ADD COLUMN issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+ADD COLUMN last_used_at TIMESTAMPTZ,
+ADD COLUMN rotated_at TIMESTAMPTZ,
+ADD COLUMN revoked_at TIMESTAMPTZ;
+
+CREATE INDEX sessions_family_id_idx ON Sessions (family_id);
+
+CREATE TABLE security_events(
+	id BIGSERIAL PRIMARY KEY,
+	user_email TEXT NOT NULL,
+	event TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,7 @@
+DELETE FROM Sessions;
+
+ALTER TABLE Sessions DROP COLUMN verifier_hash;
+
+ALTER TABLE Sessions RENAME COLUMN parent_selector TO parent_token;
+
+ALTER TABLE Sessions RENAME COLUMN selector TO refresh_token;
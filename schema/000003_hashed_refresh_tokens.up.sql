@@ -0,0 +1,8 @@
+-- Refresh tokens were stored in plaintext, every existing session is invalidated.
+DELETE FROM Sessions;
+
+ALTER TABLE Sessions RENAME COLUMN refresh_token TO selector;
+
+ALTER TABLE Sessions RENAME COLUMN parent_token TO parent_selector;
+
+ALTER TABLE Sessions ADD COLUMN verifier_hash TEXT NOT NULL;
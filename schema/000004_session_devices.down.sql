@@ -0,0 +1,8 @@
+DROP INDEX sessions_user_email_idx;
+
+ALTER TABLE Sessions
+DROP COLUMN device_name,
+DROP COLUMN platform,
+DROP COLUMN ip,
+DROP COLUMN user_agent,
+DROP COLUMN created_at;
@@ -0,0 +1,8 @@
+ALTER TABLE Sessions
+ADD COLUMN device_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN platform TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX sessions_user_email_idx ON Sessions (user_email);
@@ -0,0 +1,3 @@
+ALTER TABLE Users
+DROP COLUMN locked,
+DROP COLUMN token_version;
@@ -0,0 +1,3 @@
+ALTER TABLE Users
+ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE one_time_tokens(
+token_hash TEXT PRIMARY KEY,
+purpose TEXT NOT NULL,
+user_email TEXT NOT NULL REFERENCES Users (email) ON DELETE CASCADE,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+expires_at TIMESTAMPTZ NOT NULL,
+consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX one_time_tokens_user_email_idx ON one_time_tokens (user_email);
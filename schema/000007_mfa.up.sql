@@ -0,0 +1,16 @@
+CREATE TABLE user_mfa(
+user_email TEXT PRIMARY KEY REFERENCES Users (email) ON DELETE CASCADE,
+totp_secret TEXT NOT NULL,
+confirmed_at TIMESTAMPTZ,
+last_used_step BIGINT NOT NULL DEFAULT 0,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE recovery_codes(
+id BIGSERIAL PRIMARY KEY,
+user_email TEXT NOT NULL REFERENCES Users (email) ON DELETE CASCADE,
+code_hash TEXT NOT NULL,
+used_at TIMESTAMPTZ
+);
+
+CREATE INDEX recovery_codes_user_email_idx ON recovery_codes (user_email);
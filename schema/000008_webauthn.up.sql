@@ -0,0 +1,25 @@
+CREATE TABLE webauthn_credentials(
+id BYTEA PRIMARY KEY,
+user_handle BYTEA NOT NULL,
+user_email TEXT NOT NULL REFERENCES Users (email) ON DELETE CASCADE,
+name TEXT NOT NULL DEFAULT '',
+public_key BYTEA NOT NULL,
+attestation_type TEXT NOT NULL DEFAULT '',
+aaguid BYTEA,
+sign_count BIGINT NOT NULL DEFAULT 0,
+transports TEXT NOT NULL DEFAULT '',
+backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX webauthn_credentials_user_email_idx ON webauthn_credentials (user_email);
+
+CREATE TABLE webauthn_challenges(
+id TEXT PRIMARY KEY,
+user_email TEXT REFERENCES Users (email) ON DELETE CASCADE,
+ceremony TEXT NOT NULL,
+session_data BYTEA NOT NULL,
+expires_at TIMESTAMPTZ NOT NULL
+);
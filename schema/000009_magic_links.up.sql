@@ -0,0 +1,12 @@
+CREATE TABLE magic_links(
+token_hash TEXT PRIMARY KEY,
+code_hash TEXT NOT NULL,
+user_email TEXT NOT NULL REFERENCES Users (email) ON DELETE CASCADE,
+device_id TEXT NOT NULL,
+attempts INTEGER NOT NULL DEFAULT 0,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+expires_at TIMESTAMPTZ NOT NULL,
+consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX magic_links_user_email_idx ON magic_links (user_email);
@@ -0,0 +1,10 @@
+CREATE TABLE user_identities(
+provider TEXT NOT NULL,
+subject TEXT NOT NULL,
+user_email TEXT NOT NULL REFERENCES Users (email) ON DELETE CASCADE,
+email TEXT NOT NULL DEFAULT '',
+created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+last_used_at TIMESTAMPTZ,
+PRIMARY KEY (provider, subject),
+UNIQUE (user_email, provider)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS rate_limits;
+
+ALTER TABLE Users
+DROP COLUMN IF EXISTS locked_until,
+DROP COLUMN IF EXISTS failed_attempts;
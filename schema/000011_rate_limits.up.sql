@@ -0,0 +1,10 @@
+ALTER TABLE Users
+ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE TABLE rate_limits(
+key TEXT PRIMARY KEY,
+tokens DOUBLE PRECISION NOT NULL,
+allowed BOOLEAN NOT NULL,
+updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,61 @@
+ALTER TABLE one_time_tokens DROP COLUMN email;
+
+-- pending email changes can't be kept, their tokens are dropped
+DELETE FROM one_time_tokens WHERE purpose IN ('email_change', 'email_change_undo');
+
+ALTER TABLE Sessions ADD COLUMN user_email TEXT;
+ALTER TABLE security_events ADD COLUMN user_email TEXT;
+ALTER TABLE one_time_tokens ADD COLUMN user_email TEXT;
+ALTER TABLE user_mfa ADD COLUMN user_email TEXT;
+ALTER TABLE recovery_codes ADD COLUMN user_email TEXT;
+ALTER TABLE webauthn_credentials ADD COLUMN user_email TEXT;
+ALTER TABLE webauthn_challenges ADD COLUMN user_email TEXT;
+ALTER TABLE magic_links ADD COLUMN user_email TEXT;
+ALTER TABLE user_identities ADD COLUMN user_email TEXT;
+
+UPDATE Sessions SET user_email = Users.email FROM Users WHERE Users.id = Sessions.user_id;
+UPDATE security_events SET user_email = Users.email FROM Users WHERE Users.id = security_events.user_id;
+UPDATE one_time_tokens SET user_email = Users.email FROM Users WHERE Users.id = one_time_tokens.user_id;
+UPDATE user_mfa SET user_email = Users.email FROM Users WHERE Users.id = user_mfa.user_id;
+UPDATE recovery_codes SET user_email = Users.email FROM Users WHERE Users.id = recovery_codes.user_id;
+UPDATE webauthn_credentials SET user_email = Users.email FROM Users WHERE Users.id = webauthn_credentials.user_id;
+UPDATE webauthn_challenges SET user_email = Users.email FROM Users WHERE Users.id = webauthn_challenges.user_id;
+UPDATE magic_links SET user_email = Users.email FROM Users WHERE Users.id = magic_links.user_id;
+UPDATE user_identities SET user_email = Users.email FROM Users WHERE Users.id = user_identities.user_id;
+
+ALTER TABLE Sessions DROP COLUMN user_id;
+ALTER TABLE security_events DROP COLUMN user_id;
+ALTER TABLE one_time_tokens DROP COLUMN user_id;
+ALTER TABLE user_mfa DROP COLUMN user_id;
+ALTER TABLE recovery_codes DROP COLUMN user_id;
+ALTER TABLE webauthn_credentials DROP COLUMN user_id;
+ALTER TABLE webauthn_challenges DROP COLUMN user_id;
+ALTER TABLE magic_links DROP COLUMN user_id;
+ALTER TABLE user_identities DROP COLUMN user_id;
+
+ALTER TABLE Users DROP CONSTRAINT users_pkey;
+ALTER TABLE Users DROP CONSTRAINT users_email_key;
+ALTER TABLE Users ADD PRIMARY KEY (email);
+ALTER TABLE Users DROP COLUMN id;
+
+ALTER TABLE Sessions ALTER COLUMN user_email SET NOT NULL, ADD FOREIGN KEY (user_email) REFERENCES Users (email);
+ALTER TABLE security_events ALTER COLUMN user_email SET NOT NULL;
+ALTER TABLE one_time_tokens ALTER COLUMN user_email SET NOT NULL,
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE user_mfa ADD PRIMARY KEY (user_email),
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE recovery_codes ALTER COLUMN user_email SET NOT NULL,
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE webauthn_credentials ALTER COLUMN user_email SET NOT NULL,
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE webauthn_challenges ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE magic_links ALTER COLUMN user_email SET NOT NULL,
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE;
+ALTER TABLE user_identities ALTER COLUMN user_email SET NOT NULL,
+ADD FOREIGN KEY (user_email) REFERENCES Users (email) ON DELETE CASCADE, ADD UNIQUE (user_email, provider);
+
+CREATE INDEX sessions_user_email_idx ON Sessions (user_email);
+CREATE INDEX one_time_tokens_user_email_idx ON one_time_tokens (user_email);
+CREATE INDEX recovery_codes_user_email_idx ON recovery_codes (user_email);
+CREATE INDEX webauthn_credentials_user_email_idx ON webauthn_credentials (user_email);
+CREATE INDEX magic_links_user_email_idx ON magic_links (user_email);
@@ -0,0 +1,66 @@
+-- Users get a surrogate key, so changing the email doesn't touch other tables.
+ALTER TABLE Users ADD COLUMN id UUID NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE Sessions ADD COLUMN user_id UUID;
+ALTER TABLE security_events ADD COLUMN user_id UUID;
+ALTER TABLE one_time_tokens ADD COLUMN user_id UUID;
+ALTER TABLE user_mfa ADD COLUMN user_id UUID;
+ALTER TABLE recovery_codes ADD COLUMN user_id UUID;
+ALTER TABLE webauthn_credentials ADD COLUMN user_id UUID;
+ALTER TABLE webauthn_challenges ADD COLUMN user_id UUID;
+ALTER TABLE magic_links ADD COLUMN user_id UUID;
+ALTER TABLE user_identities ADD COLUMN user_id UUID;
+
+UPDATE Sessions SET user_id = Users.id FROM Users WHERE Users.email = Sessions.user_email;
+UPDATE security_events SET user_id = Users.id FROM Users WHERE Users.email = security_events.user_email;
+UPDATE one_time_tokens SET user_id = Users.id FROM Users WHERE Users.email = one_time_tokens.user_email;
+UPDATE user_mfa SET user_id = Users.id FROM Users WHERE Users.email = user_mfa.user_email;
+UPDATE recovery_codes SET user_id = Users.id FROM Users WHERE Users.email = recovery_codes.user_email;
+UPDATE webauthn_credentials SET user_id = Users.id FROM Users WHERE Users.email = webauthn_credentials.user_email;
+UPDATE webauthn_challenges SET user_id = Users.id FROM Users WHERE Users.email = webauthn_challenges.user_email;
+UPDATE magic_links SET user_id = Users.id FROM Users WHERE Users.email = magic_links.user_email;
+UPDATE user_identities SET user_id = Users.id FROM Users WHERE Users.email = user_identities.user_email;
+
+-- events of users deleted before the migration can't be attributed anymore
+DELETE FROM security_events WHERE user_id IS NULL;
+
+-- dropping the columns drops their foreign keys to Users (email) too
+ALTER TABLE Sessions DROP COLUMN user_email;
+ALTER TABLE security_events DROP COLUMN user_email;
+ALTER TABLE one_time_tokens DROP COLUMN user_email;
+ALTER TABLE user_mfa DROP COLUMN user_email;
+ALTER TABLE recovery_codes DROP COLUMN user_email;
+ALTER TABLE webauthn_credentials DROP COLUMN user_email;
+ALTER TABLE webauthn_challenges DROP COLUMN user_email;
+ALTER TABLE magic_links DROP COLUMN user_email;
+ALTER TABLE user_identities DROP COLUMN user_email;
+
+ALTER TABLE Users DROP CONSTRAINT users_pkey;
+ALTER TABLE Users ADD PRIMARY KEY (id);
+ALTER TABLE Users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE Sessions ALTER COLUMN user_id SET NOT NULL, ADD FOREIGN KEY (user_id) REFERENCES Users (id);
+ALTER TABLE security_events ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE one_time_tokens ALTER COLUMN user_id SET NOT NULL,
+ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE user_mfa ADD PRIMARY KEY (user_id), ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE recovery_codes ALTER COLUMN user_id SET NOT NULL,
+ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE webauthn_credentials ALTER COLUMN user_id SET NOT NULL,
+ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE webauthn_challenges ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE magic_links ALTER COLUMN user_id SET NOT NULL,
+ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE;
+ALTER TABLE user_identities ALTER COLUMN user_id SET NOT NULL,
+ADD FOREIGN KEY (user_id) REFERENCES Users (id) ON DELETE CASCADE, ADD UNIQUE (user_id, provider);
+
+CREATE INDEX sessions_user_id_idx ON Sessions (user_id);
+CREATE INDEX security_events_user_id_idx ON security_events (user_id);
+CREATE INDEX one_time_tokens_user_id_idx ON one_time_tokens (user_id);
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+CREATE INDEX magic_links_user_id_idx ON magic_links (user_id);
+
+-- the address an email change token is for, the new one to confirm or the
+-- old one to restore
+ALTER TABLE one_time_tokens ADD COLUMN email TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Emails are queued in the transaction that needs them and delivered by the
+-- outbox worker, so a slow or failing mail server doesn't affect the request.
+CREATE TABLE email_outbox(
+id BIGSERIAL PRIMARY KEY,
+recipient TEXT NOT NULL,
+subject TEXT NOT NULL,
+text_body TEXT NOT NULL,
+html_body TEXT NOT NULL,
+attempts INTEGER NOT NULL DEFAULT 0,
+last_error TEXT NOT NULL DEFAULT '',
+next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+dead_at TIMESTAMPTZ,
+created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX email_outbox_due ON email_outbox (next_attempt_at) WHERE dead_at IS NULL;
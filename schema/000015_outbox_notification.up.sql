@@ -0,0 +1,2 @@
+-- Notifications get a List-Unsubscribe header when they're sent.
+ALTER TABLE email_outbox ADD COLUMN notification BOOLEAN NOT NULL DEFAULT FALSE;
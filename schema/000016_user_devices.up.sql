@@ -0,0 +1,11 @@
+-- Devices a user ever signed in on. Unlike Sessions the rows are never swept,
+-- so signing out doesn't make a device new again.
+CREATE TABLE user_devices(
+user_id UUID NOT NULL REFERENCES Users (id) ON DELETE CASCADE,
+device_id TEXT NOT NULL,
+first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+PRIMARY KEY (user_id, device_id)
+);
+
+INSERT INTO user_devices (user_id, device_id, first_seen_at)
+SELECT user_id, deviceID, MIN(created_at) FROM Sessions GROUP BY user_id, deviceID;
@@ -0,0 +1,7 @@
+-- Codes tried with each MFA challenge token, so one token allows only a few
+-- guesses.
+CREATE TABLE mfa_challenges(
+token_id TEXT PRIMARY KEY,
+attempts INTEGER NOT NULL DEFAULT 0,
+expires_at TIMESTAMPTZ NOT NULL
+);
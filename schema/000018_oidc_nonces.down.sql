@@ -0,0 +1 @@
+DROP TABLE oidc_nonces;
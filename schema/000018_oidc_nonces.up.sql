@@ -0,0 +1,5 @@
+-- Nonces issued for Apple and Google sign in, each accepted once.
+CREATE TABLE oidc_nonces(
+nonce TEXT PRIMARY KEY,
+expires_at TIMESTAMPTZ NOT NULL
+);
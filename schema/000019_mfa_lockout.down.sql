@@ -0,0 +1,3 @@
+ALTER TABLE user_mfa
+DROP COLUMN failed_attempts,
+DROP COLUMN locked_until;
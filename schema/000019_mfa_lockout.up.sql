@@ -0,0 +1,5 @@
+-- Failed second factor codes of the user. Unlike failed_attempts of Users they
+-- survive a correct password, so logging in again gives no new guesses.
+ALTER TABLE user_mfa
+ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN locked_until TIMESTAMPTZ;
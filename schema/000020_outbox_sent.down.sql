@@ -0,0 +1,6 @@
+DELETE FROM email_outbox WHERE sent_at IS NOT NULL;
+
+DROP INDEX email_outbox_due;
+CREATE INDEX email_outbox_due ON email_outbox (next_attempt_at) WHERE dead_at IS NULL;
+
+ALTER TABLE email_outbox DROP COLUMN sent_at;
@@ -0,0 +1,6 @@
+-- A delivered email is kept as sent_at without its bodies, they hold live links
+-- and codes. Storage.Clear drops it after the outbox retention.
+ALTER TABLE email_outbox ADD COLUMN sent_at TIMESTAMPTZ;
+
+DROP INDEX email_outbox_due;
+CREATE INDEX email_outbox_due ON email_outbox (next_attempt_at) WHERE dead_at IS NULL AND sent_at IS NULL;
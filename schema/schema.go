@@ -0,0 +1,8 @@
+// Package schema embeds the SQL migrations into the binary. Every version has
+// an NNNNNN_name.up.sql and NNNNNN_name.down.sql file.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS
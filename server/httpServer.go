@@ -3,36 +3,127 @@ package server
 import (
 	"DiaSync/config"
 	"DiaSync/controller"
+	"DiaSync/mailer"
+	"DiaSync/middleware"
 	"DiaSync/repository"
 	"DiaSync/service"
+	"DiaSync/utils"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitRouter(storage *Storage) *gin.Engine {
+func InitRouter(cfg config.Config, storage *Storage) *gin.Engine {
 	authRepository := repository.NewAuthRepository(storage.db)
 	authService := service.NewAuthService(authRepository)
 	authController := controller.NewAuthController(authService)
 
-	router := gin.New()
+	var limiter middleware.RateLimiter = middleware.NewMemoryRateLimiter()
+
+	if cfg.RateLimit.Store == "postgres" {
+		limiter = repository.NewRateLimitRepository(storage.db)
+	}
+
+	limit := func(route string) gin.HandlerFunc {
+		return middleware.RateLimit(limiter, route, cfg.RateLimit)
+	}
+
+	router := newRouter(cfg.HttpServer)
+
+	router.GET("/.well-known/jwks.json", controller.JWKS)
+	router.GET("/.well-known/apple-app-site-association", controller.AppleAppSiteAssociation)
+	router.GET("/.well-known/assetlinks.json", controller.AssetLinks)
 
 	auth := router.Group("/auth")
 
 	{
-		auth.POST("/signup", authController.Signup) // request --> email, password, role
+		auth.POST("/signup", authController.Signup) // request --> email, password, role, invite_token
 		auth.POST("/verify-email", authController.VerifyEmail)
-		auth.POST("/login", authController.Login)   // email password device_id
-		auth.POST("/logout", authController.Logout) // refresh_token
+		auth.POST("/login", limit("/auth/login"), authController.Login)            // email password device_id device_name platform
+		auth.POST("/login/mfa", limit("/auth/login/mfa"), authController.LoginMFA) // mfa_token, code
+		auth.POST("/login/mfa/enroll", authController.EnrollTOTPChallenge)         // mfa_token
+		auth.POST("/logout", authController.Logout)                                // refresh_token
 		auth.POST("/replacement-token", authController.ReplacementTokens)
-		auth.POST("/reset-password", authController.ResetPassword) // email, new_password
-		auth.POST("/verify-newpassword", authController.VerifyNewPassword)
-		auth.POST("/repeat-verify-email", authController.RepeatEmailVerify)
+		auth.POST("/reset-password", limit("/auth/reset-password"), authController.ResetPassword) // email
+		auth.POST("/verify-newpassword", authController.VerifyNewPassword)                        // token, new_password
+		auth.POST("/repeat-verify-email", limit("/auth/repeat-verify-email"), authController.RepeatEmailVerify)
+		auth.POST("/webauthn/login/begin", authController.BeginPasskeyLogin)                             // email (optional)
+		auth.POST("/webauthn/login/finish", authController.FinishPasskeyLogin)                           // challenge_id, credential, device_id
+		auth.POST("/magic-link", limit("/auth/magic-link"), authController.SendMagicLink)                // email, device_id
+		auth.POST("/magic-link/verify", limit("/auth/magic-link/verify"), authController.LoginMagicLink) // token or email and code, device_id
+		auth.POST("/oidc/nonce", limit("/auth/oidc/nonce"), authController.BeginOIDCLogin)               // returns nonce
+		auth.POST("/oidc", authController.LoginOIDC)                                                     // provider, id_token, nonce, device_id
+		auth.POST("/confirm-email-change", authController.ConfirmEmailChange)                            // token (query)
+		auth.POST("/undo-email-change", authController.UndoEmailChange)                                  // token (query)
+		auth.POST("/secure-account", authController.SecureAccount)                                       // token (query)
+	}
+
+	// the emailed links open a page confirming the action, see LinkPage
+	for _, path := range utils.LinkPaths {
+		router.GET(path, authController.LinkPage)
+	}
+
+	// every endpoint below requires a valid access token
+	protected := router.Group("", middleware.RequireAuth(authService))
+
+	{
+		protected.GET("/me", authController.Me)
+		protected.POST("/me/password", authController.ChangePassword)               // current_password, new_password
+		protected.POST("/me/email", limit("/me/email"), authController.ChangeEmail) // new_email, password
+		protected.GET("/me/sessions", authController.ListSessions)
+		protected.DELETE("/me/sessions/:id", authController.RevokeSession)
+		protected.POST("/me/sessions/revoke-others", authController.RevokeOtherSessions)
+		protected.POST("/me/mfa/totp", authController.EnrollTOTP)
+		protected.POST("/me/mfa/totp/confirm", authController.ConfirmTOTP)               // code
+		protected.POST("/me/mfa/disable", authController.DisableMFA)                     // code
+		protected.POST("/me/mfa/recovery-codes", authController.RegenerateRecoveryCodes) // code
+		protected.POST("/auth/webauthn/register/begin", authController.BeginPasskeyRegistration)
+		protected.POST("/auth/webauthn/register/finish", authController.FinishPasskeyRegistration) // challenge_id, name, credential
+		protected.GET("/me/identities", authController.ListIdentities)
+		protected.POST("/me/identities", authController.LinkIdentity) // provider, id_token, nonce
+		protected.DELETE("/me/identities/:provider", authController.UnlinkIdentity)
+	}
+
+	admin := protected.Group("/admin")
+
+	{
+		admin.PUT("/users/role", middleware.RequirePermission(utils.PermUsersManage), authController.ChangeRole) // email, role
+		admin.POST("/invitations", middleware.RequirePermission(utils.PermInvitationCreate), authController.CreateInvitation)
+		admin.POST("/users/lock", middleware.RequirePermission(utils.PermUsersManage), authController.LockUser)     // email
+		admin.POST("/users/unlock", middleware.RequirePermission(utils.PermUsersManage), authController.UnlockUser) // email
+		admin.GET("/emails", middleware.RequirePermission(utils.PermEmailsManage), authController.ListFailedEmails)
+		admin.POST("/emails/:id/retry", middleware.RequirePermission(utils.PermEmailsManage), authController.RetryEmail)
 	}
 
 	return router
 }
 
+// newRouter returns an engine taking the client IP, which keys the rate limits
+// and is stored with the sessions, from X-Forwarded-For only behind the
+// trusted proxies.
+func newRouter(cfg config.HttpServer) *gin.Engine {
+	router := gin.New()
+
+	err := router.SetTrustedProxies(cfg.TrustedProxies)
+
+	if err != nil {
+		panic("Invalid trusted_proxies: " + err.Error())
+	}
+
+	return router
+}
+
+// InitOutbox returns the worker delivering the queued emails.
+func InitOutbox(cfg config.Config, storage *Storage) *service.OutboxWorker {
+	sender, err := mailer.New(cfg.Email)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return service.NewOutboxWorker(repository.NewAuthRepository(storage.db), sender)
+}
+
 func InitHttpServer(cfg config.Config, router http.Handler) *http.Server {
 	server := &http.Server{
 		Addr:         cfg.ServerAdr,
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"DiaSync/config"
+	"DiaSync/middleware"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRouter_ForwardedFor(t *testing.T) {
+	limits := config.RateLimit{Routes: map[string]config.RouteLimit{
+		"/auth/login": {IP: config.Limit{Requests: 1, Period: 60}},
+	}}
+
+	var testCases = []struct {
+		name               string
+		trustedProxies     []string
+		remoteAddr         string
+		expectedStatusCode int
+	}{
+		{"Untrusted peer", nil, "192.0.2.1:1234", 429},
+		{"Trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.1:1234", 200},
+		{"Peer outside the trusted proxies", []string{"10.0.0.0/8"}, "192.0.2.1:1234", 429},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(config.HttpServer{TrustedProxies: tt.trustedProxies})
+			router.POST("/auth/login", middleware.RateLimit(middleware.NewMemoryRateLimiter(), "/auth/login", limits),
+				func(context *gin.Context) {
+					context.String(200, context.ClientIP())
+				})
+
+			var code int
+
+			// every request claims another client, only a trusted proxy is believed
+			for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/auth/login", nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Forwarded-For", ip)
+
+				router.ServeHTTP(w, req)
+				code = w.Code
+			}
+
+			if code != tt.expectedStatusCode {
+				t.Errorf("got = %d expected = %d", code, tt.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestNewRouter_InvalidTrustedProxies(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an invalid trusted proxy must panic")
+		}
+	}()
+
+	newRouter(config.HttpServer{TrustedProxies: []string{"not an address"}})
+}
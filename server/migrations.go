@@ -0,0 +1,555 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID is the key of the advisory lock held while migrating, so
+// instances started at the same time apply every migration once.
+const migrationLockID = 4_417_203_915
+
+var (
+	ErrSchemaBehind  = errors.New("database schema is behind the server")
+	ErrSchemaAhead   = errors.New("database schema is newer than the server")
+	ErrNoMigration   = errors.New("unknown migration version")
+	ErrBadMigrations = errors.New("invalid migration files")
+	ErrUnknownSchema = errors.New("database schema isn't tracked and doesn't match the first migration")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a known or applied migration. AppliedAt is nil for a
+// pending one, Known is false for a version applied by a newer server.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Known     bool
+}
+
+// LoadMigrations reads the NNNNNN_name.up.sql and NNNNNN_name.down.sql pairs
+// and returns them ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+
+	for _, file := range files {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("%w: %s", ErrBadMigrations, file)
+		}
+
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(number, 10, 64)
+
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrBadMigrations, file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != name {
+			return nil, fmt.Errorf("%w: %s and %s share version %d", ErrBadMigrations, migration.Name, name, version)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%w: %06d_%s needs an up and a down file", ErrBadMigrations, migration.Version,
+				migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator applies the embedded migrations. The applied versions are kept in
+// schema_migrations, the schema is at the highest one.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version the server expects.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Check returns ErrSchemaBehind or ErrSchemaAhead unless the database is at
+// the latest version.
+func (m *Migrator) Check() error {
+	version, err := m.currentVersion()
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < m.Latest():
+		return fmt.Errorf("%w: at version %d, expected %d, run `diasync migrate up`", ErrSchemaBehind, version,
+			m.Latest())
+	case version > m.Latest():
+		return fmt.Errorf("%w: at version %d, expected %d", ErrSchemaAhead, version, m.Latest())
+	}
+
+	return nil
+}
+
+// currentVersion reads the version without creating schema_migrations, a
+// database never migrated is at version zero.
+func (m *Migrator) currentVersion() (int64, error) {
+	var exists bool
+
+	err := m.db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists)
+
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int64
+
+	err = m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version)
+
+	return version, err
+}
+
+func (m *Migrator) Up() error {
+	return m.Goto(m.Latest())
+}
+
+// Down reverts the last applied migration.
+func (m *Migrator) Down() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		version, err := m.adoptedVersion(conn)
+
+		if err != nil || version == 0 {
+			return err
+		}
+
+		if version > m.Latest() {
+			return fmt.Errorf("%w: at version %d, the server knows up to %d", ErrSchemaAhead, version, m.Latest())
+		}
+
+		index, err := m.index(version)
+
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(conn, version, m.previous(index))
+	})
+}
+
+// Goto applies or reverts migrations until the schema is at the version.
+// Version zero reverts every migration.
+func (m *Migrator) Goto(target int64) error {
+	if _, err := m.index(target); err != nil {
+		return err
+	}
+
+	return m.withLock(func(conn *sql.Conn) error {
+		version, err := m.adoptedVersion(conn)
+
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(conn, version, target)
+	})
+}
+
+// Force records the database as being at the version without running any
+// migration, e.g. after fixing a failed migration by hand.
+func (m *Migrator) Force(target int64) error {
+	if _, err := m.index(target); err != nil {
+		return err
+	}
+
+	return m.withLock(func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(context.Background(), nil)
+
+		if err != nil {
+			return err
+		}
+
+		defer tx.Rollback()
+
+		_, err = tx.Exec("DELETE FROM schema_migrations;")
+
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > target {
+				break
+			}
+
+			_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES($1, $2);", migration.Version,
+				migration.Name)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status lists every known migration and every applied one the server
+// doesn't know, ordered by version. It only reads, a database never migrated
+// has every migration pending.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	statuses := map[int64]*MigrationStatus{}
+
+	for _, migration := range m.migrations {
+		statuses[migration.Version] = &MigrationStatus{Version: migration.Version, Name: migration.Name, Known: true}
+	}
+
+	err := m.readApplied(statuses)
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]MigrationStatus, 0, len(statuses))
+
+	for _, status := range statuses {
+		list = append(list, *status)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// readApplied marks the applied migrations in statuses, adding the ones it
+// doesn't have.
+func (m *Migrator) readApplied(statuses map[int64]*MigrationStatus) error {
+	var exists bool
+
+	err := m.db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists)
+
+	if err != nil || !exists {
+		return err
+	}
+
+	rows, err := m.db.Query("SELECT version, name, applied_at FROM schema_migrations;")
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var applied MigrationStatus
+		var appliedAt time.Time
+
+		err = rows.Scan(&applied.Version, &applied.Name, &appliedAt)
+
+		if err != nil {
+			return err
+		}
+
+		status, known := statuses[applied.Version]
+
+		if !known {
+			status = &applied
+			statuses[applied.Version] = status
+		}
+
+		status.AppliedAt = &appliedAt
+	}
+
+	return rows.Err()
+}
+
+// withLock runs f on a connection holding the migration lock. The lock is
+// bound to the connection, so it is released even if the process dies.
+func (m *Migrator) withLock(f func(*sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationLockID)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// adoptBaseline records the first migration for a database created before
+// migrations were tracked. Such a database has exactly the tables of
+// 000001_init and nothing applied, the later migrations still have to run.
+// Any other untracked schema is refused, its version can't be told.
+func (m *Migrator) adoptBaseline(conn *sql.Conn) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+
+	var legacy bool
+
+	err := conn.QueryRowContext(context.Background(), `SELECT to_regclass('users') IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM schema_migrations);`).Scan(&legacy)
+
+	if err != nil || !legacy {
+		return err
+	}
+
+	matches, err := m.matchesBaseline(conn)
+
+	if err != nil {
+		return err
+	}
+
+	if !matches {
+		return fmt.Errorf("%w: %06d_%s, record the version the schema is at with `diasync migrate force -version <n>`",
+			ErrUnknownSchema, m.migrations[0].Version, m.migrations[0].Name)
+	}
+
+	_, err = conn.ExecContext(context.Background(), "INSERT INTO schema_migrations (version, name) VALUES($1, $2);",
+		m.migrations[0].Version, m.migrations[0].Name)
+
+	return err
+}
+
+// matchesBaseline compares the columns of the current schema with the ones the
+// first migration creates in an empty schema, which is rolled back.
+func (m *Migrator) matchesBaseline(conn *sql.Conn) (bool, error) {
+	tx, err := conn.BeginTx(context.Background(), nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	legacy, err := schemaColumns(tx)
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("CREATE SCHEMA schema_migrations_baseline; SET LOCAL search_path TO schema_migrations_baseline;")
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(m.migrations[0].Up)
+
+	if err != nil {
+		return false, fmt.Errorf("migration %06d_%s.up.sql: %w", m.migrations[0].Version, m.migrations[0].Name, err)
+	}
+
+	baseline, err := schemaColumns(tx)
+
+	return legacy == baseline, err
+}
+
+// schemaColumns lists the tables and columns of the current schema with their
+// types, without schema_migrations.
+func schemaColumns(tx *sql.Tx) (string, error) {
+	var columns string
+
+	err := tx.QueryRow(`SELECT COALESCE(string_agg(table_name || '.' || column_name || ' ' || data_type, ', '
+		ORDER BY table_name, column_name), '') FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations';`).Scan(&columns)
+
+	return columns, err
+}
+
+// adoptedVersion returns the version of the schema after adopting a database
+// created before migrations were tracked. Force doesn't adopt, it is how an
+// untracked schema that can't be adopted gets its version.
+func (m *Migrator) adoptedVersion(conn *sql.Conn) (int64, error) {
+	err := m.adoptBaseline(conn)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return schemaVersion(conn)
+}
+
+func schemaVersion(conn *sql.Conn) (int64, error) {
+	var version int64
+
+	err := conn.QueryRowContext(context.Background(),
+		"SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version)
+
+	return version, err
+}
+
+// migrate moves the schema from one known version to another, every step in
+// its own transaction. A failed step leaves the schema at the previous one.
+func (m *Migrator) migrate(conn *sql.Conn, from, to int64) error {
+	if from > m.Latest() {
+		return fmt.Errorf("%w: at version %d, the server knows up to %d", ErrSchemaAhead, from, m.Latest())
+	}
+
+	if _, err := m.index(from); err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > from && migration.Version <= to {
+			err := m.apply(conn, migration, true)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+
+		if migration.Version <= from && migration.Version > to {
+			err := m.apply(conn, migration, false)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	script, direction := migration.Up, "up"
+
+	if !up {
+		script, direction = migration.Down, "down"
+	}
+
+	_, err = tx.Exec(script)
+
+	if err != nil {
+		return fmt.Errorf("migration %06d_%s.%s.sql: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES($1, $2);", migration.Version,
+			migration.Name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1;", migration.Version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// index returns the position of the version in the migrations, -1 for zero.
+func (m *Migrator) index(version int64) (int, error) {
+	if version == 0 {
+		return -1, nil
+	}
+
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %d", ErrNoMigration, version)
+}
+
+// previous returns the version before the migration at index.
+func (m *Migrator) previous(index int) int64 {
+	if index == 0 {
+		return 0
+	}
+
+	return m.migrations[index-1].Version
+}
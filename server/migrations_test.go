@@ -0,0 +1,312 @@
+package server
+
+import (
+	"DiaSync/schema"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	var testCases = []struct {
+		name             string
+		files            fstest.MapFS
+		expectedVersions []int64
+		expectedErr      error
+	}{
+		{
+			name: "Ordered by version",
+			files: fstest.MapFS{
+				"000010_b.up.sql":   file("B"),
+				"000010_b.down.sql": file("-B"),
+				"000002_a.up.sql":   file("A"),
+				"000002_a.down.sql": file("-A"),
+			},
+			expectedVersions: []int64{2, 10},
+		},
+		{
+			name:        "No down file",
+			files:       fstest.MapFS{"000001_a.up.sql": file("A")},
+			expectedErr: ErrBadMigrations,
+		},
+		{
+			name: "Shared version",
+			files: fstest.MapFS{
+				"000001_a.up.sql":   file("A"),
+				"000001_a.down.sql": file("-A"),
+				"000001_b.up.sql":   file("B"),
+				"000001_b.down.sql": file("-B"),
+			},
+			expectedErr: ErrBadMigrations,
+		},
+		{
+			name:        "Bad name",
+			files:       fstest.MapFS{"init.up.sql": file("A")},
+			expectedErr: ErrBadMigrations,
+		},
+		{
+			name:        "Bad direction",
+			files:       fstest.MapFS{"000001_a.sideways.sql": file("A")},
+			expectedErr: ErrBadMigrations,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.files)
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("got %v, want %v", err, tt.expectedErr)
+			}
+
+			if len(migrations) != len(tt.expectedVersions) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.expectedVersions))
+			}
+
+			for i, migration := range migrations {
+				if migration.Version != tt.expectedVersions[i] {
+					t.Errorf("got version %d, want %d", migration.Version, tt.expectedVersions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil, schema.Migrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrator.Latest() != int64(len(migrator.migrations)) {
+		t.Errorf("latest %d with %d migrations, versions must have no gaps", migrator.Latest(),
+			len(migrator.migrations))
+	}
+
+	if migrator.migrations[0].Name != "init" || migrator.migrations[0].Up == "" {
+		t.Errorf("unexpected first migration %+v", migrator.migrations[0])
+	}
+
+	if _, err := migrator.index(migrator.Latest() + 1); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("got %v, want %v", err, ErrNoMigration)
+	}
+
+	if migrator.previous(0) != 0 || migrator.previous(1) != migrator.migrations[0].Version {
+		t.Error("unexpected previous versions")
+	}
+}
+
+// testDB opens the database of DIASYNC_TEST_DB (key=value connection string)
+// in a new schema, dropped after the test. The test is skipped without one.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("DIASYNC_TEST_DB")
+
+	if dsn == "" {
+		t.Skip("DIASYNC_TEST_DB is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("migrator_test_%d", time.Now().UnixNano())
+
+	_, err = admin.Exec("CREATE SCHEMA " + name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", dsn+" search_path="+name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + name + " CASCADE")
+		admin.Close()
+	})
+
+	return db
+}
+
+var testMigrations = fstest.MapFS{
+	"000001_init.up.sql":   {Data: []byte("CREATE TABLE IF NOT EXISTS users(id INT);")},
+	"000001_init.down.sql": {Data: []byte("DROP TABLE users;")},
+	"000002_b.up.sql":      {Data: []byte("CREATE TABLE b(id INT);")},
+	"000002_b.down.sql":    {Data: []byte("DROP TABLE b;")},
+	"000003_c.up.sql":      {Data: []byte("ALTER TABLE b ADD COLUMN c INT;")},
+	"000003_c.down.sql":    {Data: []byte("ALTER TABLE b DROP COLUMN c;")},
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	var exists bool
+
+	err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL;", table).Scan(&exists)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exists
+}
+
+func expectVersion(t *testing.T, migrator *Migrator, expected int64) {
+	t.Helper()
+
+	version, err := migrator.currentVersion()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != expected {
+		t.Fatalf("got version %d, want %d", version, expected)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db := testDB(t)
+	migrator, err := NewMigrator(db, testMigrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := migrator.Status()
+
+	if err != nil || len(statuses) != 3 || statuses[0].AppliedAt != nil {
+		t.Fatalf("got %v, %v", statuses, err)
+	}
+
+	if tableExists(t, db, "schema_migrations") {
+		t.Error("Status created schema_migrations")
+	}
+
+	if err := migrator.Check(); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("got %v, want %v", err, ErrSchemaBehind)
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 3)
+
+	if err := migrator.Check(); err != nil {
+		t.Error(err)
+	}
+
+	if err := migrator.Down(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 2)
+
+	if _, err := db.Exec("SELECT c FROM b;"); err == nil {
+		t.Error("column c wasn't dropped")
+	}
+
+	if err := migrator.Goto(0); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 0)
+
+	if tableExists(t, db, "users") || tableExists(t, db, "b") {
+		t.Error("tables left after reverting everything")
+	}
+
+	if err := migrator.Force(2); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 2)
+
+	if tableExists(t, db, "b") {
+		t.Error("Force ran a migration")
+	}
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	db := testDB(t)
+
+	// a database created by the server before migrations were tracked
+	_, err := db.Exec("CREATE TABLE users(id INT); INSERT INTO users VALUES(1);")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db, testMigrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 3)
+
+	var users int
+
+	err = db.QueryRow("SELECT count(*) FROM users;").Scan(&users)
+
+	if err != nil || users != 1 {
+		t.Errorf("got %d users, %v", users, err)
+	}
+
+	if _, err := db.Exec("SELECT c FROM b;"); err != nil {
+		t.Errorf("later migrations weren't applied: %v", err)
+	}
+}
+
+func TestMigrator_UnknownSchema(t *testing.T) {
+	db := testDB(t)
+
+	// an untracked database already past the first migration
+	_, err := db.Exec("CREATE TABLE users(id INT); CREATE TABLE b(id INT);")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db, testMigrations)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Up(); !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("got %v, want %v", err, ErrUnknownSchema)
+	}
+
+	expectVersion(t, migrator, 0)
+
+	if tableExists(t, db, "schema_migrations_baseline.users") {
+		t.Error("the baseline schema wasn't rolled back")
+	}
+
+	if err := migrator.Force(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion(t, migrator, 3)
+}
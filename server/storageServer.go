@@ -2,6 +2,8 @@ package server
 
 import (
 	"DiaSync/config"
+	"DiaSync/schema"
+	"DiaSync/utils"
 	"database/sql"
 	"fmt"
 	"time"
@@ -15,10 +17,9 @@ type Storage struct {
 
 var clearPeriod time.Duration
 
-func InitStorage(cfg config.Db) *Storage {
+func OpenDB(cfg config.Db) *sql.DB {
 	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Dbname)
-	var err error
 
 	DB, err := sql.Open("postgres", psqlInfo)
 
@@ -29,40 +30,93 @@ func InitStorage(cfg config.Db) *Storage {
 	DB.SetMaxOpenConns(100)
 	DB.SetMaxIdleConns(5)
 
-	CreateUsersTable(DB)
-	CreateSessionsTable(DB)
+	return DB
+}
 
-	clearPeriod = cfg.ClearPeriod
+// InitStorage refuses to start unless the schema is at the version of the
+// embedded migrations, applying pending ones first if auto_migrate is set.
+func InitStorage(cfg config.Db) *Storage {
+	DB := OpenDB(cfg)
 
-	return &Storage{DB}
-}
+	migrator, err := NewMigrator(DB, schema.Migrations)
+
+	if err != nil {
+		panic(err.Error())
+	}
 
-func CreateUsersTable(DB *sql.DB) {
-	_, err := DB.Exec(`
-	CREATE TABLE IF NOT EXISTS Users(
-	email TEXT PRIMARY KEY,
-	password TEXT NOT NULL,
-	role TEXT NOT NULL,
-	verified BOOLEAN DEFAULT FALSE
-	);`)
+	if cfg.AutoMigrate {
+		err = migrator.Up()
+
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	err = migrator.Check()
 
 	if err != nil {
 		panic(err.Error())
 	}
+
+	clearPeriod = cfg.ClearPeriod
+	storage := &Storage{DB}
+
+	err = storage.sealTOTPSecrets()
+
+	if err != nil {
+		panic("Can't encrypt totp secrets: " + err.Error())
+	}
+
+	return storage
 }
 
-func CreateSessionsTable(DB *sql.DB) {
-	_, err := DB.Exec(`
-	CREATE TABLE IF NOT EXISTS Sessions(
-	refresh_token TEXT PRIMARY KEY,
-	user_email TEXT NOT NULL,
-	deviceID TEXT NOT NULL,
-	FOREIGN KEY (user_email) REFERENCES Users (email)
-	);`)
+// sealTOTPSecrets encrypts the TOTP secrets stored before they were
+// encrypted. The update only matches the plaintext, so concurrent instances
+// don't seal a secret twice.
+func (s *Storage) sealTOTPSecrets() error {
+	rows, err := s.db.Query("SELECT user_id, totp_secret FROM user_mfa WHERE totp_secret NOT LIKE 'v1:%';")
 
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	legacy := map[string]string{}
+
+	for rows.Next() {
+		var userID, secret string
+
+		err = rows.Scan(&userID, &secret)
+
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		legacy[userID] = secret
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for userID, secret := range legacy {
+		sealed, err := utils.SealTOTPSecret(userID, secret)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = s.db.Exec("UPDATE user_mfa SET totp_secret=$1 WHERE user_id=$2 AND totp_secret=$3;", sealed,
+			userID, secret)
+
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
 func (s *Storage) Clear() {
@@ -72,5 +126,38 @@ func (s *Storage) Clear() {
 		if err != nil {
 			panic(err)
 		}
+		_, err = s.db.Exec(`DELETE FROM Sessions WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM one_time_tokens WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM webauthn_challenges WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM magic_links WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM oidc_nonces WHERE expires_at < now()`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM rate_limits WHERE updated_at < now() - interval '1 day'`)
+		if err != nil {
+			panic(err)
+		}
+		_, err = s.db.Exec(`DELETE FROM email_outbox WHERE sent_at < now() - $1 * interval '1 second'
+			OR dead_at < now() - $1 * interval '1 second'`, int64(utils.OutboxRetention().Seconds()))
+		if err != nil {
+			panic(err)
+		}
 	}
 }
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ChangePassword sets a new password after checking the current one. Wrong
+// passwords count towards the lockout like failed logins. Every token of the
+// user is revoked, so the devices have to sign in with the new password, and
+// the user is told by email.
+func (as *AuthService) ChangePassword(principal models.Principal, request models.ChangePasswordR) error {
+	user, err := as.validateCredentials(principal.Email, request.CurrentPassword)
+
+	if err != nil {
+		return err
+	}
+
+	err = utils.CheckPasswordPolicy(request.NewPassword, user.Email)
+
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(request.NewPassword)
+
+	if err != nil {
+		return err
+	}
+
+	err = as.AuthRepository.ChangePassword(user.ID, hashedPassword)
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventPasswordChanged, UserID: user.ID})
+
+	return nil
+}
+
+// ChangeEmail emails a confirmation link to the new address, the email only
+// changes once it is opened. A registered address gets the same response
+// without an email, unless accounts may be revealed.
+func (as *AuthService) ChangeEmail(principal models.Principal, request models.ChangeEmailR) error {
+	defer utils.PadResponseTime(time.Now())
+
+	user, err := as.validateCredentials(principal.Email, request.Password)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = as.AuthRepository.FindUser(request.NewEmail)
+
+	if err == nil {
+		if utils.RevealAccounts() {
+			return ErrEmailTaken
+		}
+
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	tx, err := as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	token, err := as.AuthRepository.CreateEmailChangeToken(tx, user.ID, request.NewEmail)
+
+	if err != nil {
+		return err
+	}
+
+	err = as.queueMail(tx, request.NewEmail, user.Locale, mailer.TemplateEmailChange,
+		mailer.Data{Link: utils.EmailLink(utils.LinkConfirmEmailChange, token), Email: request.NewEmail})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange switches the user to the new address and sends the old
+// one a link to undo the change.
+func (as *AuthService) ConfirmEmailChange(token string) error {
+	tx, err := as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	user, newEmail, undoToken, err := as.AuthRepository.ConfirmEmailChange(tx, token)
+
+	if errors.Is(err, repository.ErrEmailExists) {
+		return ErrEmailTaken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = as.queueMail(tx, user.Email, user.Locale, mailer.TemplateEmailChanged,
+		mailer.Data{Link: utils.EmailLink(utils.LinkUndoEmailChange, undoToken), Email: newEmail})
+
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventEmailChanged, UserID: user.ID})
+
+	return nil
+}
+
+// UndoEmailChange restores the old address and signs the user out everywhere.
+func (as *AuthService) UndoEmailChange(token string) error {
+	_, err := as.AuthRepository.UndoEmailChange(token)
+
+	if errors.Is(err, repository.ErrEmailExists) {
+		return ErrEmailTaken
+	}
+
+	return err
+}
+
+// SecureAccount handles the link of a security alert: every session and
+// emailed link of the user stops working.
+func (as *AuthService) SecureAccount(token string) error {
+	userID, err := as.AuthRepository.SecureAccount(token)
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventAccountSecured, UserID: userID})
+
+	return nil
+}
@@ -1,35 +1,140 @@
 package service
 
 import (
+	"DiaSync/mailer"
 	"DiaSync/models"
 	"DiaSync/repository"
 	"DiaSync/utils"
+	"database/sql"
 	"errors"
-
-	"github.com/golang-jwt/jwt"
+	"time"
 )
 
 //go:generate mockgen -source=auth.go -destination=mocks/mock.go
 type Authorization interface {
 	CreateUser(models.User) error
-	GenerateTokens(models.LoginR) (string, string, error)
+	GenerateTokens(models.LoginR) (models.LoginResult, error)
+	LoginMFA(models.LoginMFAR) (models.LoginResult, error)
+	EnrollTOTPChallenge(models.MFAChallengeR) (models.TOTPEnrollment, error)
 	DeleteSession(models.LogoutR) error
 	ReplacementTokens(models.ReplacementTokensR) (string, string, error)
 	VerifyEmail(string) error
 	ResetPassword(models.ResetPasswordR) error
-	VerifyNewPassword(string) error
+	VerifyNewPassword(models.NewPasswordR) error
 	RepeatEmailVerify(string) error
+	ChangeRole(models.ChangeRoleR) error
+	CreateInvitation(models.InvitationR) error
+	ListSessions(models.Principal) ([]models.SessionInfo, error)
+	RevokeSession(models.Principal, string) error
+	RevokeOtherSessions(models.Principal) error
+	LockUser(models.LockUserR) error
+	UnlockUser(models.LockUserR) error
+	TokenOwner(string) (models.User, error)
+	EnrollTOTP(models.Principal) (models.TOTPEnrollment, error)
+	ConfirmTOTP(models.Principal, models.MFACodeR) ([]string, error)
+	DisableMFA(models.Principal, models.MFACodeR) error
+	RegenerateRecoveryCodes(models.Principal, models.MFACodeR) ([]string, error)
+	BeginPasskeyRegistration(models.Principal) (models.WebAuthnOptions, error)
+	FinishPasskeyRegistration(models.Principal, models.PasskeyRegistrationR) error
+	BeginPasskeyLogin(models.PasskeyLoginBeginR) (models.WebAuthnOptions, error)
+	FinishPasskeyLogin(models.PasskeyLoginR) (models.LoginResult, error)
+	SendMagicLink(models.MagicLinkR) error
+	LoginMagicLink(models.MagicLinkLoginR) (models.LoginResult, error)
+	BeginOIDCLogin() (models.OIDCNonce, error)
+	LoginOIDC(models.OIDCLoginR) (models.LoginResult, error)
+	LinkIdentity(models.Principal, models.LinkIdentityR) error
+	ListIdentities(models.Principal) ([]models.Identity, error)
+	UnlinkIdentity(models.Principal, string) error
+	ChangePassword(models.Principal, models.ChangePasswordR) error
+	ChangeEmail(models.Principal, models.ChangeEmailR) error
+	ConfirmEmailChange(string) error
+	UndoEmailChange(string) error
+	SecureAccount(string) error
+	ListFailedEmails() ([]models.OutboxEmail, error)
+	RetryEmail(int64) error
+}
+
+var (
+	ErrInvalidRole         = errors.New("invalid role")
+	ErrRoleNotAllowed      = errors.New("role not allowed")
+	ErrInvalidInvitation   = errors.New("invalid invitation")
+	ErrTokenReuse          = errors.New("refresh token reuse detected")
+	ErrSessionExpired      = errors.New("session expired")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrAccountLocked       = errors.New("account locked")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrMFANotEnabled       = errors.New("mfa not enabled")
+	ErrMFAAlreadyEnabled   = errors.New("mfa already enabled")
+	ErrMFARequired         = errors.New("mfa is required for the role")
+	ErrMagicLinkDisabled   = errors.New("magic link login is disabled")
+	ErrTooManyAttempts     = errors.New("too many failed attempts")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrEmailTaken          = errors.New("email already registered")
+	ErrEmailNotFound       = errors.New("failed email not found")
+	ErrUserNotFound        = errors.New("user not found")
+
+	ErrIdentityEmailUnverified = errors.New("identity provider didn't verify the email")
+	ErrIdentityConflict        = errors.New("an account with the email exists, sign in to link the identity")
+	ErrIdentityLinked          = errors.New("identity already linked")
+	ErrIdentityNotFound        = errors.New("identity not found")
+)
+
+// LockedOutError is ErrTooManyAttempts with the time left until the user may
+// try again.
+type LockedOutError struct {
+	RetryAfter time.Duration
 }
 
+func (e *LockedOutError) Error() string { return ErrTooManyAttempts.Error() }
+func (e *LockedOutError) Unwrap() error { return ErrTooManyAttempts }
+
+// NewAuthService subscribes the security log and the email notifications to
+// the security events.
 func NewAuthService(authRepository repository.Authorization) Authorization {
-	return &AuthService{authRepository}
+	as := &AuthService{AuthRepository: authRepository}
+	as.Events = NewPublisher(securityLog{as}, emailNotifier{as})
+
+	return as
 }
 
+// AuthService only queues emails, OutboxWorker sends them.
 type AuthService struct {
 	AuthRepository repository.Authorization
+	Events         *Publisher
 }
 
+// CreateUser answers a signup with a registered email like any other signup
+// and tells the owner by email, unless accounts may be revealed.
 func (as *AuthService) CreateUser(user models.User) error {
+	defer utils.PadResponseTime(time.Now())
+
+	err := utils.CheckPasswordPolicy(user.Password, user.Email)
+
+	if err != nil {
+		return err
+	}
+
+	role, err := signupRole(user)
+
+	if err != nil {
+		return err
+	}
+
+	existing, err := as.AuthRepository.FindUser(user.Email)
+
+	if err == nil {
+		if utils.RevealAccounts() {
+			return ErrEmailTaken
+		}
+
+		return as.sendMail(existing.Email, existing.Locale, mailer.TemplateSignupAttempt, mailer.Data{})
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
 	tx, err := as.AuthRepository.BeginTx()
 
 	if err != nil {
@@ -38,160 +143,504 @@ func (as *AuthService) CreateUser(user models.User) error {
 
 	defer tx.Rollback()
 
-	hashedPassword := utils.HashPassword(user.Password)
-	_, err = tx.Exec("INSERT INTO Users (email, password, role) VALUES($1, $2, $3)", user.Email, hashedPassword, user.Role)
+	hashedPassword, err := utils.HashPassword(user.Password)
 
 	if err != nil {
 		return err
 	}
 
-	verifyEmailToken, err := utils.GenerateVerifyEmailToken(user.Email)
+	var userID string
+	locale := mailer.MatchLocale(user.Locale)
+
+	err = tx.QueryRow("INSERT INTO Users (email, password, role, locale) VALUES($1, $2, $3, $4) RETURNING id",
+		user.Email, hashedPassword, role, locale).Scan(&userID)
 
 	if err != nil {
 		return err
 	}
 
-	err = utils.SendVerifyTokenMail(user.Email, verifyEmailToken)
+	verifyEmailToken, err := as.AuthRepository.CreateOneTimeToken(tx, userID, utils.EmailVerifyTokenType)
 
 	if err != nil {
 		return err
 	}
 
-	tx.Commit()
+	err = as.queueMail(tx, user.Email, locale, mailer.TemplateVerifyEmail,
+		mailer.Data{Link: utils.EmailLink(utils.LinkVerifyEmail, verifyEmailToken)})
 
-	return nil
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GenerateTokens issues tokens right away only if the user has no second
+// factor. Otherwise an MFA challenge token is returned, which LoginMFA
+// exchanges for tokens.
+func (as *AuthService) GenerateTokens(userInfo models.LoginR) (models.LoginResult, error) {
+	user, err := as.validateCredentials(userInfo.Email, userInfo.Password)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	device := models.Device{
+		ID:        userInfo.DeviceID,
+		Name:      userInfo.DeviceName,
+		Platform:  userInfo.Platform,
+		IP:        userInfo.IP,
+		UserAgent: userInfo.UserAgent,
+	}
+
+	return as.login(user, device)
+}
+
+// validateCredentials checks the password and translates the repository
+// errors. Only unknown emails can't be locked out, so a lockout looks like a
+// wrong password unless accounts may be revealed. The owner is told when a
+// wrong password locks them out.
+func (as *AuthService) validateCredentials(email, password string) (models.User, error) {
+	user, err := as.AuthRepository.ValidateCredentials(email, password)
+
+	if errors.Is(err, repository.ErrLockoutStarted) {
+		as.publish(SecurityEvent{Type: EventLoginLockedOut, UserID: user.ID})
+
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if errors.Is(err, repository.ErrAccountLocked) {
+		return models.User{}, ErrAccountLocked
+	}
+
+	if errors.Is(err, repository.ErrLockedOut) {
+		if !utils.RevealAccounts() {
+			return models.User{}, ErrInvalidCredentials
+		}
+
+		return models.User{}, &LockedOutError{RetryAfter: time.Until(*user.LockedUntil)}
+	}
+
+	return user, err
 }
 
-func (as *AuthService) GenerateTokens(userInfo models.LoginR) (string, string, error) {
-	var err error
-	userInfo.Role, err = as.AuthRepository.ValidateCredentials(userInfo.Email, userInfo.Password)
+// login finishes a first factor login, asking for the second factor if the
+// user has one or must enroll one.
+func (as *AuthService) login(user models.User, device models.Device) (models.LoginResult, error) {
+	mfa, err := as.findMFA(user.ID)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if mfa.ConfirmedAt != nil || utils.MFARequired(user.Role) {
+		mfaToken, err := utils.GenerateMFAToken(user.ID, device, user.TokenVersion)
+
+		if err != nil {
+			return models.LoginResult{}, err
+		}
+
+		return models.LoginResult{MFAToken: mfaToken, MFAEnrollment: mfa.ConfirmedAt == nil}, nil
+	}
+
+	access_token, refresh_token, err := as.issueTokens(user, device)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	return models.LoginResult{AccessToken: access_token, RefreshToken: refresh_token}, nil
+}
+
+// issueTokens starts a session on the device, the user is told about the
+// first one on a device.
+func (as *AuthService) issueTokens(user models.User, device models.Device) (string, string, error) {
+	access_token, refresh_token, err := as.AuthRepository.GenerateTokens(user, device)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	added, err := as.AuthRepository.AddDevice(user.ID, device.ID)
 
 	if err != nil {
 		return "", "", err
 	}
 
-	return as.AuthRepository.GenerateTokens(userInfo.Email, userInfo.Role, userInfo.DeviceID)
+	if added {
+		as.publish(SecurityEvent{Type: EventNewDevice, UserID: user.ID, Device: device,
+			Details: "device_id=" + device.ID})
+	}
+
+	return access_token, refresh_token, nil
 }
 
 func (as *AuthService) DeleteSession(request models.LogoutR) error {
-	_, err := as.AuthRepository.FindSession(request.RefreshToken)
+	session, err := as.AuthRepository.FindSession(request.RefreshToken)
 
 	if err != nil {
 		return err
 	}
 
-	return as.AuthRepository.DeleteRefreshToken(request.RefreshToken)
+	return as.AuthRepository.DeleteSessionFamily(session.FamilyID)
 }
 
 func (as *AuthService) ReplacementTokens(request models.ReplacementTokensR) (string, string, error) {
 	session, err := as.AuthRepository.FindSession(request.RefreshToken)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
 	if err != nil {
 		return "", "", err
 	}
 
+	if session.RotatedAt != nil {
+		return "", "", as.refreshTokenReused(session)
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return "", "", ErrSessionExpired
+	}
+
 	if session.DeviceID != request.DeviceID {
-		return "", "", errors.New("invalid data")
+		return "", "", ErrInvalidRefreshToken
 	}
 
-	err = as.AuthRepository.DeleteRefreshToken(request.RefreshToken)
+	user, err := as.AuthRepository.FindUserByID(session.UserID)
 
 	if err != nil {
 		return "", "", err
 	}
 
-	user, err := as.AuthRepository.FindUser(session.UserEmail)
+	if user.Locked {
+		return "", "", ErrAccountLocked
+	}
+
+	session.IP = request.IP
+	session.UserAgent = request.UserAgent
+
+	access_token, refresh_token, err := as.AuthRepository.RotateTokens(session, user)
+
+	if errors.Is(err, repository.ErrSessionRotated) {
+		return "", "", as.refreshTokenReused(session)
+	}
+
+	return access_token, refresh_token, err
+}
+
+// refreshTokenReused revokes the whole family: either the legitimate client
+// or an attacker holds a stolen token, and we can't tell which one.
+func (as *AuthService) refreshTokenReused(session models.Session) error {
+	err := as.AuthRepository.RevokeSessionFamily(session.FamilyID)
 
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	return as.AuthRepository.GenerateTokens(user.Email, user.Role, request.DeviceID)
+	as.publish(SecurityEvent{
+		Type:   EventRefreshTokenReuse,
+		UserID: session.UserID,
+		Device: models.Device{ID: session.DeviceID, Name: session.DeviceName, Platform: session.Platform,
+			IP: session.IP, UserAgent: session.UserAgent},
+		Details: "device_id=" + session.DeviceID + " family_id=" + session.FamilyID,
+	})
+
+	return ErrTokenReuse
 }
 
 func (as *AuthService) VerifyEmail(token string) error {
-	err := utils.VerifyToken(token)
+	return as.AuthRepository.VerifyEmail(token)
+}
+
+// ResetPassword emails a single-use link. The new password is only asked for
+// when the link is opened, see VerifyNewPassword. An unknown email gets the
+// same response, without an email.
+func (as *AuthService) ResetPassword(request models.ResetPasswordR) error {
+	defer utils.PadResponseTime(time.Now())
+
+	user, err := as.AuthRepository.FindUser(request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 
 	if err != nil {
 		return err
 	}
 
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	return as.sendOneTimeToken(user, utils.PasswordResetTokenType, mailer.TemplatePasswordReset,
+		utils.LinkResetPassword)
+}
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
+func (as *AuthService) VerifyNewPassword(request models.NewPasswordR) error {
+	email, err := as.AuthRepository.OneTimeTokenEmail(request.Token, utils.PasswordResetTokenType)
 
-		return []byte(utils.SecretKey), nil
-	})
+	if err != nil {
+		return err
+	}
+
+	err = utils.CheckPasswordPolicy(request.NewPassword, email)
 
 	if err != nil {
 		return err
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	hashedNewPassword, err := utils.HashPassword(request.NewPassword)
 
-	if !ok {
-		return errors.New("invalid token claims")
+	if err != nil {
+		return err
 	}
 
-	email := claims["email"].(string)
+	err = as.AuthRepository.ResetPassword(request.Token, hashedNewPassword)
 
-	return as.AuthRepository.VerifyEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := as.AuthRepository.FindUser(email)
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventPasswordChanged, UserID: user.ID})
+
+	return nil
 }
 
-func (as *AuthService) ResetPassword(request models.ResetPasswordR) error {
-	hashedNewPassword := utils.HashPassword(request.NewPassword)
+// RepeatEmailVerify sends a new link only to an unverified user, but answers
+// every email the same way.
+func (as *AuthService) RepeatEmailVerify(email string) error {
+	defer utils.PadResponseTime(time.Now())
 
-	newPasswordToken, err := utils.GeneratePasswordToken(request.Email, hashedNewPassword)
+	user, err := as.AuthRepository.FindUser(email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return utils.SendNewPasswordEmail(request.Email, newPasswordToken)
+	if user.Verified {
+		return nil
+	}
+
+	return as.sendOneTimeToken(user, utils.EmailVerifyTokenType, mailer.TemplateVerifyEmail, utils.LinkVerifyEmail)
 }
 
-func (as *AuthService) VerifyNewPassword(token string) error {
-	err := utils.VerifyToken(token)
+// sendOneTimeToken stores a new token and queues the email with the link to
+// the path.
+func (as *AuthService) sendOneTimeToken(user models.User, purpose, template, path string) error {
+	tx, err := as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	token, err := as.AuthRepository.CreateOneTimeToken(tx, user.ID, purpose)
 
 	if err != nil {
 		return err
 	}
 
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	err = as.queueMail(tx, user.Email, user.Locale, template, mailer.Data{Link: utils.EmailLink(path, token)})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// signupRole returns the role granted by the invitation or the requested
+// self-service role. Patient is the default.
+func signupRole(user models.User) (string, error) {
+	if user.InviteToken != "" {
+		var claims utils.InviteClaims
+
+		err := utils.ParseToken(user.InviteToken, &claims)
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
+		if err != nil || claims.Email != user.Email || !utils.IsValidRole(claims.Role) {
+			return "", ErrInvalidInvitation
 		}
 
-		return []byte(utils.SecretKey), nil
-	})
+		return claims.Role, nil
+	}
+
+	if user.Role == "" {
+		return utils.RolePatient, nil
+	}
+
+	if !utils.IsSelfServiceRole(user.Role) {
+		return "", ErrRoleNotAllowed
+	}
+
+	return user.Role, nil
+}
+
+func (as *AuthService) ChangeRole(request models.ChangeRoleR) error {
+	if !utils.IsValidRole(request.Role) {
+		return ErrInvalidRole
+	}
+
+	user, err := as.AuthRepository.FindUser(request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
 
 	if err != nil {
 		return err
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	return as.AuthRepository.ChangeRole(user.ID, request.Role)
+}
 
-	if !ok {
-		return errors.New("invalid token claims")
+func (as *AuthService) CreateInvitation(request models.InvitationR) error {
+	if !utils.IsValidRole(request.Role) {
+		return ErrInvalidRole
 	}
 
-	email := claims["email"].(string)
-	hashedNewPassword := claims["hashed_password"].(string)
+	inviteToken, err := utils.GenerateInviteToken(request.Email, request.Role)
 
-	return as.AuthRepository.SetPassword(email, hashedNewPassword)
+	if err != nil {
+		return err
+	}
+
+	return as.sendMail(request.Email, request.Locale, mailer.TemplateInvitation,
+		mailer.Data{Role: request.Role, Code: inviteToken})
 }
 
-func (as *AuthService) RepeatEmailVerify(email string) error {
-	verifyEmailToken, err := utils.GenerateVerifyEmailToken(email)
+// queueMail renders the template in the locale and queues it for the address
+// in the transaction.
+func (as *AuthService) queueMail(tx *sql.Tx, to, locale, template string, data mailer.Data) error {
+	email, err := mailer.Render(template, locale, data)
+
+	if err != nil {
+		return err
+	}
+
+	return as.AuthRepository.QueueEmail(tx, models.OutboxEmail{To: to, Subject: email.Subject, Text: email.Text,
+		HTML: email.HTML, Notification: email.Notification})
+}
+
+// sendMail queues an email that doesn't belong to another change.
+func (as *AuthService) sendMail(to, locale, template string, data mailer.Data) error {
+	tx, err := as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = as.queueMail(tx, to, locale, template, data)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (as *AuthService) ListSessions(principal models.Principal) ([]models.SessionInfo, error) {
+	sessions, err := as.AuthRepository.ListSessions(principal.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]models.SessionInfo, 0, len(sessions))
+
+	for _, session := range sessions {
+		infos = append(infos, models.SessionInfo{
+			ID:         session.FamilyID,
+			DeviceID:   session.DeviceID,
+			DeviceName: session.DeviceName,
+			Platform:   session.Platform,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.FamilyID == principal.SessionID,
+		})
+	}
+
+	return infos, nil
+}
+
+func (as *AuthService) RevokeSession(principal models.Principal, sessionID string) error {
+	err := as.AuthRepository.DeleteUserSession(principal.ID, sessionID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+
+	return err
+}
+
+func (as *AuthService) RevokeOtherSessions(principal models.Principal) error {
+	return as.AuthRepository.DeleteOtherSessions(principal.ID, principal.SessionID)
+}
+
+func (as *AuthService) LockUser(request models.LockUserR) error {
+	user, err := as.AuthRepository.FindUser(request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = as.AuthRepository.LockUser(user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventAccountLocked, UserID: user.ID})
+
+	return nil
+}
+
+func (as *AuthService) UnlockUser(request models.LockUserR) error {
+	user, err := as.AuthRepository.FindUser(request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return utils.SendVerifyTokenMail(email, verifyEmailToken)
+	return as.AuthRepository.UnlockUser(user.ID)
+}
+
+// TokenOwner returns the active user an access token was issued to. Tokens
+// carrying another token version than the user's were revoked.
+func (as *AuthService) TokenOwner(userID string) (models.User, error) {
+	user, err := as.AuthRepository.FindUserByID(userID)
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if user.Locked {
+		return models.User{}, ErrAccountLocked
+	}
+
+	return user, nil
 }
@@ -0,0 +1,478 @@
+package service
+
+import (
+	"DiaSync/config"
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// txDriver lets the service open real *sql.Tx values without a database.
+// Every statement succeeds and every query returns one row with the id "u1".
+type txDriver struct{}
+
+type txConn struct{}
+
+type txStmt struct{}
+
+type idRows struct{ done bool }
+
+func (txDriver) Open(string) (driver.Conn, error)         { return txConn{}, nil }
+func (txConn) Prepare(string) (driver.Stmt, error)        { return txStmt{}, nil }
+func (txConn) Close() error                               { return nil }
+func (txConn) Begin() (driver.Tx, error)                  { return txConn{}, nil }
+func (txConn) Commit() error                              { return nil }
+func (txConn) Rollback() error                            { return nil }
+func (txStmt) Close() error                               { return nil }
+func (txStmt) NumInput() int                              { return -1 }
+func (txStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (txStmt) Query([]driver.Value) (driver.Rows, error)  { return &idRows{}, nil }
+func (r *idRows) Columns() []string                       { return []string{"id"} }
+func (r *idRows) Close() error                            { return nil }
+
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0] = "u1"
+
+	return nil
+}
+
+func init() {
+	sql.Register("service-test", txDriver{})
+}
+
+// mailRepository knows the users in users and keeps the queued emails as the
+// outbox does, the rest of repository.Authorization isn't used.
+type mailRepository struct {
+	repository.Authorization
+	db     *sql.DB
+	users  map[string]models.User
+	emails []models.OutboxEmail
+}
+
+func newMailRepository(users ...models.User) *mailRepository {
+	db, _ := sql.Open("service-test", "")
+	repo := &mailRepository{db: db, users: map[string]models.User{}}
+
+	for _, user := range users {
+		repo.users[user.Email] = user
+	}
+
+	return repo
+}
+
+func (r *mailRepository) BeginTx() (*sql.Tx, error) {
+	return r.db.Begin()
+}
+
+func (r *mailRepository) FindUser(email string) (models.User, error) {
+	user, ok := r.users[email]
+
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (r *mailRepository) CreateOneTimeToken(tx *sql.Tx, userID, purpose string) (string, error) {
+	return purpose + "-token", nil
+}
+
+func (r *mailRepository) QueueEmail(tx *sql.Tx, email models.OutboxEmail) error {
+	email.ID = int64(len(r.emails) + 1)
+	r.emails = append(r.emails, email)
+
+	return nil
+}
+
+func (r *mailRepository) ClaimEmails(limit int, leaseUntil time.Time) ([]models.OutboxEmail, error) {
+	emails := r.emails
+	r.emails = nil
+
+	return emails, nil
+}
+
+func (r *mailRepository) MarkEmailSent(id int64) error {
+	return nil
+}
+
+// sentMail delivers the queued emails to a MemoryMailer and returns them.
+func sentMail(t *testing.T, repo *mailRepository) []mailer.Email {
+	sender := mailer.NewMemoryMailer()
+
+	_, err := NewOutboxWorker(repo, sender).DeliverBatch()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sender.Sent()
+}
+
+func TestAuthService_Mail(t *testing.T) {
+	utils.InitEnumeration(config.Enumeration{MinResponseTime: 1})
+	defer utils.InitEnumeration(config.Enumeration{MinResponseTime: 1000})
+
+	registered := models.User{ID: "u1", Email: "dmitrkozyrev2@gmail.com", Locale: "en", Verified: true}
+
+	var testCases = []struct {
+		name            string
+		users           []models.User
+		action          func(as *AuthService) error
+		expectedTo      string
+		expectedSubject string
+		expectedText    string
+	}{
+		{
+			name: "Verify email",
+			action: func(as *AuthService) error {
+				return as.CreateUser(models.User{Email: "new@mail.com", Password: "Secret-123!x", Locale: "en"})
+			},
+			expectedTo:      "new@mail.com",
+			expectedSubject: "Confirm your email",
+			expectedText:    utils.LinkVerifyEmail + "?token=email_verify-token",
+		},
+		{
+			name:  "Password reset",
+			users: []models.User{registered},
+			action: func(as *AuthService) error {
+				return as.ResetPassword(models.ResetPasswordR{Email: registered.Email})
+			},
+			expectedTo:      registered.Email,
+			expectedSubject: "Reset your password",
+			expectedText:    utils.LinkResetPassword + "?token=password_reset-token",
+		},
+		{
+			name:  "Signup attempt",
+			users: []models.User{registered},
+			action: func(as *AuthService) error {
+				return as.CreateUser(models.User{Email: registered.Email, Password: "Secret-123!x"})
+			},
+			expectedTo:      registered.Email,
+			expectedSubject: "Sign up attempt",
+			expectedText:    "already have one",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMailRepository(tt.users...)
+			as := &AuthService{AuthRepository: repo, Events: NewPublisher()}
+
+			err := tt.action(as)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sent := sentMail(t, repo)
+
+			if len(sent) != 1 {
+				t.Fatalf("got %d emails, want 1", len(sent))
+			}
+
+			if sent[0].To != tt.expectedTo || sent[0].Subject != tt.expectedSubject {
+				t.Errorf("got %q to %s", sent[0].Subject, sent[0].To)
+			}
+
+			if !strings.Contains(sent[0].Text, tt.expectedText) || sent[0].HTML == "" {
+				t.Errorf("text %q doesn't contain %q", sent[0].Text, tt.expectedText)
+			}
+		})
+	}
+}
+
+func TestAuthService_ResetPassword_UnknownEmail(t *testing.T) {
+	utils.InitEnumeration(config.Enumeration{MinResponseTime: 1})
+	defer utils.InitEnumeration(config.Enumeration{MinResponseTime: 1000})
+
+	repo := newMailRepository()
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher()}
+
+	err := as.ResetPassword(models.ResetPasswordR{Email: "nobody@mail.com"})
+
+	if err != nil || len(sentMail(t, repo)) != 0 {
+		t.Errorf("got %v, an unknown email must get no email", err)
+	}
+}
+
+func TestAuthService_ChangeRole_UnknownEmail(t *testing.T) {
+	as := &AuthService{AuthRepository: newMailRepository()}
+
+	err := as.ChangeRole(models.ChangeRoleR{Email: "nobody@mail.com", Role: "clinician"})
+
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got %v, expected %v", err, ErrUserNotFound)
+	}
+}
+
+func TestSignupRole(t *testing.T) {
+	invite := func(email, role string) string {
+		token, err := utils.GenerateInviteToken(email, role)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	accessToken, err := utils.GenerateAccessToken("u1", utils.RoleAdmin, "d1", "s1", 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name         string
+		user         models.User
+		expectedRole string
+		expectedErr  error
+	}{
+		{
+			name:         "Default role",
+			user:         models.User{Email: "dima@mail.com"},
+			expectedRole: utils.RolePatient,
+		},
+		{
+			name:         "Self-service role",
+			user:         models.User{Email: "dima@mail.com", Role: utils.RoleCaregiver},
+			expectedRole: utils.RoleCaregiver,
+		},
+		{
+			name:        "Role not allowed",
+			user:        models.User{Email: "dima@mail.com", Role: utils.RoleClinician},
+			expectedErr: ErrRoleNotAllowed,
+		},
+		{
+			name:         "Invitation",
+			user:         models.User{Email: "dima@mail.com", InviteToken: invite("dima@mail.com", utils.RoleClinician)},
+			expectedRole: utils.RoleClinician,
+		},
+		{
+			name: "Invitation overrides the requested role",
+			user: models.User{Email: "dima@mail.com", Role: utils.RoleCaregiver,
+				InviteToken: invite("dima@mail.com", utils.RoleClinician)},
+			expectedRole: utils.RoleClinician,
+		},
+		{
+			name:        "Invitation for another email",
+			user:        models.User{Email: "dima@mail.com", InviteToken: invite("other@mail.com", utils.RoleClinician)},
+			expectedErr: ErrInvalidInvitation,
+		},
+		{
+			name:        "Invitation with an invalid role",
+			user:        models.User{Email: "dima@mail.com", InviteToken: invite("dima@mail.com", "viewer")},
+			expectedErr: ErrInvalidInvitation,
+		},
+		{
+			name:        "Not an invitation",
+			user:        models.User{Email: "dima@mail.com", InviteToken: accessToken},
+			expectedErr: ErrInvalidInvitation,
+		},
+		{
+			name:        "Malformed invitation",
+			user:        models.User{Email: "dima@mail.com", InviteToken: "invite"},
+			expectedErr: ErrInvalidInvitation,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := signupRole(tt.user)
+
+			if err != tt.expectedErr || role != tt.expectedRole {
+				t.Errorf("got %q, %v expected %q, %v", role, err, tt.expectedRole, tt.expectedErr)
+			}
+		})
+	}
+}
+
+// sessionRepository keeps the sessions by refresh token and rotates them like
+// the database does, the rest of repository.Authorization isn't used.
+type sessionRepository struct {
+	repository.Authorization
+	sessions  map[string]models.Session
+	rotateErr error
+	revoked   []string
+}
+
+func (r *sessionRepository) FindSession(refresh_token string) (models.Session, error) {
+	session, ok := r.sessions[refresh_token]
+
+	if !ok {
+		return models.Session{}, sql.ErrNoRows
+	}
+
+	session.RefreshToken = refresh_token
+
+	return session, nil
+}
+
+func (r *sessionRepository) FindUserByID(userID string) (models.User, error) {
+	return models.User{ID: userID}, nil
+}
+
+func (r *sessionRepository) RotateTokens(session models.Session, user models.User) (string, string, error) {
+	if r.rotateErr != nil {
+		return "", "", r.rotateErr
+	}
+
+	now := time.Now()
+	rotated := r.sessions[session.RefreshToken]
+	rotated.RotatedAt = &now
+	r.sessions[session.RefreshToken] = rotated
+
+	refresh_token := session.RefreshToken + "+"
+	r.sessions[refresh_token] = models.Session{UserID: user.ID, DeviceID: session.DeviceID,
+		FamilyID: session.FamilyID, ExpiresAt: session.ExpiresAt}
+
+	return "access", refresh_token, nil
+}
+
+func (r *sessionRepository) RevokeSessionFamily(familyID string) error {
+	r.revoked = append(r.revoked, familyID)
+
+	now := time.Now()
+
+	for token, session := range r.sessions {
+		if session.FamilyID == familyID {
+			session.RevokedAt = &now
+			r.sessions[token] = session
+		}
+	}
+
+	return nil
+}
+
+func TestAuthService_ReplacementTokens(t *testing.T) {
+	now := time.Now()
+	valid := models.Session{UserID: "u1", DeviceID: "phone", FamilyID: "f1", ExpiresAt: now.Add(time.Hour)}
+
+	with := func(change func(*models.Session)) models.Session {
+		session := valid
+		change(&session)
+		return session
+	}
+
+	var testCases = []struct {
+		name            string
+		session         models.Session
+		rotateErr       error
+		request         models.ReplacementTokensR
+		expectedErr     error
+		expectedRevoked bool
+	}{
+		{
+			name:    "OK",
+			session: valid,
+			request: models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"},
+		},
+		{
+			name:            "Rotated token",
+			session:         with(func(s *models.Session) { s.RotatedAt = &now }),
+			request:         models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"},
+			expectedErr:     ErrTokenReuse,
+			expectedRevoked: true,
+		},
+		{
+			name:            "Rotated concurrently",
+			session:         valid,
+			rotateErr:       repository.ErrSessionRotated,
+			request:         models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"},
+			expectedErr:     ErrTokenReuse,
+			expectedRevoked: true,
+		},
+		{
+			name:        "Expired",
+			session:     with(func(s *models.Session) { s.ExpiresAt = now.Add(-time.Minute) }),
+			request:     models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"},
+			expectedErr: ErrSessionExpired,
+		},
+		{
+			name:        "Revoked",
+			session:     with(func(s *models.Session) { s.RevokedAt = &now }),
+			request:     models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"},
+			expectedErr: ErrSessionExpired,
+		},
+		{
+			name:        "Other device",
+			session:     valid,
+			request:     models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "laptop"},
+			expectedErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:        "Unknown token",
+			session:     valid,
+			request:     models.ReplacementTokensR{RefreshToken: "r2", DeviceID: "phone"},
+			expectedErr: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &sessionRepository{sessions: map[string]models.Session{"r1": tt.session}, rotateErr: tt.rotateErr}
+			events := &recorder{}
+			as := &AuthService{AuthRepository: repo, Events: NewPublisher(events)}
+
+			_, refresh_token, err := as.ReplacementTokens(tt.request)
+
+			if err != tt.expectedErr {
+				t.Fatalf("got %v expected %v", err, tt.expectedErr)
+			}
+
+			if err == nil && (refresh_token == "r1" || repo.sessions["r1"].RotatedAt == nil) {
+				t.Errorf("got %q, the token wasn't rotated", refresh_token)
+			}
+
+			if revoked := len(repo.revoked) == 1 && repo.revoked[0] == "f1"; revoked != tt.expectedRevoked {
+				t.Errorf("got revoked families %v", repo.revoked)
+			}
+
+			reported := len(events.events) == 1 && events.events[0].Type == EventRefreshTokenReuse &&
+				events.events[0].UserID == "u1"
+
+			if reported != tt.expectedRevoked {
+				t.Errorf("got events %+v", events.events)
+			}
+		})
+	}
+}
+
+func TestAuthService_ReplacementTokens_Reuse(t *testing.T) {
+	repo := &sessionRepository{sessions: map[string]models.Session{
+		"r1": {UserID: "u1", DeviceID: "phone", FamilyID: "f1", ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher()}
+
+	_, rotated, err := as.ReplacementTokens(models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = as.ReplacementTokens(models.ReplacementTokensR{RefreshToken: "r1", DeviceID: "phone"})
+
+	if err != ErrTokenReuse {
+		t.Errorf("got %v, a rotated token must be rejected as reuse", err)
+	}
+
+	_, _, err = as.ReplacementTokens(models.ReplacementTokensR{RefreshToken: rotated, DeviceID: "phone"})
+
+	if err != ErrSessionExpired {
+		t.Errorf("got %v, the reuse must revoke the whole family", err)
+	}
+}
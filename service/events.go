@@ -0,0 +1,169 @@
+package service
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/utils"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	EventNewDevice         = "new_device"
+	EventPasswordChanged   = "password_changed"
+	EventEmailChanged      = "email_changed"
+	EventMFAEnabled        = "mfa_enabled"
+	EventMFADisabled       = "mfa_disabled"
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	EventPasskeyCloned     = "passkey_cloned"
+	EventAccountLocked     = "account_locked"
+	EventLoginLockedOut    = "login_locked_out"
+	EventMFALockedOut      = "mfa_locked_out"
+	EventAccountSecured    = "account_secured"
+)
+
+// SecurityEvent is something sensitive that happened to the account of the
+// user. Device is the one the event came from, if it is known.
+type SecurityEvent struct {
+	Type    string
+	UserID  string
+	Device  models.Device
+	Details string
+	Time    time.Time
+}
+
+// Subscriber handles the events of a Publisher.
+type Subscriber interface {
+	Handle(SecurityEvent) error
+}
+
+func NewPublisher(subscribers ...Subscriber) *Publisher {
+	return &Publisher{subscribers: subscribers}
+}
+
+// Publisher passes every security event to all of its subscribers, so a new
+// channel only has to subscribe.
+type Publisher struct {
+	subscribers []Subscriber
+}
+
+func (p *Publisher) Subscribe(subscriber Subscriber) {
+	p.subscribers = append(p.subscribers, subscriber)
+}
+
+// Publish hands the event to every subscriber, also after one of them failed.
+func (p *Publisher) Publish(event SecurityEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	var errs []error
+
+	for _, subscriber := range p.subscribers {
+		err := subscriber.Handle(event)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// publish is called once the change is done, so a failed subscriber is only
+// logged and doesn't fail the request.
+func (as *AuthService) publish(event SecurityEvent) {
+	err := as.Events.Publish(event)
+
+	if err != nil {
+		log.Println("security event " + event.Type + ": " + err.Error())
+	}
+}
+
+// securityLog stores every event in the security events of the user.
+type securityLog struct {
+	as *AuthService
+}
+
+func (l securityLog) Handle(event SecurityEvent) error {
+	return l.as.AuthRepository.AddSecurityEvent(event.UserID, event.Type, event.Details)
+}
+
+// emailNotifier emails the user about the event with a link signing out every
+// device. A changed email is left out, the old address already gets a link
+// undoing the change.
+type emailNotifier struct {
+	as *AuthService
+}
+
+var notifiedEvents = map[string]bool{
+	EventNewDevice:         true,
+	EventPasswordChanged:   true,
+	EventMFAEnabled:        true,
+	EventMFADisabled:       true,
+	EventRefreshTokenReuse: true,
+	EventAccountLocked:     true,
+	EventLoginLockedOut:    true,
+	EventMFALockedOut:      true,
+}
+
+func (n emailNotifier) Handle(event SecurityEvent) error {
+	if !notifiedEvents[event.Type] {
+		return nil
+	}
+
+	user, err := n.as.AuthRepository.FindUserByID(event.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := n.as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	token, err := n.as.AuthRepository.CreateOneTimeToken(tx, user.ID, utils.SecureAccountTokenType)
+
+	if err != nil {
+		return err
+	}
+
+	err = n.as.queueMail(tx, user.Email, user.Locale, mailer.TemplateSecurityAlert, mailer.Data{
+		Link:   utils.EmailLink(utils.LinkSecureAccount, token),
+		Event:  event.Type,
+		Device: deviceName(event.Device),
+		IP:     event.Device.IP,
+		Time:   event.Time.UTC().Format("2006-01-02 15:04 UTC"),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deviceName describes the device to its owner, the user agent stands in for
+// a device the app didn't name.
+func deviceName(device models.Device) string {
+	name := device.Name
+
+	if name == "" {
+		name = device.UserAgent
+	}
+
+	if device.Platform != "" && name != "" {
+		return name + " (" + device.Platform + ")"
+	}
+
+	if name == "" {
+		return device.Platform
+	}
+
+	return name
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// recorder keeps the events it handles and fails with err.
+type recorder struct {
+	events []SecurityEvent
+	err    error
+}
+
+func (r *recorder) Handle(event SecurityEvent) error {
+	r.events = append(r.events, event)
+	return r.err
+}
+
+// eventRepository keeps sessions by refresh token apart from the devices of
+// user_devices and logs the security events, the rest of
+// repository.Authorization isn't used.
+type eventRepository struct {
+	repository.Authorization
+	devices  map[string]bool
+	sessions map[string]models.Session
+	validate error
+	logged   []string
+}
+
+func (r *eventRepository) AddDevice(userID, deviceID string) (bool, error) {
+	if r.devices[deviceID] {
+		return false, nil
+	}
+
+	r.devices[deviceID] = true
+
+	return true, nil
+}
+
+func (r *eventRepository) GenerateTokens(user models.User, device models.Device) (string, string, error) {
+	refresh_token := "refresh" + strconv.Itoa(len(r.sessions))
+	r.sessions[refresh_token] = models.Session{UserID: user.ID, DeviceID: device.ID, FamilyID: refresh_token}
+
+	return "access", refresh_token, nil
+}
+
+func (r *eventRepository) FindSession(refresh_token string) (models.Session, error) {
+	session, ok := r.sessions[refresh_token]
+
+	if !ok {
+		return models.Session{}, sql.ErrNoRows
+	}
+
+	return session, nil
+}
+
+func (r *eventRepository) DeleteSessionFamily(familyID string) error {
+	delete(r.sessions, familyID)
+	return nil
+}
+
+func (r *eventRepository) ValidateCredentials(email, password string) (models.User, error) {
+	return models.User{ID: "u1", Email: email}, r.validate
+}
+
+func (r *eventRepository) AddSecurityEvent(userID, event, details string) error {
+	r.logged = append(r.logged, userID+" "+event+" "+details)
+	return nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	failing := &recorder{err: errors.New("smtp down")}
+	other := &recorder{}
+
+	publisher := NewPublisher(failing)
+	publisher.Subscribe(other)
+
+	err := publisher.Publish(SecurityEvent{Type: EventPasswordChanged, UserID: "u1"})
+
+	if err == nil || err.Error() != "smtp down" {
+		t.Errorf("got %v, want the error of the subscriber", err)
+	}
+
+	if len(other.events) != 1 || other.events[0].Type != EventPasswordChanged {
+		t.Fatalf("got %v, a failed subscriber must not stop the others", other.events)
+	}
+
+	if other.events[0].Time.IsZero() {
+		t.Error("event time not set")
+	}
+}
+
+func TestAuthService_IssueTokens(t *testing.T) {
+	repo := &eventRepository{devices: map[string]bool{"phone": true}, sessions: map[string]models.Session{}}
+	events := &recorder{}
+	as := &AuthService{AuthRepository: repo}
+	as.Events = NewPublisher(securityLog{as}, events)
+
+	for _, deviceID := range []string{"phone", "laptop"} {
+		_, _, err := as.issueTokens(models.User{ID: "u1"}, models.Device{ID: deviceID, IP: "10.0.0.1"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(repo.sessions) != 2 {
+		t.Errorf("got %d sessions, want 2", len(repo.sessions))
+	}
+
+	if len(events.events) != 1 || events.events[0].Type != EventNewDevice || events.events[0].Device.ID != "laptop" {
+		t.Errorf("got %v, want only the new device", events.events)
+	}
+
+	if len(repo.logged) != 1 || repo.logged[0] != "u1 new_device device_id=laptop" {
+		t.Errorf("got security log %v", repo.logged)
+	}
+}
+
+func TestAuthService_IssueTokens_AfterLogout(t *testing.T) {
+	repo := &eventRepository{devices: map[string]bool{}, sessions: map[string]models.Session{}}
+	events := &recorder{}
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher(events)}
+	user := models.User{ID: "u1"}
+	device := models.Device{ID: "phone"}
+
+	_, refresh_token, err := as.issueTokens(user, device)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = as.DeleteSession(models.LogoutR{RefreshToken: refresh_token})
+
+	if err != nil || len(repo.sessions) != 0 {
+		t.Fatalf("logout failed: %v, %d sessions left", err, len(repo.sessions))
+	}
+
+	_, _, err = as.issueTokens(user, device)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events.events) != 1 {
+		t.Errorf("got %d new device events, signing in again on the phone isn't new", len(events.events))
+	}
+}
+
+func TestAuthService_ValidateCredentials_LockoutStarted(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		validate error
+		events   int
+	}{
+		{"wrong password", repository.ErrInvalidCredentials, 0},
+		{"lockout started", repository.ErrLockoutStarted, 1},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			events := &recorder{}
+			as := &AuthService{AuthRepository: &eventRepository{validate: tt.validate}, Events: NewPublisher(events)}
+
+			_, err := as.validateCredentials("dmitrkozyrev2@gmail.com", "wrong")
+
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got %v, want %v", err, ErrInvalidCredentials)
+			}
+
+			if len(events.events) != tt.events {
+				t.Fatalf("got %d events, want %d", len(events.events), tt.events)
+			}
+
+			if tt.events == 1 && (events.events[0].Type != EventLoginLockedOut || events.events[0].UserID != "u1") {
+				t.Errorf("got %v", events.events[0])
+			}
+		})
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	var testCases = []struct {
+		device   models.Device
+		expected string
+	}{
+		{models.Device{Name: "Pixel 8", Platform: "android", UserAgent: "okhttp"}, "Pixel 8 (android)"},
+		{models.Device{UserAgent: "Mozilla/5.0"}, "Mozilla/5.0"},
+		{models.Device{Platform: "ios"}, "ios"},
+		{models.Device{}, ""},
+	}
+
+	for _, tt := range testCases {
+		if got := deviceName(tt.device); got != tt.expected {
+			t.Errorf("got %q, want %q", got, tt.expected)
+		}
+	}
+}
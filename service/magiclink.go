@@ -0,0 +1,115 @@
+package service
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SendMagicLink emails a sign in link and code usable only on the requesting
+// device. Like sendOneTimeToken, the link and the email are stored together.
+// Unknown and locked accounts, and users who used up the attempts of their
+// link, get the same response without an email, unless accounts may be
+// revealed.
+func (as *AuthService) SendMagicLink(request models.MagicLinkR) error {
+	if !utils.MagicLinkEnabled() {
+		return ErrMagicLinkDisabled
+	}
+
+	defer utils.PadResponseTime(time.Now())
+
+	user, err := as.AuthRepository.FindUser(request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if user.Locked {
+		if utils.RevealAccounts() {
+			return ErrAccountLocked
+		}
+
+		return nil
+	}
+
+	tx, err := as.AuthRepository.BeginTx()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	token, code, err := as.AuthRepository.CreateMagicLink(tx, user.ID, request.DeviceID)
+
+	if errors.Is(err, repository.ErrMagicLinkExhausted) {
+		if utils.RevealAccounts() {
+			return ErrTooManyAttempts
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = as.queueMail(tx, user.Email, user.Locale, mailer.TemplateMagicLink,
+		mailer.Data{Link: utils.EmailLink(utils.LinkMagicLink, token), Code: code})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LoginMagicLink exchanges the link token, or the email and code, for tokens.
+// The emailed link is only a first factor, a user with MFA still gets an MFA
+// challenge.
+func (as *AuthService) LoginMagicLink(request models.MagicLinkLoginR) (models.LoginResult, error) {
+	if !utils.MagicLinkEnabled() {
+		return models.LoginResult{}, ErrMagicLinkDisabled
+	}
+
+	var userID string
+	var err error
+
+	if request.Token != "" {
+		userID, err = as.AuthRepository.ConsumeMagicLink(request.Token, request.DeviceID)
+	} else {
+		userID, err = as.AuthRepository.ConsumeMagicLinkCode(request.Email, request.Code, request.DeviceID)
+	}
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	user, err := as.AuthRepository.FindUserByID(userID)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if user.Locked {
+		return models.LoginResult{}, ErrAccountLocked
+	}
+
+	device := models.Device{
+		ID:        request.DeviceID,
+		Name:      request.DeviceName,
+		Platform:  request.Platform,
+		IP:        request.IP,
+		UserAgent: request.UserAgent,
+	}
+
+	return as.login(user, device)
+}
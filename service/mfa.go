@@ -0,0 +1,305 @@
+package service
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginMFA completes a login with a TOTP or recovery code. A user who must
+// use MFA but hasn't enrolled yet confirms the enrollment with the code and
+// gets the recovery codes with the tokens. The challenge token stops working
+// after MFAMaxAttempts codes, so it can't be used to guess codes.
+func (as *AuthService) LoginMFA(request models.LoginMFAR) (models.LoginResult, error) {
+	claims, user, err := as.parseMFAToken(request.MFAToken)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	attempts, err := as.AuthRepository.UseMFAChallenge(claims.Id, time.Unix(claims.ExpiresAt, 0))
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if attempts > utils.MFAMaxAttempts() {
+		return models.LoginResult{}, utils.ErrInvalidToken
+	}
+
+	mfa, err := as.findMFA(user.ID)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if mfa.LockedUntil != nil && time.Now().Before(*mfa.LockedUntil) {
+		return models.LoginResult{}, &LockedOutError{RetryAfter: time.Until(*mfa.LockedUntil)}
+	}
+
+	var result models.LoginResult
+
+	switch {
+	case mfa.ConfirmedAt != nil:
+		err = as.checkMFACode(mfa, request.Code)
+	case mfa.TOTPSecret != "":
+		result.RecoveryCodes, err = as.confirmTOTP(mfa, request.Code)
+	default:
+		err = ErrMFANotEnabled
+	}
+
+	if errors.Is(err, ErrInvalidMFACode) {
+		return models.LoginResult{}, as.failedMFACode(user.ID)
+	}
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if mfa.FailedAttempts > 0 {
+		err = as.AuthRepository.ResetFailedMFA(user.ID)
+
+		if err != nil {
+			return models.LoginResult{}, err
+		}
+	}
+
+	device := models.Device{
+		ID:        claims.DeviceID,
+		Name:      claims.DeviceName,
+		Platform:  claims.Platform,
+		IP:        request.IP,
+		UserAgent: request.UserAgent,
+	}
+
+	result.AccessToken, result.RefreshToken, err = as.issueTokens(user, device)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	return result, nil
+}
+
+// failedMFACode counts a wrong code of a login towards the lockout of the
+// second factor, which a correct password doesn't lift. The owner is told
+// when it starts.
+func (as *AuthService) failedMFACode(userID string) error {
+	started, err := as.AuthRepository.RecordFailedMFA(userID)
+
+	if err != nil {
+		return err
+	}
+
+	if started {
+		as.publish(SecurityEvent{Type: EventMFALockedOut, UserID: userID})
+	}
+
+	return ErrInvalidMFACode
+}
+
+// EnrollTOTPChallenge starts enrollment during a login of a user who must
+// use MFA, before the user has an access token.
+func (as *AuthService) EnrollTOTPChallenge(request models.MFAChallengeR) (models.TOTPEnrollment, error) {
+	_, user, err := as.parseMFAToken(request.MFAToken)
+
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	return as.startTOTPEnrollment(user.ID, user.Email)
+}
+
+func (as *AuthService) EnrollTOTP(principal models.Principal) (models.TOTPEnrollment, error) {
+	return as.startTOTPEnrollment(principal.ID, principal.Email)
+}
+
+// ConfirmTOTP enables MFA once the user proves the authenticator app works,
+// and returns the recovery codes. They are never shown again.
+func (as *AuthService) ConfirmTOTP(principal models.Principal, request models.MFACodeR) ([]string, error) {
+	mfa, err := as.findMFA(principal.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if mfa.TOTPSecret == "" {
+		return nil, ErrMFANotEnabled
+	}
+
+	return as.confirmTOTP(mfa, request.Code)
+}
+
+func (as *AuthService) DisableMFA(principal models.Principal, request models.MFACodeR) error {
+	if utils.MFARequired(principal.Role) {
+		return ErrMFARequired
+	}
+
+	mfa, err := as.enabledMFA(principal.ID, request.Code)
+
+	if err != nil {
+		return err
+	}
+
+	err = as.AuthRepository.DisableMFA(mfa.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	as.publish(SecurityEvent{Type: EventMFADisabled, UserID: mfa.UserID})
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (as *AuthService) RegenerateRecoveryCodes(principal models.Principal, request models.MFACodeR) ([]string, error) {
+	mfa, err := as.enabledMFA(principal.ID, request.Code)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.AuthRepository.ReplaceRecoveryCodes(mfa.UserID, hashes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// parseMFAToken checks the challenge token and that the user's tokens weren't
+// revoked since it was issued.
+func (as *AuthService) parseMFAToken(token string) (utils.MFAClaims, models.User, error) {
+	var claims utils.MFAClaims
+
+	err := utils.ParseToken(token, &claims)
+
+	if err != nil {
+		return claims, models.User{}, err
+	}
+
+	user, err := as.AuthRepository.FindUserByID(claims.Subject)
+
+	if err != nil {
+		return claims, models.User{}, err
+	}
+
+	if user.Locked {
+		return claims, models.User{}, ErrAccountLocked
+	}
+
+	if user.TokenVersion != claims.Version {
+		return claims, models.User{}, utils.ErrInvalidToken
+	}
+
+	return claims, user, nil
+}
+
+// findMFA returns an empty MFA for a user who never started enrollment.
+func (as *AuthService) findMFA(userID string) (models.MFA, error) {
+	mfa, err := as.AuthRepository.FindMFA(userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.MFA{UserID: userID}, nil
+	}
+
+	return mfa, err
+}
+
+// enabledMFA checks the code of a user with confirmed MFA.
+func (as *AuthService) enabledMFA(userID, code string) (models.MFA, error) {
+	mfa, err := as.findMFA(userID)
+
+	if err != nil {
+		return models.MFA{}, err
+	}
+
+	if mfa.ConfirmedAt == nil {
+		return models.MFA{}, ErrMFANotEnabled
+	}
+
+	return mfa, as.checkMFACode(mfa, code)
+}
+
+// startTOTPEnrollment stores a new secret for the user, the email only labels
+// the account in the authenticator app.
+func (as *AuthService) startTOTPEnrollment(userID, email string) (models.TOTPEnrollment, error) {
+	secret, err := utils.GenerateTOTPSecret()
+
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	err = as.AuthRepository.StartTOTPEnrollment(userID, secret)
+
+	if errors.Is(err, repository.ErrMFAEnabled) {
+		return models.TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	return models.TOTPEnrollment{Secret: secret, URI: utils.TOTPURI(email, secret)}, nil
+}
+
+func (as *AuthService) confirmTOTP(mfa models.MFA, code string) ([]string, error) {
+	step, ok := utils.CheckTOTP(mfa.TOTPSecret, code, time.Now())
+
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.AuthRepository.ConfirmMFA(mfa.UserID, step, hashes)
+
+	if errors.Is(err, repository.ErrMFACodeUsed) {
+		return nil, ErrInvalidMFACode
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	as.publish(SecurityEvent{Type: EventMFAEnabled, UserID: mfa.UserID})
+
+	return codes, nil
+}
+
+// checkMFACode accepts a TOTP code or an unused recovery code. A TOTP code
+// can't be used twice, even within its time step.
+func (as *AuthService) checkMFACode(mfa models.MFA, code string) error {
+	var err error
+
+	if step, ok := utils.CheckTOTP(mfa.TOTPSecret, code, time.Now()); ok {
+		err = as.AuthRepository.UseTOTPStep(mfa.UserID, step)
+	} else {
+		err = as.AuthRepository.UseRecoveryCode(mfa.UserID, utils.HashRecoveryCode(code))
+	}
+
+	if errors.Is(err, repository.ErrMFACodeUsed) {
+		return ErrInvalidMFACode
+	}
+
+	return err
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"DiaSync/config"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mfaRepository accepts one recovery code, counts the codes tried with every
+// challenge token and locks the second factor like the database does, the
+// rest of repository.Authorization isn't used.
+type mfaRepository struct {
+	repository.Authorization
+	recoveryCode string
+	challenges   map[string]int
+	failed       int
+	lockedUntil  *time.Time
+}
+
+func (r *mfaRepository) FindUserByID(userID string) (models.User, error) {
+	return models.User{ID: userID}, nil
+}
+
+func (r *mfaRepository) FindMFA(userID string) (models.MFA, error) {
+	now := time.Now()
+	return models.MFA{UserID: userID, TOTPSecret: rfcTOTPSecret, ConfirmedAt: &now, FailedAttempts: r.failed,
+		LockedUntil: r.lockedUntil}, nil
+}
+
+func (r *mfaRepository) RecordFailedMFA(userID string) (bool, error) {
+	r.failed++
+
+	delay := utils.LockoutDelay(r.failed)
+
+	if delay == 0 {
+		return false, nil
+	}
+
+	lockedUntil := time.Now().Add(delay)
+	r.lockedUntil = &lockedUntil
+
+	return utils.LockoutDelay(r.failed-1) == 0, nil
+}
+
+func (r *mfaRepository) ResetFailedMFA(userID string) error {
+	r.failed = 0
+	r.lockedUntil = nil
+
+	return nil
+}
+
+func (r *mfaRepository) UseMFAChallenge(tokenID string, expiresAt time.Time) (int, error) {
+	r.challenges[tokenID]++
+	return r.challenges[tokenID], nil
+}
+
+func (r *mfaRepository) UseRecoveryCode(userID, codeHash string) error {
+	if codeHash != utils.HashRecoveryCode(r.recoveryCode) {
+		return repository.ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+func (r *mfaRepository) GenerateTokens(user models.User, device models.Device) (string, string, error) {
+	return "access", "refresh", nil
+}
+
+func (r *mfaRepository) AddDevice(userID, deviceID string) (bool, error) {
+	return false, nil
+}
+
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestAuthService_LoginMFA_MaxAttempts(t *testing.T) {
+	utils.InitLockout(config.Lockout{Threshold: 100})
+	defer utils.InitLockout(config.Lockout{Threshold: 5})
+
+	repo := &mfaRepository{recoveryCode: "abcd-efgh", challenges: map[string]int{}}
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher()}
+
+	mfaToken, err := utils.GenerateMFAToken("u1", models.Device{ID: "phone"}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < utils.MFAMaxAttempts(); i++ {
+		_, err = as.LoginMFA(models.LoginMFAR{MFAToken: mfaToken, Code: "wrong"})
+
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+
+	_, err = as.LoginMFA(models.LoginMFAR{MFAToken: mfaToken, Code: repo.recoveryCode})
+
+	if !errors.Is(err, utils.ErrInvalidToken) {
+		t.Errorf("got %v, the token must stop working after %d codes", err, utils.MFAMaxAttempts())
+	}
+
+	mfaToken, _ = utils.GenerateMFAToken("u1", models.Device{ID: "phone"}, 0)
+
+	result, err := as.LoginMFA(models.LoginMFAR{MFAToken: mfaToken, Code: repo.recoveryCode})
+
+	if err != nil || result.AccessToken == "" {
+		t.Errorf("got %v, %v with a new token", result, err)
+	}
+}
+
+func TestAuthService_LoginMFA_Lockout(t *testing.T) {
+	repo := &mfaRepository{recoveryCode: "abcd-efgh", challenges: map[string]int{}}
+	events := &recorder{}
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher(events)}
+
+	// every guess comes with a new challenge token, as after logging in again
+	loginMFA := func(code string) (models.LoginResult, error) {
+		mfaToken, err := utils.GenerateMFAToken("u1", models.Device{ID: "phone"}, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return as.LoginMFA(models.LoginMFAR{MFAToken: mfaToken, Code: code})
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := loginMFA("wrong"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+
+	var lockedOut *LockedOutError
+
+	if _, err := loginMFA(repo.recoveryCode); !errors.As(err, &lockedOut) || lockedOut.RetryAfter <= 0 {
+		t.Errorf("got %v, the second factor must be locked after 5 wrong codes", err)
+	}
+
+	if len(events.events) != 1 || events.events[0].Type != EventMFALockedOut {
+		t.Errorf("got events %+v, want one %s", events.events, EventMFALockedOut)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	repo.lockedUntil = &expired
+
+	result, err := loginMFA(repo.recoveryCode)
+
+	if err != nil || result.AccessToken == "" || repo.failed != 0 {
+		t.Errorf("got %v, %v, %d failures after the lockout ended", result, err, repo.failed)
+	}
+}
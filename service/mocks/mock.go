@@ -34,6 +34,136 @@ func (m *MockAuthorization) EXPECT() *MockAuthorizationMockRecorder {
 	return m.recorder
 }
 
+// BeginOIDCLogin mocks base method.
+func (m *MockAuthorization) BeginOIDCLogin() (models.OIDCNonce, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginOIDCLogin")
+	ret0, _ := ret[0].(models.OIDCNonce)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginOIDCLogin indicates an expected call of BeginOIDCLogin.
+func (mr *MockAuthorizationMockRecorder) BeginOIDCLogin() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginOIDCLogin", reflect.TypeOf((*MockAuthorization)(nil).BeginOIDCLogin))
+}
+
+// BeginPasskeyLogin mocks base method.
+func (m *MockAuthorization) BeginPasskeyLogin(arg0 models.PasskeyLoginBeginR) (models.WebAuthnOptions, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeyLogin", arg0)
+	ret0, _ := ret[0].(models.WebAuthnOptions)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginPasskeyLogin indicates an expected call of BeginPasskeyLogin.
+func (mr *MockAuthorizationMockRecorder) BeginPasskeyLogin(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeyLogin", reflect.TypeOf((*MockAuthorization)(nil).BeginPasskeyLogin), arg0)
+}
+
+// BeginPasskeyRegistration mocks base method.
+func (m *MockAuthorization) BeginPasskeyRegistration(arg0 models.Principal) (models.WebAuthnOptions, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginPasskeyRegistration", arg0)
+	ret0, _ := ret[0].(models.WebAuthnOptions)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginPasskeyRegistration indicates an expected call of BeginPasskeyRegistration.
+func (mr *MockAuthorizationMockRecorder) BeginPasskeyRegistration(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginPasskeyRegistration", reflect.TypeOf((*MockAuthorization)(nil).BeginPasskeyRegistration), arg0)
+}
+
+// ChangeEmail mocks base method.
+func (m *MockAuthorization) ChangeEmail(arg0 models.Principal, arg1 models.ChangeEmailR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeEmail", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeEmail indicates an expected call of ChangeEmail.
+func (mr *MockAuthorizationMockRecorder) ChangeEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeEmail", reflect.TypeOf((*MockAuthorization)(nil).ChangeEmail), arg0, arg1)
+}
+
+// ChangePassword mocks base method.
+func (m *MockAuthorization) ChangePassword(arg0 models.Principal, arg1 models.ChangePasswordR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockAuthorizationMockRecorder) ChangePassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockAuthorization)(nil).ChangePassword), arg0, arg1)
+}
+
+// ChangeRole mocks base method.
+func (m *MockAuthorization) ChangeRole(arg0 models.ChangeRoleR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeRole", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeRole indicates an expected call of ChangeRole.
+func (mr *MockAuthorizationMockRecorder) ChangeRole(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeRole", reflect.TypeOf((*MockAuthorization)(nil).ChangeRole), arg0)
+}
+
+// ConfirmEmailChange mocks base method.
+func (m *MockAuthorization) ConfirmEmailChange(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmEmailChange", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmEmailChange indicates an expected call of ConfirmEmailChange.
+func (mr *MockAuthorizationMockRecorder) ConfirmEmailChange(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmEmailChange", reflect.TypeOf((*MockAuthorization)(nil).ConfirmEmailChange), arg0)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockAuthorization) ConfirmTOTP(arg0 models.Principal, arg1 models.MFACodeR) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockAuthorizationMockRecorder) ConfirmTOTP(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockAuthorization)(nil).ConfirmTOTP), arg0, arg1)
+}
+
+// CreateInvitation mocks base method.
+func (m *MockAuthorization) CreateInvitation(arg0 models.InvitationR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvitation", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateInvitation indicates an expected call of CreateInvitation.
+func (mr *MockAuthorizationMockRecorder) CreateInvitation(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvitation", reflect.TypeOf((*MockAuthorization)(nil).CreateInvitation), arg0)
+}
+
 // CreateUser mocks base method.
 func (m *MockAuthorization) CreateUser(arg0 models.User) error {
 	m.ctrl.T.Helper()
@@ -62,14 +192,86 @@ func (mr *MockAuthorizationMockRecorder) DeleteSession(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockAuthorization)(nil).DeleteSession), arg0)
 }
 
+// DisableMFA mocks base method.
+func (m *MockAuthorization) DisableMFA(arg0 models.Principal, arg1 models.MFACodeR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableMFA", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableMFA indicates an expected call of DisableMFA.
+func (mr *MockAuthorizationMockRecorder) DisableMFA(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableMFA", reflect.TypeOf((*MockAuthorization)(nil).DisableMFA), arg0, arg1)
+}
+
+// EnrollTOTP mocks base method.
+func (m *MockAuthorization) EnrollTOTP(arg0 models.Principal) (models.TOTPEnrollment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTP", arg0)
+	ret0, _ := ret[0].(models.TOTPEnrollment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollTOTP indicates an expected call of EnrollTOTP.
+func (mr *MockAuthorizationMockRecorder) EnrollTOTP(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTP", reflect.TypeOf((*MockAuthorization)(nil).EnrollTOTP), arg0)
+}
+
+// EnrollTOTPChallenge mocks base method.
+func (m *MockAuthorization) EnrollTOTPChallenge(arg0 models.MFAChallengeR) (models.TOTPEnrollment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTPChallenge", arg0)
+	ret0, _ := ret[0].(models.TOTPEnrollment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollTOTPChallenge indicates an expected call of EnrollTOTPChallenge.
+func (mr *MockAuthorizationMockRecorder) EnrollTOTPChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTPChallenge", reflect.TypeOf((*MockAuthorization)(nil).EnrollTOTPChallenge), arg0)
+}
+
+// FinishPasskeyLogin mocks base method.
+func (m *MockAuthorization) FinishPasskeyLogin(arg0 models.PasskeyLoginR) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeyLogin", arg0)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinishPasskeyLogin indicates an expected call of FinishPasskeyLogin.
+func (mr *MockAuthorizationMockRecorder) FinishPasskeyLogin(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeyLogin", reflect.TypeOf((*MockAuthorization)(nil).FinishPasskeyLogin), arg0)
+}
+
+// FinishPasskeyRegistration mocks base method.
+func (m *MockAuthorization) FinishPasskeyRegistration(arg0 models.Principal, arg1 models.PasskeyRegistrationR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishPasskeyRegistration", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishPasskeyRegistration indicates an expected call of FinishPasskeyRegistration.
+func (mr *MockAuthorizationMockRecorder) FinishPasskeyRegistration(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishPasskeyRegistration", reflect.TypeOf((*MockAuthorization)(nil).FinishPasskeyRegistration), arg0, arg1)
+}
+
 // GenerateTokens mocks base method.
-func (m *MockAuthorization) GenerateTokens(arg0 models.LoginR) (string, string, error) {
+func (m *MockAuthorization) GenerateTokens(arg0 models.LoginR) (models.LoginResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GenerateTokens", arg0)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(string)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // GenerateTokens indicates an expected call of GenerateTokens.
@@ -78,6 +280,139 @@ func (mr *MockAuthorizationMockRecorder) GenerateTokens(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateTokens", reflect.TypeOf((*MockAuthorization)(nil).GenerateTokens), arg0)
 }
 
+// LinkIdentity mocks base method.
+func (m *MockAuthorization) LinkIdentity(arg0 models.Principal, arg1 models.LinkIdentityR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkIdentity", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkIdentity indicates an expected call of LinkIdentity.
+func (mr *MockAuthorizationMockRecorder) LinkIdentity(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkIdentity", reflect.TypeOf((*MockAuthorization)(nil).LinkIdentity), arg0, arg1)
+}
+
+// ListFailedEmails mocks base method.
+func (m *MockAuthorization) ListFailedEmails() ([]models.OutboxEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFailedEmails")
+	ret0, _ := ret[0].([]models.OutboxEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFailedEmails indicates an expected call of ListFailedEmails.
+func (mr *MockAuthorizationMockRecorder) ListFailedEmails() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFailedEmails", reflect.TypeOf((*MockAuthorization)(nil).ListFailedEmails))
+}
+
+// ListIdentities mocks base method.
+func (m *MockAuthorization) ListIdentities(arg0 models.Principal) ([]models.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListIdentities", arg0)
+	ret0, _ := ret[0].([]models.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListIdentities indicates an expected call of ListIdentities.
+func (mr *MockAuthorizationMockRecorder) ListIdentities(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListIdentities", reflect.TypeOf((*MockAuthorization)(nil).ListIdentities), arg0)
+}
+
+// ListSessions mocks base method.
+func (m *MockAuthorization) ListSessions(arg0 models.Principal) ([]models.SessionInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", arg0)
+	ret0, _ := ret[0].([]models.SessionInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockAuthorizationMockRecorder) ListSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockAuthorization)(nil).ListSessions), arg0)
+}
+
+// LockUser mocks base method.
+func (m *MockAuthorization) LockUser(arg0 models.LockUserR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockUser", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockUser indicates an expected call of LockUser.
+func (mr *MockAuthorizationMockRecorder) LockUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockUser", reflect.TypeOf((*MockAuthorization)(nil).LockUser), arg0)
+}
+
+// LoginMFA mocks base method.
+func (m *MockAuthorization) LoginMFA(arg0 models.LoginMFAR) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginMFA", arg0)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginMFA indicates an expected call of LoginMFA.
+func (mr *MockAuthorizationMockRecorder) LoginMFA(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginMFA", reflect.TypeOf((*MockAuthorization)(nil).LoginMFA), arg0)
+}
+
+// LoginMagicLink mocks base method.
+func (m *MockAuthorization) LoginMagicLink(arg0 models.MagicLinkLoginR) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginMagicLink", arg0)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginMagicLink indicates an expected call of LoginMagicLink.
+func (mr *MockAuthorizationMockRecorder) LoginMagicLink(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginMagicLink", reflect.TypeOf((*MockAuthorization)(nil).LoginMagicLink), arg0)
+}
+
+// LoginOIDC mocks base method.
+func (m *MockAuthorization) LoginOIDC(arg0 models.OIDCLoginR) (models.LoginResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginOIDC", arg0)
+	ret0, _ := ret[0].(models.LoginResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginOIDC indicates an expected call of LoginOIDC.
+func (mr *MockAuthorizationMockRecorder) LoginOIDC(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginOIDC", reflect.TypeOf((*MockAuthorization)(nil).LoginOIDC), arg0)
+}
+
+// RegenerateRecoveryCodes mocks base method.
+func (m *MockAuthorization) RegenerateRecoveryCodes(arg0 models.Principal, arg1 models.MFACodeR) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegenerateRecoveryCodes", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegenerateRecoveryCodes indicates an expected call of RegenerateRecoveryCodes.
+func (mr *MockAuthorizationMockRecorder) RegenerateRecoveryCodes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegenerateRecoveryCodes", reflect.TypeOf((*MockAuthorization)(nil).RegenerateRecoveryCodes), arg0, arg1)
+}
+
 // RepeatEmailVerify mocks base method.
 func (m *MockAuthorization) RepeatEmailVerify(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -122,6 +457,133 @@ func (mr *MockAuthorizationMockRecorder) ResetPassword(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockAuthorization)(nil).ResetPassword), arg0)
 }
 
+// RetryEmail mocks base method.
+func (m *MockAuthorization) RetryEmail(arg0 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryEmail", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryEmail indicates an expected call of RetryEmail.
+func (mr *MockAuthorizationMockRecorder) RetryEmail(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryEmail", reflect.TypeOf((*MockAuthorization)(nil).RetryEmail), arg0)
+}
+
+// RevokeOtherSessions mocks base method.
+func (m *MockAuthorization) RevokeOtherSessions(arg0 models.Principal) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOtherSessions", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeOtherSessions indicates an expected call of RevokeOtherSessions.
+func (mr *MockAuthorizationMockRecorder) RevokeOtherSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOtherSessions", reflect.TypeOf((*MockAuthorization)(nil).RevokeOtherSessions), arg0)
+}
+
+// RevokeSession mocks base method.
+func (m *MockAuthorization) RevokeSession(arg0 models.Principal, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockAuthorizationMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockAuthorization)(nil).RevokeSession), arg0, arg1)
+}
+
+// SecureAccount mocks base method.
+func (m *MockAuthorization) SecureAccount(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SecureAccount", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SecureAccount indicates an expected call of SecureAccount.
+func (mr *MockAuthorizationMockRecorder) SecureAccount(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SecureAccount", reflect.TypeOf((*MockAuthorization)(nil).SecureAccount), arg0)
+}
+
+// SendMagicLink mocks base method.
+func (m *MockAuthorization) SendMagicLink(arg0 models.MagicLinkR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendMagicLink", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMagicLink indicates an expected call of SendMagicLink.
+func (mr *MockAuthorizationMockRecorder) SendMagicLink(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMagicLink", reflect.TypeOf((*MockAuthorization)(nil).SendMagicLink), arg0)
+}
+
+// TokenOwner mocks base method.
+func (m *MockAuthorization) TokenOwner(arg0 string) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokenOwner", arg0)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TokenOwner indicates an expected call of TokenOwner.
+func (mr *MockAuthorizationMockRecorder) TokenOwner(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokenOwner", reflect.TypeOf((*MockAuthorization)(nil).TokenOwner), arg0)
+}
+
+// UndoEmailChange mocks base method.
+func (m *MockAuthorization) UndoEmailChange(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UndoEmailChange", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UndoEmailChange indicates an expected call of UndoEmailChange.
+func (mr *MockAuthorizationMockRecorder) UndoEmailChange(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UndoEmailChange", reflect.TypeOf((*MockAuthorization)(nil).UndoEmailChange), arg0)
+}
+
+// UnlinkIdentity mocks base method.
+func (m *MockAuthorization) UnlinkIdentity(arg0 models.Principal, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlinkIdentity", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlinkIdentity indicates an expected call of UnlinkIdentity.
+func (mr *MockAuthorizationMockRecorder) UnlinkIdentity(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlinkIdentity", reflect.TypeOf((*MockAuthorization)(nil).UnlinkIdentity), arg0, arg1)
+}
+
+// UnlockUser mocks base method.
+func (m *MockAuthorization) UnlockUser(arg0 models.LockUserR) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlockUser", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlockUser indicates an expected call of UnlockUser.
+func (mr *MockAuthorizationMockRecorder) UnlockUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlockUser", reflect.TypeOf((*MockAuthorization)(nil).UnlockUser), arg0)
+}
+
 // VerifyEmail mocks base method.
 func (m *MockAuthorization) VerifyEmail(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -137,7 +599,7 @@ func (mr *MockAuthorizationMockRecorder) VerifyEmail(arg0 interface{}) *gomock.C
 }
 
 // VerifyNewPassword mocks base method.
-func (m *MockAuthorization) VerifyNewPassword(arg0 string) error {
+func (m *MockAuthorization) VerifyNewPassword(arg0 models.NewPasswordR) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "VerifyNewPassword", arg0)
 	ret0, _ := ret[0].(error)
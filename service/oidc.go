@@ -0,0 +1,192 @@
+package service
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+)
+
+// BeginOIDCLogin issues the nonce the app passes to Apple or Google when it
+// requests the ID token.
+func (as *AuthService) BeginOIDCLogin() (models.OIDCNonce, error) {
+	nonce, err := utils.RandomString(32)
+
+	if err != nil {
+		return models.OIDCNonce{}, err
+	}
+
+	err = as.AuthRepository.CreateOIDCNonce(nonce, utils.OIDCNonceExpiresAt())
+
+	if err != nil {
+		return models.OIDCNonce{}, err
+	}
+
+	return models.OIDCNonce{Nonce: nonce}, nil
+}
+
+// verifyIDToken verifies the ID token and consumes its nonce, so a captured
+// token can't be replayed.
+func (as *AuthService) verifyIDToken(provider, token, nonce string) (utils.IDTokenClaims, error) {
+	claims, err := utils.VerifyIDToken(provider, token, nonce)
+
+	if err != nil {
+		return utils.IDTokenClaims{}, err
+	}
+
+	err = as.AuthRepository.ConsumeOIDCNonce(nonce)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.IDTokenClaims{}, utils.ErrInvalidIDToken
+	}
+
+	if err != nil {
+		return utils.IDTokenClaims{}, err
+	}
+
+	return claims, nil
+}
+
+// LoginOIDC signs in with an Apple or Google ID token obtained by the app.
+// Like a password, the identity is only a first factor.
+func (as *AuthService) LoginOIDC(request models.OIDCLoginR) (models.LoginResult, error) {
+	claims, err := as.verifyIDToken(request.Provider, request.IDToken, request.Nonce)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	user, err := as.identityUser(request.Provider, claims)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if user.Locked {
+		return models.LoginResult{}, ErrAccountLocked
+	}
+
+	device := models.Device{
+		ID:        request.DeviceID,
+		Name:      request.DeviceName,
+		Platform:  request.Platform,
+		IP:        request.IP,
+		UserAgent: request.UserAgent,
+	}
+
+	return as.login(user, device)
+}
+
+// identityUser returns the user the identity is linked to. A new identity is
+// linked to the user with the same email or signs up a new patient, but only
+// if the provider verified the email.
+func (as *AuthService) identityUser(provider string, claims utils.IDTokenClaims) (models.User, error) {
+	identity, err := as.AuthRepository.FindIdentity(provider, claims.Subject)
+
+	if err == nil {
+		err = as.AuthRepository.UseIdentity(provider, claims.Subject)
+
+		if err != nil {
+			return models.User{}, err
+		}
+
+		return as.AuthRepository.FindUserByID(identity.UserID)
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return models.User{}, ErrIdentityEmailUnverified
+	}
+
+	identity = models.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := as.AuthRepository.FindUser(claims.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		user = models.User{Email: claims.Email, Role: utils.RolePatient, Verified: true}
+		user.ID, err = as.AuthRepository.CreateIdentityUser(user, identity)
+
+		return user, err
+	}
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// anyone could have signed up with the address without confirming it,
+	// linking such an account would hand it to them
+	if !user.Verified {
+		return models.User{}, ErrIdentityConflict
+	}
+
+	identity.UserID = user.ID
+
+	err = as.AuthRepository.CreateIdentity(identity)
+
+	if errors.Is(err, repository.ErrIdentityExists) {
+		return models.User{}, ErrIdentityConflict
+	}
+
+	return user, err
+}
+
+// LinkIdentity adds an identity to the signed in user, the provider's email
+// doesn't have to match the user's.
+func (as *AuthService) LinkIdentity(principal models.Principal, request models.LinkIdentityR) error {
+	claims, err := as.verifyIDToken(request.Provider, request.IDToken, request.Nonce)
+
+	if err != nil {
+		return err
+	}
+
+	identity, err := as.AuthRepository.FindIdentity(request.Provider, claims.Subject)
+
+	if err == nil {
+		if identity.UserID == principal.ID {
+			return nil
+		}
+
+		return ErrIdentityLinked
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = as.AuthRepository.CreateIdentity(models.Identity{
+		Provider: request.Provider,
+		Subject:  claims.Subject,
+		UserID:   principal.ID,
+		Email:    claims.Email,
+	})
+
+	if errors.Is(err, repository.ErrIdentityExists) {
+		return ErrIdentityLinked
+	}
+
+	return err
+}
+
+func (as *AuthService) ListIdentities(principal models.Principal) ([]models.Identity, error) {
+	return as.AuthRepository.ListIdentities(principal.ID)
+}
+
+// UnlinkIdentity removes the identity of the provider. A user without a
+// password can still sign in after setting one with a password reset.
+func (as *AuthService) UnlinkIdentity(principal models.Principal, provider string) error {
+	err := as.AuthRepository.DeleteIdentity(principal.ID, provider)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIdentityNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"DiaSync/config"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// oidcRepository keeps the issued nonces and links every identity, the rest
+// of repository.Authorization isn't used.
+type oidcRepository struct {
+	repository.Authorization
+	nonces map[string]time.Time
+}
+
+func (r *oidcRepository) CreateOIDCNonce(nonce string, expiresAt time.Time) error {
+	r.nonces[nonce] = expiresAt
+	return nil
+}
+
+func (r *oidcRepository) ConsumeOIDCNonce(nonce string) error {
+	expiresAt, ok := r.nonces[nonce]
+	delete(r.nonces, nonce)
+
+	if !ok || expiresAt.Before(time.Now()) {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *oidcRepository) FindIdentity(provider, subject string) (models.Identity, error) {
+	return models.Identity{}, sql.ErrNoRows
+}
+
+func (r *oidcRepository) CreateIdentity(identity models.Identity) error {
+	return nil
+}
+
+// testIDTokens returns ID tokens of the "google" provider signed by a key
+// the provider is configured with.
+func testIDTokens(t *testing.T) func(nonce string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := json.Marshal(utils.JWKSet{Keys: []utils.JWK{{
+		Kty: "RSA",
+		Kid: "k1",
+		Use: "sig",
+		Alg: utils.AlgorithmRS256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "google.json")
+
+	if err := os.WriteFile(file, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	utils.InitOIDC(config.OIDC{Providers: map[string]config.OIDCProvider{
+		"google": {Issuers: []string{"https://accounts.google.com"}, ClientIDs: []string{"app.diasync"}, JWKSFile: file},
+	}})
+	t.Cleanup(func() { utils.InitOIDC(config.OIDC{}) })
+
+	return func(nonce string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &utils.IDTokenClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "https://accounts.google.com",
+				Subject:   "1234567890",
+				Audience:  "app.diasync",
+				ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			},
+			Nonce: nonce,
+		})
+		token.Header["kid"] = "k1"
+
+		signed, err := token.SignedString(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+}
+
+func TestAuthService_LinkIdentity_Nonce(t *testing.T) {
+	idToken := testIDTokens(t)
+	repo := &oidcRepository{nonces: map[string]time.Time{}}
+	as := &AuthService{AuthRepository: repo, Events: NewPublisher()}
+	principal := models.Principal{ID: "u1"}
+
+	nonce, err := as.BeginOIDCLogin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := models.LinkIdentityR{Provider: "google", IDToken: idToken(nonce.Nonce), Nonce: nonce.Nonce}
+
+	if err := as.LinkIdentity(principal, request); err != nil {
+		t.Fatalf("got %v with an issued nonce", err)
+	}
+
+	if err := as.LinkIdentity(principal, request); err != utils.ErrInvalidIDToken {
+		t.Errorf("got %v, a replayed token must be rejected", err)
+	}
+
+	request = models.LinkIdentityR{Provider: "google", IDToken: idToken("chosen"), Nonce: "chosen"}
+
+	if err := as.LinkIdentity(principal, request); err != utils.ErrInvalidIDToken {
+		t.Errorf("got %v, a nonce the server didn't issue must be rejected", err)
+	}
+}
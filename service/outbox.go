@@ -0,0 +1,85 @@
+package service
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+func NewOutboxWorker(authRepository repository.Authorization, sender mailer.Mailer) *OutboxWorker {
+	return &OutboxWorker{AuthRepository: authRepository, Mailer: sender}
+}
+
+// OutboxWorker delivers the emails queued by AuthService. Every instance of
+// the server runs one, claims keep them from sending an email twice.
+type OutboxWorker struct {
+	AuthRepository repository.Authorization
+	Mailer         mailer.Mailer
+}
+
+// Run delivers the due emails until the process exits. A full batch is
+// followed by the next one right away.
+func (w *OutboxWorker) Run() {
+	for {
+		claimed, err := w.DeliverBatch()
+
+		if err != nil {
+			log.Println("outbox: " + err.Error())
+		}
+
+		if err != nil || claimed < utils.OutboxBatchSize() {
+			time.Sleep(utils.OutboxInterval())
+		}
+	}
+}
+
+// DeliverBatch sends one batch of due emails and returns how many were
+// claimed. A failed email is retried later or dead-lettered, that isn't an
+// error of the batch.
+func (w *OutboxWorker) DeliverBatch() (int, error) {
+	emails, err := w.AuthRepository.ClaimEmails(utils.OutboxBatchSize(), time.Now().Add(utils.OutboxLease()))
+
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+
+	for _, email := range emails {
+		err = w.Mailer.Send(mailer.Email{To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML,
+			Notification: email.Notification})
+
+		if err == nil {
+			err = w.AuthRepository.MarkEmailSent(email.ID)
+		} else {
+			err = w.AuthRepository.FailEmail(email.ID, err.Error(),
+				time.Now().Add(utils.OutboxRetryDelay(email.Attempts)), utils.OutboxDead(email.Attempts))
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return len(emails), errors.Join(errs...)
+}
+
+func (as *AuthService) ListFailedEmails() ([]models.OutboxEmail, error) {
+	return as.AuthRepository.ListFailedEmails()
+}
+
+// RetryEmail queues a failed email again, also a dead-lettered one.
+func (as *AuthService) RetryEmail(id int64) error {
+	err := as.AuthRepository.RetryEmail(id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEmailNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"DiaSync/mailer"
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// outboxRepository keeps the outcome of every claimed email, the rest of
+// repository.Authorization isn't used by the worker.
+type outboxRepository struct {
+	repository.Authorization
+	emails []models.OutboxEmail
+	sent   []int64
+	failed map[int64]bool
+}
+
+func (r *outboxRepository) ClaimEmails(limit int, leaseUntil time.Time) ([]models.OutboxEmail, error) {
+	return r.emails, nil
+}
+
+func (r *outboxRepository) MarkEmailSent(id int64) error {
+	r.sent = append(r.sent, id)
+	return nil
+}
+
+func (r *outboxRepository) FailEmail(id int64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	r.failed[id] = dead
+	return nil
+}
+
+// failingMailer rejects the emails to one address.
+type failingMailer struct {
+	*mailer.MemoryMailer
+	to string
+}
+
+func (m failingMailer) Send(email mailer.Email) error {
+	if email.To == m.to {
+		return errors.New("550 mailbox unavailable")
+	}
+
+	return m.MemoryMailer.Send(email)
+}
+
+func TestOutboxWorker_DeliverBatch(t *testing.T) {
+	repo := &outboxRepository{
+		emails: []models.OutboxEmail{
+			{ID: 1, To: "dmitrkozyrev2@gmail.com", Subject: "Confirm your email", Attempts: 1},
+			{ID: 2, To: "bounce@mail.com", Attempts: 1},
+			{ID: 3, To: "bounce@mail.com", Attempts: 8},
+		},
+		failed: map[int64]bool{},
+	}
+	sender := failingMailer{mailer.NewMemoryMailer(), "bounce@mail.com"}
+
+	claimed, err := NewOutboxWorker(repo, sender).DeliverBatch()
+
+	if err != nil || claimed != 3 {
+		t.Fatalf("got %d, %v", claimed, err)
+	}
+
+	if sent := sender.Sent(); len(sent) != 1 || sent[0].Subject != "Confirm your email" {
+		t.Errorf("got sent %v", sent)
+	}
+
+	if len(repo.sent) != 1 || repo.sent[0] != 1 {
+		t.Errorf("got sent %v, want [1]", repo.sent)
+	}
+
+	if dead, ok := repo.failed[2]; !ok || dead {
+		t.Errorf("email 2 should be retried")
+	}
+
+	if !repo.failed[3] || !utils.OutboxDead(8) {
+		t.Errorf("email 3 should be dead-lettered")
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"DiaSync/models"
+	"DiaSync/repository"
+	"DiaSync/utils"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+)
+
+// BeginPasskeyRegistration starts adding a passkey to the signed in user.
+func (as *AuthService) BeginPasskeyRegistration(principal models.Principal) (models.WebAuthnOptions, error) {
+	user, err := as.passkeyUser(principal.ID, principal.Email)
+
+	if err != nil {
+		return models.WebAuthnOptions{}, err
+	}
+
+	if user.Handle == nil {
+		user.Handle, err = utils.NewPasskeyUserHandle()
+
+		if err != nil {
+			return models.WebAuthnOptions{}, err
+		}
+	}
+
+	options, sessionData, err := utils.BeginPasskeyRegistration(user)
+
+	if err != nil {
+		return models.WebAuthnOptions{}, err
+	}
+
+	return as.saveWebAuthnChallenge(principal.ID, utils.CeremonyRegistration, options, sessionData)
+}
+
+func (as *AuthService) FinishPasskeyRegistration(principal models.Principal, request models.PasskeyRegistrationR) error {
+	challenge, err := as.consumeWebAuthnChallenge(request.ChallengeID, utils.CeremonyRegistration)
+
+	if err != nil {
+		return err
+	}
+
+	if challenge.UserID != principal.ID {
+		return utils.ErrInvalidPasskey
+	}
+
+	user, err := as.passkeyUser(principal.ID, principal.Email)
+
+	if err != nil {
+		return err
+	}
+
+	credential, err := utils.FinishPasskeyRegistration(user, challenge.SessionData, request.Credential)
+
+	if err != nil {
+		return err
+	}
+
+	credential.Name = request.Name
+
+	return as.AuthRepository.CreateWebAuthnCredential(credential)
+}
+
+// BeginPasskeyLogin starts a login with any passkey of the relying party. If
+// accounts may be revealed and the email has passkeys, only they are offered.
+// Otherwise the email is ignored, all passkeys are discoverable anyway.
+func (as *AuthService) BeginPasskeyLogin(request models.PasskeyLoginBeginR) (models.WebAuthnOptions, error) {
+	var user *utils.PasskeyUser
+
+	if request.Email != "" && utils.RevealAccounts() {
+		known, err := as.AuthRepository.FindUser(request.Email)
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnOptions{}, err
+		}
+
+		if err == nil {
+			passkeyUser, err := as.passkeyUser(known.ID, known.Email)
+
+			if err != nil {
+				return models.WebAuthnOptions{}, err
+			}
+
+			if len(passkeyUser.Credentials) > 0 {
+				user = &passkeyUser
+			}
+		}
+	}
+
+	options, sessionData, err := utils.BeginPasskeyLogin(user)
+
+	if err != nil {
+		return models.WebAuthnOptions{}, err
+	}
+
+	userID := ""
+
+	if user != nil {
+		userID = user.ID
+	}
+
+	return as.saveWebAuthnChallenge(userID, utils.CeremonyLogin, options, sessionData)
+}
+
+// FinishPasskeyLogin verifies the assertion and issues the same tokens and
+// session as a password login. The passkey verified the user, so no MFA
+// challenge follows.
+func (as *AuthService) FinishPasskeyLogin(request models.PasskeyLoginR) (models.LoginResult, error) {
+	challenge, err := as.consumeWebAuthnChallenge(request.ChallengeID, utils.CeremonyLogin)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	credential, err := utils.FinishPasskeyLogin(challenge.SessionData, request.Credential, as.findPasskeyUser)
+
+	if err == nil {
+		err = as.AuthRepository.UpdateWebAuthnSignCount(credential)
+	}
+
+	if errors.Is(err, utils.ErrPasskeyCloned) || errors.Is(err, repository.ErrSignCountUsed) {
+		as.publish(SecurityEvent{Type: EventPasskeyCloned, UserID: credential.UserID,
+			Details: base64.RawURLEncoding.EncodeToString(credential.ID)})
+
+		return models.LoginResult{}, utils.ErrPasskeyCloned
+	}
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	user, err := as.AuthRepository.FindUserByID(credential.UserID)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	if user.Locked {
+		return models.LoginResult{}, ErrAccountLocked
+	}
+
+	device := models.Device{
+		ID:        request.DeviceID,
+		Name:      request.DeviceName,
+		Platform:  request.Platform,
+		IP:        request.IP,
+		UserAgent: request.UserAgent,
+	}
+
+	access_token, refresh_token, err := as.issueTokens(user, device)
+
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	return models.LoginResult{AccessToken: access_token, RefreshToken: refresh_token}, nil
+}
+
+// passkeyUser returns the user with every registered passkey. The handle is
+// nil until the first passkey is registered.
+func (as *AuthService) passkeyUser(userID, email string) (utils.PasskeyUser, error) {
+	credentials, err := as.AuthRepository.ListWebAuthnCredentials(userID)
+
+	if err != nil {
+		return utils.PasskeyUser{}, err
+	}
+
+	user := utils.PasskeyUser{ID: userID, Email: email, Credentials: credentials}
+
+	if len(credentials) > 0 {
+		user.Handle = credentials[0].UserHandle
+	}
+
+	return user, nil
+}
+
+func (as *AuthService) findPasskeyUser(credentialID, userHandle []byte) (utils.PasskeyUser, error) {
+	credential, err := as.AuthRepository.FindWebAuthnCredential(credentialID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.PasskeyUser{}, utils.ErrInvalidPasskey
+	}
+
+	if err != nil {
+		return utils.PasskeyUser{}, err
+	}
+
+	if !bytes.Equal(credential.UserHandle, userHandle) {
+		return utils.PasskeyUser{}, utils.ErrInvalidPasskey
+	}
+
+	user, err := as.AuthRepository.FindUserByID(credential.UserID)
+
+	if err != nil {
+		return utils.PasskeyUser{}, err
+	}
+
+	return as.passkeyUser(user.ID, user.Email)
+}
+
+func (as *AuthService) saveWebAuthnChallenge(userID, ceremony string, options, sessionData []byte) (models.WebAuthnOptions, error) {
+	id, err := utils.RandomString(16)
+
+	if err != nil {
+		return models.WebAuthnOptions{}, err
+	}
+
+	err = as.AuthRepository.CreateWebAuthnChallenge(models.WebAuthnChallenge{
+		ID:          id,
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: sessionData,
+		ExpiresAt:   utils.WebAuthnExpiresAt(),
+	})
+
+	if err != nil {
+		return models.WebAuthnOptions{}, err
+	}
+
+	return models.WebAuthnOptions{ChallengeID: id, Options: options}, nil
+}
+
+func (as *AuthService) consumeWebAuthnChallenge(id, ceremony string) (models.WebAuthnChallenge, error) {
+	challenge, err := as.AuthRepository.ConsumeWebAuthnChallenge(id, ceremony)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.WebAuthnChallenge{}, utils.ErrInvalidPasskey
+	}
+
+	return challenge, err
+}
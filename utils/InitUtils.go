@@ -2,39 +2,282 @@ package utils
 
 import (
 	"DiaSync/config"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 var SecretKey string
+var keyManager = NewHMACKeyManager("")
 var accessExpire time.Duration
 var refreshExpire time.Duration
 var verifyEmailExpire time.Duration
 var passwordExpire time.Duration
-
-var appPassword string
-var sender string
-var smtpServer string
-var smtpAdr string
-
-var serverAdr string
+var inviteExpire time.Duration
+var mfaExpire time.Duration = 300
+var webauthnExpire time.Duration = 300
+var magicLinkExpire time.Duration = 600
+var oidcNonceExpire time.Duration = 600
+var emailChangeExpire time.Duration = 86400
+var emailUndoExpire time.Duration = 604800
+var secureAccountExpire time.Duration = 604800
+var issuer = "DiaSync"
+var audience = "DiaSync"
 
 func Init(cfg config.Config) {
-	serverAdr = cfg.ServerAdr
-	InitEmail(cfg.Email)
+	InitLinks(cfg.HttpServer)
 	InitToken(cfg.Token)
-}
-
-func InitEmail(cfg config.Email) {
-	appPassword = cfg.AppPassword
-	sender = cfg.Sender
-	smtpServer = cfg.SmtpServer
-	smtpAdr = cfg.SmtpAdr
+	InitPassword(cfg.PasswordHash)
+	InitMFA(cfg.MFA)
+	InitWebAuthn(cfg.WebAuthn)
+	InitMagicLink(cfg.MagicLink)
+	InitOIDC(cfg.OIDC)
+	InitLockout(cfg.Lockout)
+	InitPasswordPolicy(cfg.PasswordPolicy)
+	InitEnumeration(cfg.Enumeration)
+	InitOutbox(cfg.Outbox)
 }
 
 func InitToken(cfg config.Token) {
 	SecretKey = cfg.SecretKey
+	keyManager = NewHMACKeyManager(cfg.SecretKey)
+
+	if cfg.KeysDir != "" {
+		var err error
+		keyManager, err = LoadKeyManager(cfg.KeysDir, cfg.SecretKey)
+
+		if err != nil {
+			panic("Can't load signing keys: " + err.Error())
+		}
+	}
 	accessExpire = cfg.AccessExpire
 	refreshExpire = cfg.RefreshExpire
 	verifyEmailExpire = cfg.VerifyEmailExpire
 	passwordExpire = cfg.PasswordExpire
+	inviteExpire = cfg.InviteExpire
+
+	if cfg.EmailChangeExpire != 0 {
+		emailChangeExpire = cfg.EmailChangeExpire
+	}
+
+	if cfg.EmailUndoExpire != 0 {
+		emailUndoExpire = cfg.EmailUndoExpire
+	}
+
+	if cfg.SecureAccountExpire != 0 {
+		secureAccountExpire = cfg.SecureAccountExpire
+	}
+
+	if cfg.Issuer != "" {
+		issuer = cfg.Issuer
+	}
+
+	if cfg.Audience != "" {
+		audience = cfg.Audience
+	}
+}
+
+func InitPassword(cfg config.PasswordHash) {
+	if cfg.Algorithm != "" {
+		if cfg.Algorithm != AlgorithmArgon2id && cfg.Algorithm != AlgorithmBcrypt {
+			panic("Unknown password_hash.algorithm: " + cfg.Algorithm)
+		}
+
+		passwordCfg.algorithm = cfg.Algorithm
+	}
+
+	if cfg.Memory != 0 {
+		passwordCfg.memory = cfg.Memory
+	}
+
+	if cfg.Iterations != 0 {
+		passwordCfg.iterations = cfg.Iterations
+	}
+
+	if cfg.Parallelism != 0 {
+		passwordCfg.parallelism = cfg.Parallelism
+	}
+
+	if cfg.SaltLength != 0 {
+		passwordCfg.saltLength = cfg.SaltLength
+	}
+
+	if cfg.KeyLength != 0 {
+		passwordCfg.keyLength = cfg.KeyLength
+	}
+
+	if cfg.BcryptCost != 0 {
+		passwordCfg.bcryptCost = cfg.BcryptCost
+	}
+}
+
+func InitMFA(cfg config.MFA) {
+	mfaRequiredRoles = map[string]bool{}
+
+	for _, role := range cfg.RequiredRoles {
+		if !IsValidRole(role) {
+			panic("Unknown role in mfa.required_roles: " + role)
+		}
+
+		mfaRequiredRoles[role] = true
+	}
+
+	if cfg.ChallengeExpire != 0 {
+		mfaExpire = cfg.ChallengeExpire
+	}
+
+	if cfg.MaxAttempts != 0 {
+		mfaMaxAttempts = cfg.MaxAttempts
+	}
+
+	if cfg.SecretKeyFile == "" {
+		panic("mfa.secret_key_file is required")
+	}
+
+	var err error
+	totpKey, err = LoadTOTPKey(cfg.SecretKeyFile)
+
+	if err != nil {
+		panic("Can't load mfa.secret_key_file: " + err.Error())
+	}
+}
+
+func InitWebAuthn(cfg config.WebAuthn) {
+	relyingParty = nil
+
+	if cfg.ChallengeExpire != 0 {
+		webauthnExpire = cfg.ChallengeExpire
+	}
+
+	if cfg.RPID == "" {
+		return
+	}
+
+	var err error
+	relyingParty, err = webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+	})
+
+	if err != nil {
+		panic("Can't init webauthn: " + err.Error())
+	}
+}
+
+func InitMagicLink(cfg config.MagicLink) {
+	magicLinkEnabled = cfg.Enabled
+
+	if cfg.Expire != 0 {
+		magicLinkExpire = cfg.Expire
+	}
+
+	if cfg.MaxAttempts != 0 {
+		magicLinkMaxAttempts = cfg.MaxAttempts
+	}
+}
+
+func InitOIDC(cfg config.OIDC) {
+	oidcProviders = map[string]*oidcProvider{}
+
+	for name, provider := range cfg.Providers {
+		if len(provider.Issuers) == 0 || len(provider.ClientIDs) == 0 ||
+			provider.JWKSURL == "" && provider.JWKSFile == "" {
+			panic("Incomplete oidc provider: " + name)
+		}
+
+		oidcProviders[name] = &oidcProvider{OIDCProvider: provider}
+	}
+
+	if cfg.JWKSCacheTTL != 0 {
+		oidcCacheTTL = cfg.JWKSCacheTTL
+	}
+
+	if cfg.NonceExpire != 0 {
+		oidcNonceExpire = cfg.NonceExpire
+	}
+}
+
+func InitLockout(cfg config.Lockout) {
+	if cfg.Threshold != 0 {
+		lockoutCfg.threshold = cfg.Threshold
+	}
+
+	if cfg.BaseDelay != 0 {
+		lockoutCfg.baseDelay = cfg.BaseDelay * time.Second
+	}
+
+	if cfg.MaxDelay != 0 {
+		lockoutCfg.maxDelay = cfg.MaxDelay * time.Second
+	}
+}
+
+func InitPasswordPolicy(cfg config.PasswordPolicy) {
+	if cfg.MinLength != 0 {
+		policyCfg.minLength = cfg.MinLength
+	}
+
+	if cfg.MaxLength != 0 {
+		policyCfg.maxLength = cfg.MaxLength
+	}
+
+	policyCfg.requireLower = cfg.RequireLower
+	policyCfg.requireUpper = cfg.RequireUpper
+	policyCfg.requireDigit = cfg.RequireDigit
+	policyCfg.requireSymbol = cfg.RequireSymbol
+	policyCfg.allowEmail = cfg.AllowEmail
+	policyCfg.breachedDir = cfg.BreachedDir
+}
+
+func InitEnumeration(cfg config.Enumeration) {
+	revealAccounts = cfg.RevealAccounts
+
+	if cfg.MinResponseTime != 0 {
+		minResponseTime = cfg.MinResponseTime * time.Millisecond
+	}
+}
+
+func InitOutbox(cfg config.Outbox) {
+	if cfg.Interval != 0 {
+		outboxCfg.interval = cfg.Interval * time.Second
+	}
+
+	if cfg.BatchSize != 0 {
+		outboxCfg.batchSize = cfg.BatchSize
+	}
+
+	if cfg.MaxAttempts != 0 {
+		outboxCfg.maxAttempts = cfg.MaxAttempts
+	}
+
+	if cfg.BaseDelay != 0 {
+		outboxCfg.baseDelay = cfg.BaseDelay * time.Second
+	}
+
+	if cfg.MaxDelay != 0 {
+		outboxCfg.maxDelay = cfg.MaxDelay * time.Second
+	}
+
+	if cfg.Retention != 0 {
+		outboxCfg.retention = cfg.Retention * time.Second
+	}
+}
+
+func InitLinks(cfg config.HttpServer) {
+	publicURL = "http://" + cfg.ServerAdr
+
+	if cfg.PublicURL != "" {
+		parsed, err := url.Parse(cfg.PublicURL)
+
+		if err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+			panic("Invalid public_url: " + cfg.PublicURL)
+		}
+
+		publicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	}
+
+	appLinks = cfg.AppLinks
+	appLinks.URL = strings.TrimSuffix(cfg.AppLinks.URL, "/")
 }
@@ -1,27 +1,75 @@
 package utils
 
 import (
-	"net/smtp"
+	"DiaSync/config"
+	"net/url"
 )
 
-func SendVerifyTokenMail(email, verifyEmailToken string) error {
-	auth := smtp.PlainAuth("", sender, appPassword, smtpServer)
+// Paths of the links sent in emails. GET shows a landing page for the mail
+// client, POST is used by the app and by the form of the page.
+const (
+	LinkVerifyEmail        = "/auth/verify-email"
+	LinkResetPassword      = "/auth/verify-newpassword"
+	LinkMagicLink          = "/auth/magic-link/verify"
+	LinkConfirmEmailChange = "/auth/confirm-email-change"
+	LinkUndoEmailChange    = "/auth/undo-email-change"
+	LinkSecureAccount      = "/auth/secure-account"
+)
+
+var LinkPaths = []string{LinkVerifyEmail, LinkResetPassword, LinkMagicLink, LinkConfirmEmailChange,
+	LinkUndoEmailChange, LinkSecureAccount}
 
-	msg := "Subject: Verify Email\nClick on the link to confirm your email\nhttp://" +
-		serverAdr + "/auth/verify-email?token=" + verifyEmailToken
+var publicURL = "http://localhost"
+var appLinks config.AppLinks
+
+// EmailLink returns the link with the token sent in an email.
+func EmailLink(path, token string) string {
+	return publicURL + path + "?token=" + url.QueryEscape(token)
+}
 
-	err := smtp.SendMail(smtpAdr, auth, sender, []string{email}, []byte(msg))
+// AppLink returns the deep link finishing the flow in the app, empty without
+// the app configured.
+func AppLink(path, token string) string {
+	if appLinks.URL == "" {
+		return ""
+	}
 
-	return err
+	return appLinks.URL + path + "?token=" + url.QueryEscape(token)
 }
 
-func SendNewPasswordEmail(email, newPasswordToken string) error {
-	auth := smtp.PlainAuth("", sender, appPassword, smtpServer)
+// AppleAppSiteAssociation returns the document letting iOS open the emailed
+// links in the app, false without Apple app ids.
+func AppleAppSiteAssociation() (any, bool) {
+	if len(appLinks.AppleAppIDs) == 0 {
+		return nil, false
+	}
 
-	msg := "Subject: Verify Email\nClick on the link to confirm your email\nhttp://" +
-		serverAdr + "/auth/verify-newpassword?token=" + newPasswordToken
+	components := []map[string]string{}
+
+	for _, path := range LinkPaths {
+		components = append(components, map[string]string{"/": path})
+	}
+
+	return map[string]any{
+		"applinks": map[string]any{
+			"details": []map[string]any{{"appIDs": appLinks.AppleAppIDs, "components": components}},
+		},
+	}, true
+}
 
-	err := smtp.SendMail(smtpAdr, auth, sender, []string{email}, []byte(msg))
+// AssetLinks returns the Digital Asset Links statement letting Android open
+// the emailed links in the app, false without an Android package.
+func AssetLinks() (any, bool) {
+	if appLinks.AndroidPackage == "" {
+		return nil, false
+	}
 
-	return err
+	return []map[string]any{{
+		"relation": []string{"delegate_permission/common.handle_all_urls"},
+		"target": map[string]any{
+			"namespace":                "android_app",
+			"package_name":             appLinks.AndroidPackage,
+			"sha256_cert_fingerprints": appLinks.AndroidCertFingerprints,
+		},
+	}}, true
 }
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"encoding/json"
+	"testing"
+)
+
+func TestEmailLink(t *testing.T) {
+	defer func(url string, links config.AppLinks) { publicURL, appLinks = url, links }(publicURL, appLinks)
+
+	InitLinks(config.HttpServer{ServerAdr: "localhost:8080"})
+
+	if got := EmailLink(LinkVerifyEmail, "a+b"); got != "http://localhost:8080/auth/verify-email?token=a%2Bb" {
+		t.Errorf("got %s", got)
+	}
+
+	if got := AppLink(LinkVerifyEmail, "a+b"); got != "" {
+		t.Errorf("got app link %s without the app", got)
+	}
+
+	InitLinks(config.HttpServer{ServerAdr: "localhost:8080", PublicURL: "https://id.diasync.ru/",
+		AppLinks: config.AppLinks{URL: "diasync://app/"}})
+
+	if got := EmailLink(LinkResetPassword, "abc"); got != "https://id.diasync.ru/auth/verify-newpassword?token=abc" {
+		t.Errorf("got %s", got)
+	}
+
+	if got := AppLink(LinkMagicLink, "abc"); got != "diasync://app/auth/magic-link/verify?token=abc" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestInitLinks_InvalidPublicURL(t *testing.T) {
+	defer func(url string, links config.AppLinks) { publicURL, appLinks = url, links }(publicURL, appLinks)
+
+	for _, invalid := range []string{"id.diasync.ru", "ftp://id.diasync.ru", "https://"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: got no panic", invalid)
+				}
+			}()
+
+			InitLinks(config.HttpServer{PublicURL: invalid})
+		}()
+	}
+}
+
+func TestAppLinkDocuments(t *testing.T) {
+	defer func(links config.AppLinks) { appLinks = links }(appLinks)
+
+	appLinks = config.AppLinks{}
+
+	if _, ok := AppleAppSiteAssociation(); ok {
+		t.Error("got apple-app-site-association without app ids")
+	}
+
+	if _, ok := AssetLinks(); ok {
+		t.Error("got assetlinks.json without a package")
+	}
+
+	appLinks = config.AppLinks{AppleAppIDs: []string{"TEAM.ru.diasync"}, AndroidPackage: "ru.diasync",
+		AndroidCertFingerprints: []string{"AA:BB"}}
+
+	association, _ := AppleAppSiteAssociation()
+	statements, _ := AssetLinks()
+
+	got, _ := json.Marshal([]any{association, statements})
+	want := `[{"applinks":{"details":[{"appIDs":["TEAM.ru.diasync"],"components":[{"/":"/auth/verify-email"},` +
+		`{"/":"/auth/verify-newpassword"},{"/":"/auth/magic-link/verify"},{"/":"/auth/confirm-email-change"},` +
+		`{"/":"/auth/undo-email-change"},{"/":"/auth/secure-account"}]}]}},[{"relation":["delegate_permission/common.handle_all_urls"],` +
+		`"target":{"namespace":"android_app","package_name":"ru.diasync","sha256_cert_fingerprints":["AA:BB"]}}]]`
+
+	if string(got) != want {
+		t.Errorf("got %s", got)
+	}
+}
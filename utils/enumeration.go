@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+var revealAccounts bool
+var minResponseTime = time.Second
+
+var dummyHash struct {
+	once sync.Once
+	hash string
+}
+
+// RevealAccounts reports whether responses may tell that an account with an
+// email exists.
+func RevealAccounts() bool {
+	return revealAccounts
+}
+
+// PadResponseTime sleeps until the minimum response time has passed since
+// start. Endpoints sending an email only to existing accounts defer it, so
+// the time taken doesn't tell whether the account exists.
+func PadResponseTime(start time.Time) {
+	time.Sleep(time.Until(start.Add(minResponseTime)))
+}
+
+// CompareDummyHash checks the password against a hash of the configured
+// algorithm and cost, so a login for an unknown email takes as long as one
+// with a wrong password.
+func CompareDummyHash(password string) {
+	dummyHash.once.Do(func() {
+		dummyHash.hash, _ = HashPassword("dummy password")
+	})
+
+	CheckPasswordHash(password, dummyHash.hash)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"testing"
+	"time"
+)
+
+func TestPadResponseTime(t *testing.T) {
+	defer func(d time.Duration) { minResponseTime = d }(minResponseTime)
+
+	InitEnumeration(config.Enumeration{MinResponseTime: 50})
+
+	start := time.Now()
+	PadResponseTime(start)
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v, want at least 50ms", elapsed)
+	}
+
+	start = time.Now()
+	PadResponseTime(start.Add(-time.Second))
+
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("slow response padded by %v", elapsed)
+	}
+}
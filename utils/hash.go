@@ -1,17 +1,201 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(password))
-	return hex.EncodeToString(hasher.Sum(nil))
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// bcryptMaxPassword is the longest password in bytes bcrypt can hash.
+const bcryptMaxPassword = 72
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type passwordParams struct {
+	algorithm   string
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+	bcryptCost  int
 }
 
+var passwordCfg = passwordParams{
+	algorithm:   AlgorithmArgon2id,
+	memory:      64 * 1024,
+	iterations:  3,
+	parallelism: 2,
+	saltLength:  16,
+	keyLength:   32,
+	bcryptCost:  bcrypt.DefaultCost,
+}
+
+// HashPassword hashes the password with the configured algorithm. Argon2id
+// hashes are returned in PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	if passwordCfg.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCfg.bcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, passwordCfg.saltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, passwordCfg.iterations, passwordCfg.memory,
+		passwordCfg.parallelism, passwordCfg.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		passwordCfg.memory, passwordCfg.iterations, passwordCfg.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPasswordHash compares the password with a hash produced by any of the
+// supported algorithms, including legacy unsalted SHA-256 hex digests.
 func CheckPasswordHash(password, hashedPassword string) bool {
-	real_hash := HashPassword(password)
-	return real_hash == hashedPassword
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hashedPassword)
+
+		if err != nil {
+			return false
+		}
+
+		otherKey := argon2.IDKey([]byte(password), salt, params.iterations, params.memory,
+			params.parallelism, params.keyLength)
+
+		return subtle.ConstantTimeCompare(key, otherKey) == 1
+
+	case isBcryptHash(hashedPassword):
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+
+	case isLegacyHash(hashedPassword):
+		realHash := legacyHashPassword(password)
+		return subtle.ConstantTimeCompare([]byte(realHash), []byte(hashedPassword)) == 1
+	}
+
+	return false
+}
+
+// NeedsRehash reports whether the hash was produced by a legacy algorithm or
+// with parameters weaker than the currently configured ones.
+func NeedsRehash(hashedPassword string) bool {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		if passwordCfg.algorithm != AlgorithmArgon2id {
+			return true
+		}
+
+		params, salt, _, err := decodeArgon2id(hashedPassword)
+
+		if err != nil {
+			return true
+		}
+
+		return params.memory != passwordCfg.memory ||
+			params.iterations != passwordCfg.iterations ||
+			params.parallelism != passwordCfg.parallelism ||
+			params.keyLength != passwordCfg.keyLength ||
+			uint32(len(salt)) != passwordCfg.saltLength
+
+	case isBcryptHash(hashedPassword):
+		if passwordCfg.algorithm != AlgorithmBcrypt {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+
+		return err != nil || cost != passwordCfg.bcryptCost
+	}
+
+	return true
+}
+
+func decodeArgon2id(hashedPassword string) (passwordParams, []byte, []byte, error) {
+	var params passwordParams
+
+	parts := strings.Split(hashedPassword, "$")
+
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	// An empty key would match every password and zero costs make argon2 panic.
+	if len(salt) == 0 || len(key) == 0 || params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.algorithm = AlgorithmArgon2id
+	params.keyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func isBcryptHash(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") ||
+		strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
+}
+
+func isLegacyHash(hashedPassword string) bool {
+	if len(hashedPassword) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hashedPassword)
+
+	return err == nil
+}
+
+// legacyHashPassword is the unsalted SHA-256 digest used before Argon2id.
+// It is only kept to verify and upgrade old hashes on login.
+func legacyHashPassword(password string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(password))
+	return hex.EncodeToString(hasher.Sum(nil))
 }
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"DiaSync/config"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
-func TestHashPassword(t *testing.T) {
+func TestLegacyHashPassword(t *testing.T) {
 	var testCases = []struct {
 		in  string
 		out string
@@ -15,7 +19,7 @@ func TestHashPassword(t *testing.T) {
 	}
 
 	for _, tt := range testCases {
-		result := HashPassword(tt.in)
+		result := legacyHashPassword(tt.in)
 
 		if result != tt.out {
 			t.Errorf("got %s, want %s", result, tt.out)
@@ -23,7 +27,59 @@ func TestHashPassword(t *testing.T) {
 	}
 }
 
+func TestHashPassword(t *testing.T) {
+	var testCases = []string{"AsddF", "1231", "123jh3H"}
+
+	for _, password := range testCases {
+		first, err := HashPassword(password)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := HashPassword(password)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(first, "$argon2id$v=19$m=65536,t=3,p=2$") {
+			t.Errorf("unexpected hash format %s", first)
+		}
+
+		if first == second {
+			t.Error("hashes of the same password must use different salts")
+		}
+
+		if !CheckPasswordHash(password, first) || !CheckPasswordHash(password, second) {
+			t.Errorf("password %s doesn't match its hash", password)
+		}
+
+		if NeedsRehash(first) {
+			t.Errorf("fresh hash %s needs rehash", first)
+		}
+	}
+}
+
+func TestInitPassword_UnknownAlgorithm(t *testing.T) {
+	defer func(cfg passwordParams) { passwordCfg = cfg }(passwordCfg)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown algorithm must panic")
+		}
+	}()
+
+	InitPassword(config.PasswordHash{Algorithm: "argon2"})
+}
+
 func TestCheckPasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("AsddF"), bcrypt.MinCost)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	var testCases = []struct {
 		password string
 		hash     string
@@ -32,6 +88,15 @@ func TestCheckPasswordHash(t *testing.T) {
 		{"AsddF", "ae6a139b7d39cf004bbac3b8bb25acf420b654d61cf2296d603d148daadc1ff0", true},
 		{"12315", "52a6eb687cd22e80d3342eac6fcc7f2e19209e8f83eb9b82e81c6f3e6f30743b", false},
 		{"123jh3H", "c0a89ad3417d97b330bb4f62b4932f5e060baea22d1e2ce4c43096402f7e74f6a", false},
+		{"AsddF", string(bcryptHash), true},
+		{"asddf", string(bcryptHash), false},
+		{"AsddF", "$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$broken", false},
+		{"AsddF", "$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHQ$", false},
+		{"AsddF", "$argon2id$v=19$m=16,t=1,p=1$$c2FsdHNhbHRzYWx0c2FsdA", false},
+		{"AsddF", "$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$c2FsdHNhbHRzYWx0c2FsdA", false},
+		{"AsddF", "$argon2id$v=19$m=16,t=0,p=1$c2FsdHNhbHQ$c2FsdHNhbHRzYWx0c2FsdA", false},
+		{"AsddF", "$argon2id$v=19$m=16,t=1,p=0$c2FsdHNhbHQ$c2FsdHNhbHRzYWx0c2FsdA", false},
+		{"AsddF", "", false},
 	}
 
 	for _, tt := range testCases {
@@ -42,3 +107,28 @@ func TestCheckPasswordHash(t *testing.T) {
 		}
 	}
 }
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("AsddF"), bcrypt.MinCost)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		hash string
+		out  bool
+	}{
+		{"ae6a139b7d39cf004bbac3b8bb25acf420b654d61cf2296d603d148daadc1ff0", true},
+		{string(bcryptHash), true},
+		{"$argon2id$v=19$m=16,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$c2FsdHNhbHRzYWx0c2FsdHNhbHRzYWx0c2FsdHNhbHQ", true},
+	}
+
+	for _, tt := range testCases {
+		result := NeedsRehash(tt.hash)
+
+		if result != tt.out {
+			t.Errorf("%s: got %t, want %t", tt.hash, result, tt.out)
+		}
+	}
+}
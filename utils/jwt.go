@@ -1,80 +1,180 @@
 package utils
 
 import (
+	"DiaSync/models"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-func GenerateAccessToken(email, role string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":  email,
-		"role":   role,
-		"expire": time.Now().Add(accessExpire * time.Second).Unix()})
+const (
+	AccessTokenType = "access"
+	InviteTokenType = "invite"
+	MFATokenType    = "mfa"
+)
+
+var (
+	ErrNotAuthorized     = errors.New("not authorized")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrInvalidTokenType  = errors.New("invalid token type")
+	ErrUnexpectedSigning = errors.New("unexpected signing method")
+)
 
-	return token.SignedString([]byte(SecretKey))
+// TokenClaims is implemented by every typed claim set below. The expected
+// type is compared with the "typ" claim, so a token issued for one purpose
+// can't be used for another.
+type TokenClaims interface {
+	jwt.Claims
+	claims() *Claims
+	expectedType() string
 }
 
-func GenerateRefreshToken() (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"expire": time.Now().Add(refreshExpire * time.Second).Unix()})
+// Claims.Version is the user's token version at issue time. It is bumped on
+// password and role changes, which invalidates every issued token.
+type Claims struct {
+	jwt.StandardClaims
+	Type    string `json:"typ"`
+	Version int    `json:"ver"`
+}
 
-	return token.SignedString([]byte(SecretKey))
+func (c *Claims) claims() *Claims {
+	return c
 }
 
-func GenerateVerifyEmailToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":  email,
-		"expire": time.Now().Add(verifyEmailExpire * time.Second).Unix()})
-	return token.SignedString([]byte(SecretKey))
+// AccessClaims identify the user by the id in the subject, the email may
+// change while the token is valid.
+type AccessClaims struct {
+	Claims
+	Role     string `json:"role"`
+	DeviceID string `json:"device_id"`
+	Sid      string `json:"sid"`
 }
 
-func GeneratePasswordToken(email, hashed_password string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":           email,
-		"hashed_password": hashed_password,
-		"expire":          time.Now().Add(passwordExpire * time.Second).Unix()})
+func (c *AccessClaims) expectedType() string { return AccessTokenType }
 
-	return token.SignedString([]byte(SecretKey))
+type InviteClaims struct {
+	Claims
+	Email string `json:"email"`
+	Role  string `json:"role"`
 }
 
-func VerifyToken(token string) error {
-	if token == "" {
-		return errors.New("not authorized")
+func (c *InviteClaims) expectedType() string { return InviteTokenType }
+
+// MFAClaims is issued when the password matched but a second factor is still
+// needed. It carries the device of the login, so the MFA step doesn't have to
+// repeat it.
+type MFAClaims struct {
+	Claims
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Platform   string `json:"platform"`
+}
+
+func (c *MFAClaims) expectedType() string { return MFATokenType }
+
+func newClaims(tokenType, subject string, version int, expire time.Duration) (Claims, error) {
+	jti, err := RandomString(16)
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	now := time.Now()
+
+	return Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: now.Add(expire * time.Second).Unix(),
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			Issuer:    issuer,
+			NotBefore: now.Unix(),
+			Subject:   subject,
+		},
+		Type:    tokenType,
+		Version: version,
+	}, nil
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	return keyManager.Sign(claims)
+}
+
+func GenerateAccessToken(userID, role, deviceID, sessionID string, version int) (string, error) {
+	claims, err := newClaims(AccessTokenType, userID, version, accessExpire)
+
+	if err != nil {
+		return "", err
 	}
 
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	return signToken(&AccessClaims{Claims: claims, Role: role, DeviceID: deviceID, Sid: sessionID})
+}
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
+func GenerateInviteToken(email, role string) (string, error) {
+	claims, err := newClaims(InviteTokenType, email, 0, inviteExpire)
 
-		return []byte(SecretKey), nil
-	})
+	if err != nil {
+		return "", err
+	}
+
+	return signToken(&InviteClaims{Claims: claims, Email: email, Role: role})
+}
+
+func GenerateMFAToken(userID string, device models.Device, version int) (string, error) {
+	claims, err := newClaims(MFATokenType, userID, version, mfaExpire)
 
 	if err != nil {
-		return errors.New("could not parse token")
+		return "", err
 	}
 
-	tokenIsValid := parsedToken.Valid
+	return signToken(&MFAClaims{Claims: claims, DeviceID: device.ID, DeviceName: device.Name,
+		Platform: device.Platform})
+}
 
-	if !tokenIsValid {
-		return errors.New("invalid token")
+// ParseToken verifies the signature, the registered claims and the token
+// purpose, and fills the given typed claims.
+func ParseToken(token string, claims TokenClaims) error {
+	if token == "" {
+		return ErrNotAuthorized
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	parsedToken, err := jwt.ParseWithClaims(token, claims, keyManager.Keyfunc)
 
-	if !ok {
-		return errors.New("invalid token claims")
+	if err != nil || !parsedToken.Valid {
+		return ErrInvalidToken
 	}
 
-	expire := int64(claims["expire"].(float64))
+	standard := claims.claims()
 
-	if time.Now().Unix() > expire {
-		return errors.New("time has expired")
+	if standard.ExpiresAt == 0 || !standard.VerifyIssuer(issuer, true) || !standard.VerifyAudience(audience, true) {
+		return ErrInvalidToken
+	}
+
+	if standard.Type != claims.expectedType() {
+		return ErrInvalidTokenType
 	}
 
 	return nil
 }
+
+// ParseAccessToken verifies the access token and returns the principal it was
+// issued for. The token version still has to be compared with the user's,
+// who also supplies the email.
+func ParseAccessToken(token string) (models.Principal, error) {
+	var claims AccessClaims
+
+	err := ParseToken(token, &claims)
+
+	if err != nil {
+		return models.Principal{}, err
+	}
+
+	return models.Principal{
+		ID:           claims.Subject,
+		Role:         claims.Role,
+		DeviceID:     claims.DeviceID,
+		SessionID:    claims.Sid,
+		TokenVersion: claims.Version,
+	}, nil
+}
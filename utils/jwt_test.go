@@ -1,252 +1,199 @@
 package utils
 
 import (
-	"errors"
+	"DiaSync/config"
+	"DiaSync/models"
+	"os"
 	"testing"
 	"time"
-
-	"github.com/golang-jwt/jwt"
 )
 
+func TestMain(m *testing.M) {
+	InitToken(config.Token{
+		AccessExpire:      60,
+		RefreshExpire:     60,
+		VerifyEmailExpire: 60,
+		PasswordExpire:    60,
+		InviteExpire:      60,
+		SecretKey:         "secret",
+	})
+
+	os.Exit(m.Run())
+}
+
+func checkStandardClaims(t *testing.T, claims *Claims, tokenType string, expire time.Duration) {
+	t.Helper()
+
+	expectedExpire := time.Now().Add(expire * time.Second).Unix()
+
+	if claims.ExpiresAt-expectedExpire > 5 || expectedExpire-claims.ExpiresAt > 5 {
+		t.Error("expire differense more then five second")
+	}
+
+	if claims.Type != tokenType {
+		t.Errorf("got %s, want %s", claims.Type, tokenType)
+	}
+
+	if claims.Issuer != issuer || claims.Audience != audience {
+		t.Errorf("got iss %s aud %s", claims.Issuer, claims.Audience)
+	}
+
+	if claims.Id == "" || claims.IssuedAt == 0 || claims.NotBefore == 0 {
+		t.Error("missing registered claims")
+	}
+}
+
 func TestGenerateAccessToken(t *testing.T) {
 	var testCases = []struct {
-		email  string
+		userID string
 		role   string
-		expire int64
 	}{
-		{"dmitrkozyrev2@gmail.com", "viewer", 0},
-		{"mexasd123@gmail.com", "default", 0},
-		{"romarkovet2004@gmail.com", "viewer", 0},
+		{"0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11", "viewer"},
+		{"7d7e2c1a-93a4-4e55-b2c4-6a0f1b9e3d22", "default"},
+		{"c4a1f9e8-1b2d-4c3e-8f5a-9d6b7e0a1c33", "viewer"},
 	}
 
 	for _, tt := range testCases {
-
-		tt.expire = time.Now().Add(accessExpire * time.Second).Unix()
-		accessToken, err := GenerateAccessToken(tt.email, tt.role)
+		accessToken, err := GenerateAccessToken(tt.userID, tt.role, "DDD", "SSS", 3)
 
 		if err != nil {
 			t.Error(err)
 		}
 
-		parsedToken, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+		var claims AccessClaims
 
-			if !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-
-			return []byte(SecretKey), nil
-		})
+		err = ParseToken(accessToken, &claims)
 
 		if err != nil {
-			t.Error("could not parse token")
+			t.Fatal(err)
 		}
 
-		tokenIsValid := parsedToken.Valid
+		checkStandardClaims(t, &claims.Claims, AccessTokenType, accessExpire)
 
-		if !tokenIsValid {
-			t.Error("invalid token")
+		if claims.Subject != tt.userID {
+			t.Errorf("got %s, want %s", claims.Subject, tt.userID)
 		}
 
-		claims, ok := parsedToken.Claims.(jwt.MapClaims)
-
-		if !ok {
-			t.Error("invalid token claims")
+		if claims.Role != tt.role {
+			t.Errorf("got %s, want %s", claims.Role, tt.role)
 		}
 
-		_, ok = claims["expire"].(float64)
-
-		if !ok {
-			t.Fail()
-		}
-
-		token_expire := int64(claims["expire"].(float64))
-
-		if token_expire-tt.expire > int64(5*time.Second) {
-			t.Error("expire differense more then five second")
-		}
-
-		token_email, ok := claims["email"].(string)
-
-		if !ok {
-			t.Fail()
-		}
-
-		if token_email != tt.email {
-			t.Errorf("got %s, want %s", token_email, tt.email)
-		}
-
-		token_role, ok := claims["role"].(string)
-
-		if !ok {
-			t.Fail()
-		}
-
-		if token_role != tt.role {
-			t.Errorf("got %s, want %s", token_role, tt.role)
+		if claims.DeviceID != "DDD" || claims.Sid != "SSS" || claims.Version != 3 {
+			t.Errorf("got %s %s %d, want DDD SSS 3", claims.DeviceID, claims.Sid, claims.Version)
 		}
 	}
 }
 
-func TestGenerateRefreshToken(t *testing.T) {
-	expire := time.Now().Add(refreshExpire * time.Second).Unix()
-
-	refreshToken, err := GenerateRefreshToken()
+func TestGenerateInviteToken(t *testing.T) {
+	inviteToken, err := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
 
 	if err != nil {
 		t.Error(err.Error())
 	}
 
-	parsedToken, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	var claims InviteClaims
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-
-		return []byte(SecretKey), nil
-	})
+	err = ParseToken(inviteToken, &claims)
 
 	if err != nil {
-		t.Error("could not parse token")
-	}
-
-	tokenIsValid := parsedToken.Valid
-
-	if !tokenIsValid {
-		t.Error("invalid token")
-	}
-
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-
-	if !ok {
-		t.Error("invalid token claims")
+		t.Fatal(err)
 	}
 
-	_, ok = claims["expire"].(float64)
+	checkStandardClaims(t, &claims.Claims, InviteTokenType, inviteExpire)
 
-	if !ok {
-		t.Fail()
+	if claims.Email != "aopjdqonwd@gmail.com" || claims.Role != "clinician" {
+		t.Errorf("got %s %s", claims.Email, claims.Role)
 	}
-
-	token_expire := int64(claims["expire"].(float64))
-
-	if token_expire-expire > int64(5*time.Second) {
-		t.Error("expire differense more then five second")
-	}
-
 }
 
-func TestGeneratePasswordToken(t *testing.T) {
-	expire := time.Now().Add(passwordExpire * time.Second).Unix()
+func TestGenerateMFAToken(t *testing.T) {
+	device := models.Device{ID: "DDD", Name: "Pixel 8", Platform: "android"}
 
-	passwordToken, err := GeneratePasswordToken("iopawndoiwqdno@yandex.ru", "ioadjioaun1i023hni12hj3nbi")
+	mfaToken, err := GenerateMFAToken("0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11", device, 2)
 
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
 	}
 
-	parsedToken, err := jwt.Parse(passwordToken, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	var claims MFAClaims
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-
-		return []byte(SecretKey), nil
-	})
+	err = ParseToken(mfaToken, &claims)
 
 	if err != nil {
-		t.Error("could not parse token")
+		t.Fatal(err)
 	}
 
-	tokenIsValid := parsedToken.Valid
+	checkStandardClaims(t, &claims.Claims, MFATokenType, mfaExpire)
 
-	if !tokenIsValid {
-		t.Error("invalid token")
+	if claims.Subject != "0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11" || claims.Version != 2 {
+		t.Errorf("got %s %d", claims.Subject, claims.Version)
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-
-	if !ok {
-		t.Error("invalid token claims")
+	if claims.DeviceID != device.ID || claims.DeviceName != device.Name || claims.Platform != device.Platform {
+		t.Errorf("got device %s %s %s", claims.DeviceID, claims.DeviceName, claims.Platform)
 	}
 
-	_, ok = claims["expire"].(float64)
-
-	if !ok {
-		t.Fail()
+	if _, err := ParseAccessToken(mfaToken); err == nil {
+		t.Error("mfa token accepted as access token")
 	}
+}
 
-	token_expire := int64(claims["expire"].(float64))
-
-	if token_expire-expire > int64(5*time.Second) {
-		t.Error("expire differense more then five second")
-	}
+func TestParseTokenWrongPurpose(t *testing.T) {
+	accessToken, _ := GenerateAccessToken("aopjdqonwd@gmail.com", "patient", "DDD", "SSS", 0)
+	inviteToken, _ := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
 
-	email := claims["email"].(string)
+	var accessClaims AccessClaims
 
-	if email != "iopawndoiwqdno@yandex.ru" {
-		t.Error("other email")
+	if err := ParseToken(inviteToken, &accessClaims); err != ErrInvalidTokenType {
+		t.Errorf("got %v, want %v", err, ErrInvalidTokenType)
 	}
 
-	hashedPassword := claims["hashed_password"].(string)
+	var inviteClaims InviteClaims
 
-	if hashedPassword != "ioadjioaun1i023hni12hj3nbi" {
-		t.Error("other password")
+	if err := ParseToken(accessToken, &inviteClaims); err != ErrInvalidTokenType {
+		t.Errorf("got %v, want %v", err, ErrInvalidTokenType)
 	}
-}
-
-func TestGenerateVerifyEmailToken(t *testing.T) {
-	expire := time.Now().Add(verifyEmailExpire * time.Second).Unix()
 
-	verifyEmailToken, err := GenerateVerifyEmailToken("aopjdqonwd@gmail.com")
+	keyManager = NewHMACKeyManager("other")
+	defer func() { keyManager = NewHMACKeyManager("secret") }()
 
-	if err != nil {
-		t.Error(err.Error())
+	if err := ParseToken(inviteToken, &inviteClaims); err != ErrInvalidToken {
+		t.Errorf("got %v, want %v", err, ErrInvalidToken)
 	}
+}
 
-	parsedToken, err := jwt.Parse(verifyEmailToken, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+func TestParseTokenExpired(t *testing.T) {
+	inviteExpire = -60
+	defer func() { inviteExpire = 60 }()
 
-		if !ok {
-			return nil, errors.New("unexpected signing method")
-		}
+	inviteToken, _ := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
 
-		return []byte(SecretKey), nil
-	})
+	var claims InviteClaims
 
-	if err != nil {
-		t.Error("could not parse token")
-	}
-
-	tokenIsValid := parsedToken.Valid
-
-	if !tokenIsValid {
-		t.Error("invalid token")
+	if err := ParseToken(inviteToken, &claims); err != ErrInvalidToken {
+		t.Errorf("got %v, want %v", err, ErrInvalidToken)
 	}
+}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+func TestParseAccessToken(t *testing.T) {
+	accessToken, _ := GenerateAccessToken("0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11", "viewer", "DDD", "SSS", 3)
+	refreshToken, _ := GenerateRefreshToken()
+	inviteToken, _ := GenerateInviteToken("dmitrkozyrev2@gmail.com", "clinician")
+	oneTimeToken, _, _ := GenerateOneTimeToken()
 
-	if !ok {
-		t.Error("invalid token claims")
-	}
+	principal, err := ParseAccessToken(accessToken)
 
-	_, ok = claims["expire"].(float64)
-
-	if !ok {
-		t.Fail()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	token_expire := int64(claims["expire"].(float64))
-
-	if token_expire-expire > int64(5*time.Second) {
-		t.Error("expire differense more then five second")
+	if principal.ID != "0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11" || principal.Email != "" || principal.Role != "viewer" || principal.DeviceID != "DDD" || principal.SessionID != "SSS" || principal.TokenVersion != 3 {
+		t.Errorf("unexpected principal %+v", principal)
 	}
 
-	email := claims["email"].(string)
-
-	if email != "aopjdqonwd@gmail.com" {
-		t.Error("other email")
+	for _, token := range []string{"", "invalid", refreshToken, inviteToken, oneTimeToken} {
+		if _, err := ParseAccessToken(token); err == nil {
+			t.Errorf("token %q accepted as access token", token)
+		}
 	}
 }
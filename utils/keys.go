@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	activeKeyFile = "active"
+	keyFileSuffix = ".pem"
+	legacyKeyID   = "default"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// KeyManager holds every key tokens may be signed with. Only the active key
+// signs new tokens, the rest are kept to verify tokens issued before a
+// rotation.
+type KeyManager struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	hmac   *signingKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKeyManager signs with the shared secret only. It is used when no
+// keys directory is configured.
+func NewHMACKeyManager(secret string) *KeyManager {
+	key := &signingKey{kid: legacyKeyID, method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+
+	return &KeyManager{active: key, keys: map[string]*signingKey{legacyKeyID: key}, hmac: key}
+}
+
+// LoadKeyManager reads every <kid>.pem private key from dir. The kid of the
+// signing key is stored in the "active" file. If secret is not empty it is
+// kept as a verify-only key for tokens issued before the rotation.
+func LoadKeyManager(dir, secret string) (*KeyManager, error) {
+	km := &KeyManager{keys: map[string]*signingKey{}}
+
+	if secret != "" {
+		km.hmac = NewHMACKeyManager(secret).hmac
+		km.keys[legacyKeyID] = km.hmac
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+keyFileSuffix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parsePrivateKey(data)
+
+		if err != nil {
+			return nil, errors.New(filepath.Base(file) + ": " + err.Error())
+		}
+
+		key.kid = strings.TrimSuffix(filepath.Base(file), keyFileSuffix)
+		km.keys[key.kid] = key
+	}
+
+	activeKid, err := os.ReadFile(filepath.Join(dir, activeKeyFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	active, ok := km.keys[strings.TrimSpace(string(activeKid))]
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	km.active = active
+
+	return km, nil
+}
+
+func parsePrivateKey(data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	var private interface{}
+	var err error
+
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodRS256, private: key, public: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}, nil
+	}
+
+	return nil, errors.New("unsupported key type")
+}
+
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(km.active.method, claims)
+	token.Header["kid"] = km.active.kid
+
+	return token.SignedString(km.active.private)
+}
+
+// Keyfunc picks the verification key by the kid header. Tokens without a kid
+// were issued before key rotation and can only be checked with the secret.
+func (km *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := km.hmac
+
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = km.keys[kid]
+	}
+
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnexpectedSigning
+	}
+
+	return key.public, nil
+}
+
+// JWKS returns the public part of every asymmetric key, so other services
+// can verify access tokens without the shared secret.
+func (km *KeyManager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for kid, key := range km.keys {
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: AlgorithmRS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: AlgorithmEdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
+
+func JWKS() JWKSet {
+	return keyManager.JWKS()
+}
+
+// GenerateKey writes a new verify-only private key to dir and returns its kid.
+// The key signs nothing until it is promoted.
+func GenerateKey(dir, algorithm string) (string, error) {
+	var private crypto.PrivateKey
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", errors.New("unsupported algorithm " + algorithm)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+
+	if err != nil {
+		return "", err
+	}
+
+	kid, err := RandomString(8)
+
+	if err != nil {
+		return "", err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	err = os.MkdirAll(dir, 0700)
+
+	if err != nil {
+		return "", err
+	}
+
+	return kid, os.WriteFile(filepath.Join(dir, kid+keyFileSuffix), data, 0600)
+}
+
+// PromoteKey makes kid the signing key. The previous one stays verify-only
+// until its file is removed.
+func PromoteKey(dir, kid string) error {
+	data, err := os.ReadFile(filepath.Join(dir, kid+keyFileSuffix))
+
+	if err != nil {
+		return ErrUnknownKey
+	}
+
+	_, err = parsePrivateKey(data)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, activeKeyFile), []byte(kid+"\n"), 0600)
+}
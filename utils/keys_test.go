@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	legacyToken, _ := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
+
+	oldKid, err := GenerateKey(dir, AlgorithmRS256)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PromoteKey(dir, oldKid); err != nil {
+		t.Fatal(err)
+	}
+
+	keyManager, err = LoadKeyManager(dir, "secret")
+	defer func() { keyManager = NewHMACKeyManager("secret") }()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, _ := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
+
+	newKid, err := GenerateKey(dir, AlgorithmEdDSA)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PromoteKey(dir, newKid); err != nil {
+		t.Fatal(err)
+	}
+
+	keyManager, err = LoadKeyManager(dir, "secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, _ := GenerateInviteToken("aopjdqonwd@gmail.com", "clinician")
+
+	var claims InviteClaims
+
+	for _, token := range []string{legacyToken, oldToken, newToken} {
+		if err := ParseToken(token, &claims); err != nil {
+			t.Errorf("token rejected after rotation: %v", err)
+		}
+	}
+
+	jwks := keyManager.JWKS()
+
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(jwks.Keys))
+	}
+
+	for _, key := range jwks.Keys {
+		if key.Kid == oldKid && (key.Kty != "RSA" || key.N == "" || key.E == "") {
+			t.Errorf("unexpected RSA key %+v", key)
+		}
+
+		if key.Kid == newKid && (key.Kty != "OKP" || key.Crv != "Ed25519" || key.X == "") {
+			t.Errorf("unexpected Ed25519 key %+v", key)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, oldKid+keyFileSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	keyManager, err = LoadKeyManager(dir, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{legacyToken, oldToken} {
+		if err := ParseToken(token, &claims); err != ErrInvalidToken {
+			t.Errorf("got %v, want %v", err, ErrInvalidToken)
+		}
+	}
+
+	if err := PromoteKey(dir, oldKid); err != ErrUnknownKey {
+		t.Errorf("got %v, want %v", err, ErrUnknownKey)
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"time"
+)
+
+type lockoutParams struct {
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+var lockoutCfg = lockoutParams{
+	threshold: 5,
+	baseDelay: 30 * time.Second,
+	maxDelay:  time.Hour,
+}
+
+// LockoutDelay returns how long password logins are blocked after the given
+// number of failed attempts in a row, zero below the threshold.
+func LockoutDelay(failedAttempts int) time.Duration {
+	if failedAttempts < lockoutCfg.threshold {
+		return 0
+	}
+
+	delay := lockoutCfg.baseDelay
+
+	for i := lockoutCfg.threshold; i < failedAttempts && delay < lockoutCfg.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > lockoutCfg.maxDelay {
+		return lockoutCfg.maxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"testing"
+	"time"
+)
+
+func TestLockoutDelay(t *testing.T) {
+	defer func(cfg lockoutParams) { lockoutCfg = cfg }(lockoutCfg)
+
+	InitLockout(config.Lockout{Threshold: 3, BaseDelay: 10, MaxDelay: 60})
+
+	var testCases = []struct {
+		failedAttempts int
+		delay          time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, 10 * time.Second},
+		{4, 20 * time.Second},
+		{5, 40 * time.Second},
+		{6, 60 * time.Second},
+		{100, 60 * time.Second},
+	}
+
+	for _, tt := range testCases {
+		if delay := LockoutDelay(tt.failedAttempts); delay != tt.delay {
+			t.Errorf("%d attempts: got %v, want %v", tt.failedAttempts, delay, tt.delay)
+		}
+	}
+}
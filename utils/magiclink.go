@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const magicLinkCodeDigits = 6
+
+var magicLinkEnabled bool
+var magicLinkMaxAttempts = 5
+
+// MagicLinkEnabled reports whether passwordless login is turned on for the
+// deployment.
+func MagicLinkEnabled() bool {
+	return magicLinkEnabled
+}
+
+// MagicLinkMaxAttempts returns the number of wrong codes after which a magic
+// link can't be used anymore.
+func MagicLinkMaxAttempts() int {
+	return magicLinkMaxAttempts
+}
+
+// MagicLinkExpiresAt returns the expiry of a new magic link.
+func MagicLinkExpiresAt() time.Time {
+	return time.Now().Add(magicLinkExpire * time.Second)
+}
+
+// GenerateEmailCode returns a random numeric code to type in by hand. It is
+// short, so it must only be accepted a few times, see MagicLinkMaxAttempts.
+func GenerateEmailCode() (string, error) {
+	max := big.NewInt(1)
+	max.Exp(big.NewInt(10), big.NewInt(magicLinkCodeDigits), nil)
+
+	n, err := rand.Int(rand.Reader, max)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", magicLinkCodeDigits, n), nil
+}
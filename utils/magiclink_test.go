@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestGenerateEmailCode(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 20; i++ {
+		code, err := GenerateEmailCode()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != magicLinkCodeDigits {
+			t.Fatalf("got code %q, want %d digits", code, magicLinkCodeDigits)
+		}
+
+		for _, c := range code {
+			if c < '0' || c > '9' {
+				t.Fatalf("got code %q, want digits only", code)
+			}
+		}
+
+		seen[code] = true
+	}
+
+	if len(seen) < 2 {
+		t.Errorf("codes aren't random: %v", seen)
+	}
+}
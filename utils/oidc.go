@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// oidcRefetchInterval limits how often an unknown kid triggers a JWKS
+// download, so tokens with made up kids can't hammer the provider.
+const oidcRefetchInterval = time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+)
+
+var oidcProviders = map[string]*oidcProvider{}
+var oidcCacheTTL time.Duration = 3600
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// IDTokenClaims are the claims of an Apple or Google ID token used to find
+// or create the user.
+type IDTokenClaims struct {
+	jwt.StandardClaims
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+}
+
+// flexibleBool accepts true as well as "true", Apple sends booleans as
+// strings.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+
+	err := json.Unmarshal(data, &value)
+
+	if err != nil {
+		return err
+	}
+
+	*b = value == true || value == "true"
+
+	return nil
+}
+
+// oidcProvider caches the provider's signing keys for oidcCacheTTL seconds.
+type oidcProvider struct {
+	config.OIDCProvider
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// OIDCNonceExpiresAt returns the expiry of a new nonce.
+func OIDCNonceExpiresAt() time.Time {
+	return time.Now().Add(oidcNonceExpire * time.Second)
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS, the issuer,
+// the audience and the nonce the client passed to the provider. Whether the
+// nonce was issued by the server is up to the caller.
+func VerifyIDToken(providerName, token, nonce string) (IDTokenClaims, error) {
+	provider, ok := oidcProviders[providerName]
+
+	if !ok {
+		return IDTokenClaims{}, ErrUnknownProvider
+	}
+
+	var claims IDTokenClaims
+
+	parsedToken, err := jwt.ParseWithClaims(token, &claims, provider.keyfunc)
+
+	if err != nil || !parsedToken.Valid {
+		return IDTokenClaims{}, ErrInvalidIDToken
+	}
+
+	if claims.ExpiresAt == 0 || claims.Subject == "" || !contains(provider.Issuers, claims.Issuer) ||
+		!contains(provider.ClientIDs, claims.Audience) {
+		return IDTokenClaims{}, ErrInvalidIDToken
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return IDTokenClaims{}, ErrInvalidIDToken
+	}
+
+	return claims, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *oidcProvider) keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != AlgorithmRS256 {
+		return nil, ErrUnexpectedSigning
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	return p.key(kid)
+}
+
+// key returns the key with the kid, downloading the JWKS again when the cache
+// expired or the provider rotated its keys. Cached keys stay in use while the
+// provider is unreachable.
+func (p *oidcProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	age := time.Since(p.fetchedAt)
+
+	if p.keys == nil || age > oidcCacheTTL*time.Second || !ok && age > oidcRefetchInterval {
+		keys, err := p.fetchKeys()
+
+		if err == nil {
+			p.keys = keys
+			p.fetchedAt = time.Now()
+			key, ok = keys[kid]
+		} else if p.keys == nil {
+			return nil, err
+		}
+	}
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func (p *oidcProvider) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	var data []byte
+	var err error
+
+	if p.JWKSFile != "" {
+		data, err = os.ReadFile(p.JWKSFile)
+	} else {
+		data, err = fetchJWKS(p.JWKSURL)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var set JWKSet
+
+	err = json.Unmarshal(data, &set)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		key, err := rsaPublicKey(jwk)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	response, err := oidcHTTPClient.Get(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks %s: %s", url, response.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, 1<<20))
+}
+
+func rsaPublicKey(jwk JWK) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
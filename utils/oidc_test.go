@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testIssuer   = "https://appleid.apple.com"
+	testClientID = "app.diasync.ios"
+)
+
+func testProviderKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testJWKS(t *testing.T, kid string, key *rsa.PrivateKey) []byte {
+	data, err := json.Marshal(JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: AlgorithmRS256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func testIDToken(t *testing.T, kid string, key *rsa.PrivateKey, claims IDTokenClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key := testProviderKey(t)
+	file := filepath.Join(t.TempDir(), "apple.json")
+
+	if err := os.WriteFile(file, testJWKS(t, "k1", key), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	InitOIDC(config.OIDC{Providers: map[string]config.OIDCProvider{
+		"apple": {Issuers: []string{testIssuer}, ClientIDs: []string{testClientID}, JWKSFile: file},
+	}})
+	defer InitOIDC(config.OIDC{})
+
+	valid := func() IDTokenClaims {
+		return IDTokenClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    testIssuer,
+				Subject:   "001234.abcdef",
+				Audience:  testClientID,
+				IssuedAt:  time.Now().Unix(),
+				ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			},
+			Nonce:         "nonce",
+			Email:         "dmitrkozyrev2@gmail.com",
+			EmailVerified: true,
+		}
+	}
+
+	claims, err := VerifyIDToken("apple", testIDToken(t, "k1", key, valid()), "nonce")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "001234.abcdef" || claims.Email != "dmitrkozyrev2@gmail.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	var testCases = []struct {
+		name     string
+		provider string
+		kid      string
+		key      *rsa.PrivateKey
+		nonce    string
+		change   func(*IDTokenClaims)
+		err      error
+	}{
+		{name: "Unknown provider", provider: "google", kid: "k1", key: key, nonce: "nonce", err: ErrUnknownProvider},
+		{name: "Wrong issuer", provider: "apple", kid: "k1", key: key, nonce: "nonce",
+			change: func(c *IDTokenClaims) { c.Issuer = "https://accounts.google.com" }, err: ErrInvalidIDToken},
+		{name: "Wrong audience", provider: "apple", kid: "k1", key: key, nonce: "nonce",
+			change: func(c *IDTokenClaims) { c.Audience = "other.app" }, err: ErrInvalidIDToken},
+		{name: "Expired", provider: "apple", kid: "k1", key: key, nonce: "nonce",
+			change: func(c *IDTokenClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() }, err: ErrInvalidIDToken},
+		{name: "Wrong nonce", provider: "apple", kid: "k1", key: key, nonce: "other", err: ErrInvalidIDToken},
+		{name: "No nonce", provider: "apple", kid: "k1", key: key,
+			change: func(c *IDTokenClaims) { c.Nonce = "" }, err: ErrInvalidIDToken},
+		{name: "Unknown kid", provider: "apple", kid: "k2", key: key, nonce: "nonce", err: ErrInvalidIDToken},
+		{name: "Wrong key", provider: "apple", kid: "k1", key: testProviderKey(t), nonce: "nonce", err: ErrInvalidIDToken},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+
+			if tt.change != nil {
+				tt.change(&claims)
+			}
+
+			if _, err := VerifyIDToken(tt.provider, testIDToken(t, tt.kid, tt.key, claims), tt.nonce); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIDTokenKeysCached(t *testing.T) {
+	key := testProviderKey(t)
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(testJWKS(t, "k1", key))
+	}))
+	defer server.Close()
+
+	InitOIDC(config.OIDC{Providers: map[string]config.OIDCProvider{
+		"google": {Issuers: []string{testIssuer}, ClientIDs: []string{testClientID}, JWKSURL: server.URL},
+	}})
+	defer InitOIDC(config.OIDC{})
+
+	token := testIDToken(t, "k1", key, IDTokenClaims{StandardClaims: jwt.StandardClaims{
+		Issuer:    testIssuer,
+		Subject:   "1234567890",
+		Audience:  testClientID,
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}, Nonce: "nonce", EmailVerified: false})
+
+	for i := 0; i < 3; i++ {
+		if _, err := VerifyIDToken("google", token, "nonce"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an unknown kid right after a download doesn't trigger another one
+	VerifyIDToken("google", testIDToken(t, "k2", key, IDTokenClaims{}), "")
+
+	if requests != 1 {
+		t.Errorf("got %d jwks requests, want 1", requests)
+	}
+}
+
+func TestFlexibleBool(t *testing.T) {
+	for data, want := range map[string]bool{`true`: true, `"true"`: true, `false`: false, `"false"`: false} {
+		var value flexibleBool
+
+		if err := json.Unmarshal([]byte(data), &value); err != nil || bool(value) != want {
+			t.Errorf("%s: got %v %v, want %v", data, value, err, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"time"
+)
+
+const (
+	EmailVerifyTokenType     = "email_verify"
+	PasswordResetTokenType   = "password_reset"
+	EmailChangeTokenType     = "email_change"
+	EmailChangeUndoTokenType = "email_change_undo"
+	SecureAccountTokenType   = "secure_account"
+)
+
+// GenerateOneTimeToken returns a token for an emailed link and the hash to
+// store. The token is random rather than signed, so it is only valid while
+// its row exists and hasn't been consumed.
+func GenerateOneTimeToken() (string, string, error) {
+	token, err := RandomString(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, HashVerifier(token), nil
+}
+
+// OneTimeTokenExpiresAt returns the expiry of a new token for the purpose.
+func OneTimeTokenExpiresAt(purpose string) time.Time {
+	expire := verifyEmailExpire
+
+	switch purpose {
+	case PasswordResetTokenType:
+		expire = passwordExpire
+	case EmailChangeTokenType:
+		expire = emailChangeExpire
+	case EmailChangeUndoTokenType:
+		expire = emailUndoExpire
+	case SecureAccountTokenType:
+		expire = secureAccountExpire
+	}
+
+	return time.Now().Add(expire * time.Second)
+}
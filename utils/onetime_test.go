@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateOneTimeToken(t *testing.T) {
+	token, tokenHash, err := GenerateOneTimeToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, otherHash, err := GenerateOneTimeToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token == other || tokenHash == otherHash {
+		t.Error("one-time tokens must be unique")
+	}
+
+	if tokenHash == token || !CheckVerifier(token, tokenHash) {
+		t.Error("token doesn't match its hash")
+	}
+}
+
+func TestOneTimeTokenExpiresAt(t *testing.T) {
+	passwordExpire = 120
+	defer func() { passwordExpire = 60 }()
+
+	var testCases = []struct {
+		purpose string
+		expire  time.Duration
+	}{
+		{EmailVerifyTokenType, verifyEmailExpire},
+		{PasswordResetTokenType, passwordExpire},
+		{EmailChangeTokenType, emailChangeExpire},
+		{EmailChangeUndoTokenType, emailUndoExpire},
+		{SecureAccountTokenType, secureAccountExpire},
+	}
+
+	for _, tt := range testCases {
+		expected := time.Now().Add(tt.expire * time.Second)
+
+		if diff := OneTimeTokenExpiresAt(tt.purpose).Sub(expected); diff > 5*time.Second || diff < -5*time.Second {
+			t.Errorf("%s: expire differs by %s", tt.purpose, diff)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"time"
+)
+
+type outboxParams struct {
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	lease       time.Duration
+	retention   time.Duration
+}
+
+var outboxCfg = outboxParams{
+	interval:    5 * time.Second,
+	batchSize:   20,
+	maxAttempts: 8,
+	baseDelay:   30 * time.Second,
+	maxDelay:    6 * time.Hour,
+	lease:       5 * time.Minute,
+	retention:   30 * 24 * time.Hour,
+}
+
+// OutboxInterval is the pause of the outbox worker after a batch that didn't
+// fill up.
+func OutboxInterval() time.Duration {
+	return outboxCfg.interval
+}
+
+func OutboxBatchSize() int {
+	return outboxCfg.batchSize
+}
+
+// OutboxLease is how long a claimed email stays with the worker. An email not
+// reported by then, because the worker died, is claimed again.
+func OutboxLease() time.Duration {
+	return outboxCfg.lease
+}
+
+// OutboxRetryDelay returns the pause before the next attempt after the given
+// number of failed ones.
+func OutboxRetryDelay(attempts int) time.Duration {
+	delay := outboxCfg.baseDelay
+
+	for i := 1; i < attempts && delay < outboxCfg.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > outboxCfg.maxDelay {
+		return outboxCfg.maxDelay
+	}
+
+	return delay
+}
+
+// OutboxDead reports whether an email that failed the given number of
+// attempts is given up on.
+func OutboxDead(attempts int) bool {
+	return attempts >= outboxCfg.maxAttempts
+}
+
+// OutboxRetention is how long sent and dead-lettered emails are kept.
+func OutboxRetention() time.Duration {
+	return outboxCfg.retention
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"testing"
+	"time"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	defer func(cfg outboxParams) { outboxCfg = cfg }(outboxCfg)
+
+	InitOutbox(config.Outbox{MaxAttempts: 5, BaseDelay: 10, MaxDelay: 60, Retention: 3600})
+
+	if OutboxRetention() != time.Hour {
+		t.Errorf("got retention %v, want %v", OutboxRetention(), time.Hour)
+	}
+
+	var testCases = []struct {
+		attempts int
+		delay    time.Duration
+		dead     bool
+	}{
+		{1, 10 * time.Second, false},
+		{2, 20 * time.Second, false},
+		{3, 40 * time.Second, false},
+		{4, 60 * time.Second, false},
+		{5, 60 * time.Second, true},
+		{100, 60 * time.Second, true},
+	}
+
+	for _, tt := range testCases {
+		if delay := OutboxRetryDelay(tt.attempts); delay != tt.delay {
+			t.Errorf("%d attempts: got %v, want %v", tt.attempts, delay, tt.delay)
+		}
+
+		if dead := OutboxDead(tt.attempts); dead != tt.dead {
+			t.Errorf("%d attempts: got dead %v, want %v", tt.attempts, dead, tt.dead)
+		}
+	}
+}
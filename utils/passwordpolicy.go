@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ViolationTooShort      = "too_short"
+	ViolationTooLong       = "too_long"
+	ViolationNoLowercase   = "no_lowercase"
+	ViolationNoUppercase   = "no_uppercase"
+	ViolationNoDigit       = "no_digit"
+	ViolationNoSymbol      = "no_symbol"
+	ViolationContainsEmail = "contains_email"
+	ViolationBreached      = "breached"
+
+	// breachedPrefixLength is the length of the hash prefix naming a range
+	// file, as in the Pwned Passwords range API.
+	breachedPrefixLength = 5
+)
+
+type policyParams struct {
+	minLength     int
+	maxLength     int
+	requireLower  bool
+	requireUpper  bool
+	requireDigit  bool
+	requireSymbol bool
+	allowEmail    bool
+	breachedDir   string
+}
+
+var policyCfg = policyParams{
+	minLength: 8,
+	maxLength: 128,
+}
+
+// PasswordViolation is a broken rule of the password policy. Code is stable,
+// Message can be shown to the user as is.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule the password broke, so the app can
+// show them at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+
+	for _, violation := range e.Violations {
+		codes = append(codes, violation.Code)
+	}
+
+	return "password doesn't meet the policy: " + strings.Join(codes, ", ")
+}
+
+// CheckPasswordPolicy returns a *PasswordPolicyError if the password of the
+// user with the email is too weak or known from a breach.
+func CheckPasswordPolicy(password, email string) error {
+	var violations []PasswordViolation
+
+	violate := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+
+	if length < policyCfg.minLength {
+		violate(ViolationTooShort, fmt.Sprintf("password must be at least %d characters long", policyCfg.minLength))
+	}
+
+	if length > policyCfg.maxLength {
+		violate(ViolationTooLong, fmt.Sprintf("password must be at most %d characters long", policyCfg.maxLength))
+	} else if passwordCfg.algorithm == AlgorithmBcrypt && len(password) > bcryptMaxPassword {
+		violate(ViolationTooLong, fmt.Sprintf("password must be at most %d bytes long", bcryptMaxPassword))
+	}
+
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if policyCfg.requireLower && !lower {
+		violate(ViolationNoLowercase, "password must contain a lowercase letter")
+	}
+
+	if policyCfg.requireUpper && !upper {
+		violate(ViolationNoUppercase, "password must contain an uppercase letter")
+	}
+
+	if policyCfg.requireDigit && !digit {
+		violate(ViolationNoDigit, "password must contain a digit")
+	}
+
+	if policyCfg.requireSymbol && !symbol {
+		violate(ViolationNoSymbol, "password must contain a symbol")
+	}
+
+	if !policyCfg.allowEmail && containsEmail(password, email) {
+		violate(ViolationContainsEmail, "password must not contain the email")
+	}
+
+	breached, err := isBreached(password)
+
+	if err != nil {
+		return err
+	}
+
+	if breached {
+		violate(ViolationBreached, "password was found in a data breach, choose another one")
+	}
+
+	if violations != nil {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// containsEmail also catches the part before @, which is often the user name
+// elsewhere.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email == "" {
+		return false
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+
+	return strings.Contains(password, email) || len(local) >= 3 && strings.Contains(password, local)
+}
+
+// isBreached looks the SHA-1 hash of the password up in the breached
+// passwords corpus. Like the Pwned Passwords range API, the corpus directory
+// has a file per hash prefix of 5 hex digits, listing "SUFFIX:COUNT" lines,
+// so a lookup reads a single small file. A missing file is an empty range.
+func isBreached(password string) (bool, error) {
+	if policyCfg.breachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	file, err := os.Open(filepath.Join(policyCfg.breachedDir, prefix+".txt"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(policyCfg.breachedDir, prefix))
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordPolicy_Bcrypt(t *testing.T) {
+	defer func(cfg policyParams) { policyCfg = cfg }(policyCfg)
+	defer func(cfg passwordParams) { passwordCfg = cfg }(passwordCfg)
+
+	InitPasswordPolicy(config.PasswordPolicy{MinLength: 8, MaxLength: 128})
+
+	// 73 bytes in 37 characters
+	long := strings.Repeat("пароль", 6) + "1"
+
+	if err := CheckPasswordPolicy(long, "dmitrkozyrev2@gmail.com"); err != nil {
+		t.Errorf("got %v, argon2id takes passwords up to max_length", err)
+	}
+
+	InitPassword(config.PasswordHash{Algorithm: AlgorithmBcrypt})
+
+	var policyErr *PasswordPolicyError
+
+	err := CheckPasswordPolicy(long, "dmitrkozyrev2@gmail.com")
+
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].Code != ViolationTooLong {
+		t.Errorf("got %v, bcrypt can't hash more than 72 bytes", err)
+	}
+
+	if err := CheckPasswordPolicy(long[:len(long)-1], "dmitrkozyrev2@gmail.com"); err != nil {
+		t.Errorf("got %v for 72 bytes", err)
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	defer func(cfg policyParams) { policyCfg = cfg }(policyCfg)
+
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("correct horse battery"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"),
+		[]byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n"+hash[5:]+":3861493\r\n"), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	InitPasswordPolicy(config.PasswordPolicy{MinLength: 10, MaxLength: 20, RequireDigit: true, BreachedDir: dir})
+
+	var testCases = []struct {
+		name       string
+		password   string
+		violations []string
+	}{
+		{"OK", "grey owl 1 night", nil},
+		{"Too short", "owl 1", []string{ViolationTooShort}},
+		{"Too long", "grey owl 1 night over the hills", []string{ViolationTooLong}},
+		{"No digit", "grey owl at night", []string{ViolationNoDigit}},
+		{"Contains email", "dmitrkozyrev2@gmail.com", []string{ViolationTooLong, ViolationContainsEmail}},
+		{"Contains email name", "1 DmitrKozyrev2", []string{ViolationContainsEmail}},
+		{"Breached", "correct horse battery", []string{ViolationTooLong, ViolationNoDigit, ViolationBreached}},
+		{"Unicode length", "пароль 1 ночь", nil},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordPolicy(tt.password, "dmitrkozyrev2@gmail.com")
+
+			var codes []string
+			var policyErr *PasswordPolicyError
+
+			if errors.As(err, &policyErr) {
+				for _, violation := range policyErr.Violations {
+					codes = append(codes, violation.Code)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(codes, tt.violations) {
+				t.Errorf("got %v, want %v", codes, tt.violations)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RandomString returns n random bytes encoded as hex.
+func RandomString(n int) (string, error) {
+	random, err := randomBytes(n)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	random := make([]byte, n)
+
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	return random, nil
+}
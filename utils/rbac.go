@@ -0,0 +1,62 @@
+package utils
+
+const (
+	RolePatient   = "patient"
+	RoleCaregiver = "caregiver"
+	RoleClinician = "clinician"
+	RoleAdmin     = "admin"
+)
+
+const (
+	PermReadingsRead     = "readings:read"
+	PermReadingsWrite    = "readings:write"
+	PermProfileRead      = "profile:read"
+	PermProfileWrite     = "profile:write"
+	PermSharingManage    = "sharing:manage"
+	PermPatientsRead     = "patients:read"
+	PermUsersManage      = "users:manage"
+	PermInvitationCreate = "invitations:create"
+	PermEmailsManage     = "emails:manage"
+)
+
+var permissions = map[string][]string{
+	RolePatient: {
+		PermReadingsRead, PermReadingsWrite, PermProfileRead, PermProfileWrite, PermSharingManage,
+	},
+	RoleCaregiver: {
+		PermReadingsRead, PermProfileRead,
+	},
+	RoleClinician: {
+		PermReadingsRead, PermProfileRead, PermPatientsRead,
+	},
+	RoleAdmin: {
+		PermReadingsRead, PermReadingsWrite, PermProfileRead, PermProfileWrite, PermSharingManage,
+		PermPatientsRead, PermUsersManage, PermInvitationCreate, PermEmailsManage,
+	},
+}
+
+// selfServiceRoles can be chosen by the user at signup, every other role is
+// granted by an admin or through an invitation.
+var selfServiceRoles = map[string]bool{
+	RolePatient:   true,
+	RoleCaregiver: true,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := permissions[role]
+	return ok
+}
+
+func IsSelfServiceRole(role string) bool {
+	return selfServiceRoles[role]
+}
+
+func HasPermission(role, permission string) bool {
+	for _, p := range permissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// GenerateRefreshToken returns an opaque "<selector>.<verifier>" token. The
+// selector finds the session row, only a hash of the verifier is stored, so
+// a leaked Sessions table can't be used to refresh tokens.
+func GenerateRefreshToken() (string, error) {
+	selector, err := RandomString(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	verifier, err := RandomString(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	return selector + "." + verifier, nil
+}
+
+func SplitRefreshToken(token string) (string, string, error) {
+	selector, verifier, found := strings.Cut(token, ".")
+
+	if !found || selector == "" || verifier == "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	return selector, verifier, nil
+}
+
+func HashVerifier(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(hash[:])
+}
+
+func CheckVerifier(verifier, verifierHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashVerifier(verifier)), []byte(verifierHash)) == 1
+}
+
+// RefreshExpiresAt is stored with the session, so refresh token expiry is
+// enforced by the server.
+func RefreshExpiresAt() time.Time {
+	return time.Now().Add(refreshExpire * time.Second)
+}
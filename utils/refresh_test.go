@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestGenerateRefreshToken(t *testing.T) {
+	first, err := GenerateRefreshToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := GenerateRefreshToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Error("refresh tokens must be unique")
+	}
+
+	selector, verifier, err := SplitRefreshToken(first)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(selector) != 32 || len(verifier) != 64 {
+		t.Errorf("unexpected token %s", first)
+	}
+
+	verifierHash := HashVerifier(verifier)
+
+	if verifierHash == verifier || !CheckVerifier(verifier, verifierHash) {
+		t.Error("verifier doesn't match its hash")
+	}
+
+	_, otherVerifier, _ := SplitRefreshToken(second)
+
+	if CheckVerifier(otherVerifier, verifierHash) {
+		t.Error("other verifier matches the hash")
+	}
+}
+
+func TestSplitRefreshToken(t *testing.T) {
+	var testCases = []struct {
+		token string
+		err   error
+	}{
+		{"selector.verifier", nil},
+		{"selector", ErrInvalidRefreshToken},
+		{".verifier", ErrInvalidRefreshToken},
+		{"selector.", ErrInvalidRefreshToken},
+		{"", ErrInvalidRefreshToken},
+	}
+
+	for _, tt := range testCases {
+		_, _, err := SplitRefreshToken(tt.token)
+
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.token, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpModulo = 1000000
+	// totpSkew is the number of time steps accepted on either side of the
+	// current one, to tolerate clock drift on the phone.
+	totpSkew = 1
+
+	recoveryCodesCount = 10
+
+	// sealedTOTPPrefix marks a TOTP secret encrypted by SealTOTPSecret.
+	sealedTOTPPrefix = "v1:"
+)
+
+var (
+	ErrBadTOTPKey       = errors.New("totp key must be 32 base64 encoded bytes")
+	ErrSealedTOTPSecret = errors.New("can't decrypt totp secret")
+)
+
+var mfaRequiredRoles = map[string]bool{}
+var mfaMaxAttempts = 5
+
+// totpKey is kept apart from the token signing keys, which are rotated.
+var totpKey []byte
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFARequired reports whether users with the role must sign in with a second
+// factor.
+func MFARequired(role string) bool {
+	return mfaRequiredRoles[role]
+}
+
+// GenerateTOTPSecret returns a new RFC 6238 secret, base32 encoded as
+// authenticator apps expect it.
+func GenerateTOTPSecret() (string, error) {
+	secret, err := randomBytes(20)
+
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// MFAMaxAttempts returns the number of codes one MFA challenge token may be
+// used with.
+func MFAMaxAttempts() int {
+	return mfaMaxAttempts
+}
+
+// LoadTOTPKey reads the base64 AES-256 key from the file.
+func LoadTOTPKey(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+
+	if err != nil || len(key) != 32 {
+		return nil, ErrBadTOTPKey
+	}
+
+	return key, nil
+}
+
+func totpCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(totpKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// SealTOTPSecret encrypts the secret of the user for storage, so a leaked
+// database doesn't reveal the second factor. The user id is authenticated
+// with it, a secret copied to another user doesn't decrypt.
+func SealTOTPSecret(userID, secret string) (string, error) {
+	aead, err := totpCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+
+	return sealedTOTPPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenTOTPSecret decrypts a secret sealed for the user. A secret stored
+// before encryption is returned as is, with legacy set.
+func OpenTOTPSecret(userID, stored string) (string, bool, error) {
+	encoded, sealed := strings.CutPrefix(stored, sealedTOTPPrefix)
+
+	if !sealed {
+		return stored, true, nil
+	}
+
+	aead, err := totpCipher()
+
+	if err != nil {
+		return "", false, err
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", false, ErrSealedTOTPSecret
+	}
+
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(userID))
+
+	if err != nil {
+		return "", false, ErrSealedTOTPSecret
+	}
+
+	return string(secret), false, nil
+}
+
+// TOTPURI returns the otpauth:// URI shown as a QR code during enrollment.
+func TOTPURI(email, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + email)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPStep returns the RFC 6238 time step for t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode returns the code for the time step, see RFC 4226 section 5.3.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo), nil
+}
+
+// CheckTOTP looks for the code around the time step of t and returns the
+// step it matched. Callers must reject steps that were already used.
+func CheckTOTP(secret, code string, t time.Time) (int64, bool) {
+	current := TOTPStep(t)
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns the codes shown to the user once and their
+// hashes to store. Every code can be used a single time instead of a TOTP
+// code.
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := RandomString(5)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode ignores case and surrounding spaces, so a code typed from
+// a printout still matches.
+func HashRecoveryCode(code string) string {
+	return HashVerifier(strings.ToLower(strings.TrimSpace(code)))
+}
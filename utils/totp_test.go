@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 secret "12345678901234567890", last six digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	var testCases = []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range testCases {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.time, 0)))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != tt.code {
+			t.Errorf("%d: got %s, want %s", tt.time, code, tt.code)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	var testCases = []struct {
+		code  string
+		valid bool
+	}{
+		{"081804", true},
+		{"050471", true},
+		{"005924", false},
+		{"", false},
+		{"08180", false},
+	}
+
+	for _, tt := range testCases {
+		step, ok := CheckTOTP(rfcSecret, tt.code, now)
+
+		if ok != tt.valid {
+			t.Errorf("%q: got %t, want %t", tt.code, ok, tt.valid)
+		}
+
+		if ok && (step < TOTPStep(now)-totpSkew || step > TOTPStep(now)+totpSkew) {
+			t.Errorf("%q: step %d outside the window", tt.code, step)
+		}
+	}
+
+	if _, ok := CheckTOTP("not base32!", "081804", now); ok {
+		t.Error("code accepted for invalid secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(secret, TOTPStep(time.Now()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := CheckTOTP(secret, code, time.Now()); !ok {
+		t.Error("code of generated secret rejected")
+	}
+
+	uri, err := url.Parse(TOTPURI("dmitrkozyrev2@gmail.com", secret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || !strings.HasSuffix(uri.Path, ":dmitrkozyrev2@gmail.com") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+
+	if uri.Query().Get("secret") != secret || uri.Query().Get("issuer") != issuer {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != recoveryCodesCount || len(hashes) != recoveryCodesCount {
+		t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+	}
+
+	seen := map[string]bool{}
+
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate code %s", code)
+		}
+
+		seen[code] = true
+
+		if HashRecoveryCode(" "+strings.ToUpper(code)+" ") != hashes[i] {
+			t.Errorf("code %s doesn't match its hash", code)
+		}
+	}
+}
+
+// testMFAConfig returns an mfa config with a fresh secret key file.
+func testMFAConfig(t *testing.T) config.MFA {
+	key, err := randomBytes(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "mfa.key")
+
+	if err := os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return config.MFA{SecretKeyFile: file}
+}
+
+func TestMFARequired(t *testing.T) {
+	cfg := testMFAConfig(t)
+	defer InitMFA(cfg)
+
+	cfg.RequiredRoles = []string{RoleClinician, RoleAdmin}
+	InitMFA(cfg)
+
+	var testCases = []struct {
+		role     string
+		required bool
+	}{
+		{RolePatient, false},
+		{RoleCaregiver, false},
+		{RoleClinician, true},
+		{RoleAdmin, true},
+	}
+
+	for _, tt := range testCases {
+		if MFARequired(tt.role) != tt.required {
+			t.Errorf("%s: got %t, want %t", tt.role, !tt.required, tt.required)
+		}
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	InitMFA(testMFAConfig(t))
+
+	sealed, err := SealTOTPSecret("u1", rfcSecret)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, _ := SealTOTPSecret("u1", rfcSecret)
+
+	if strings.Contains(sealed, rfcSecret) || sealed == again {
+		t.Errorf("got %s and %s, want different ciphertexts", sealed, again)
+	}
+
+	secret, legacy, err := OpenTOTPSecret("u1", sealed)
+
+	if err != nil || legacy || secret != rfcSecret {
+		t.Errorf("got %s, %t, %v", secret, legacy, err)
+	}
+
+	if _, _, err := OpenTOTPSecret("u2", sealed); !errors.Is(err, ErrSealedTOTPSecret) {
+		t.Errorf("got %v for another user, want %v", err, ErrSealedTOTPSecret)
+	}
+
+	secret, legacy, err = OpenTOTPSecret("u1", rfcSecret)
+
+	if err != nil || !legacy || secret != rfcSecret {
+		t.Errorf("got %s, %t, %v for a plaintext secret", secret, legacy, err)
+	}
+}
+
+func TestInitMFA_SecretKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.key")
+	bad := filepath.Join(dir, "bad.key")
+	os.WriteFile(good, []byte("MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n"), 0600)
+	os.WriteFile(bad, []byte("c2hvcnQ="), 0600)
+
+	InitMFA(testMFAConfig(t))
+	sealed, _ := SealTOTPSecret("u1", rfcSecret)
+
+	InitMFA(config.MFA{SecretKeyFile: good})
+
+	if _, _, err := OpenTOTPSecret("u1", sealed); !errors.Is(err, ErrSealedTOTPSecret) {
+		t.Errorf("got %v, a secret sealed with another key must not decrypt", err)
+	}
+
+	if _, err := LoadTOTPKey(bad); !errors.Is(err, ErrBadTOTPKey) {
+		t.Errorf("got %v, want %v", err, ErrBadTOTPKey)
+	}
+
+	for _, cfg := range []config.MFA{{SecretKeyFile: bad}, {}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: a missing or bad key file must panic", cfg.SecretKeyFile)
+				}
+			}()
+
+			InitMFA(cfg)
+		}()
+	}
+}
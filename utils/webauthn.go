@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"DiaSync/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+var (
+	ErrPasskeysDisabled = errors.New("passkeys are disabled")
+	ErrInvalidPasskey   = errors.New("invalid passkey")
+	ErrPasskeyCloned    = errors.New("passkey sign counter went back")
+)
+
+var relyingParty *webauthn.WebAuthn
+
+// PasskeyUser is the user as seen by the WebAuthn ceremonies. The email is
+// only shown by the authenticator, credentials belong to the id.
+type PasskeyUser struct {
+	Handle      []byte
+	ID          string
+	Email       string
+	Credentials []models.WebAuthnCredential
+}
+
+func (u PasskeyUser) WebAuthnID() []byte          { return u.Handle }
+func (u PasskeyUser) WebAuthnName() string        { return u.Email }
+func (u PasskeyUser) WebAuthnDisplayName() string { return u.Email }
+func (u PasskeyUser) WebAuthnIcon() string        { return "" }
+
+func (u PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+
+	for _, credential := range u.Credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credential.ID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: credential.SignCount,
+			},
+		})
+	}
+
+	return credentials
+}
+
+// NewPasskeyUserHandle returns the user handle for the first passkey of a
+// user. It is random, so the authenticator never learns the email.
+func NewPasskeyUserHandle() ([]byte, error) {
+	return randomBytes(32)
+}
+
+// WebAuthnExpiresAt returns the expiry of a new ceremony challenge.
+func WebAuthnExpiresAt() time.Time {
+	return time.Now().Add(webauthnExpire * time.Second)
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create
+// and the session data to keep until the registration is finished. Passkeys
+// must be discoverable and verify the user, so a passkey login is on par
+// with a password and a second factor.
+func BeginPasskeyRegistration(user PasskeyUser) (json.RawMessage, []byte, error) {
+	if relyingParty == nil {
+		return nil, nil, ErrPasskeysDisabled
+	}
+
+	exclusions := []protocol.CredentialDescriptor{}
+
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := relyingParty.BeginRegistration(user,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return marshalCeremony(creation, session)
+}
+
+// FinishPasskeyRegistration verifies the attestation response and returns the
+// new credential. A user registering the first passkey has no handle yet,
+// the one chosen when the ceremony started is used.
+func FinishPasskeyRegistration(user PasskeyUser, sessionData, response []byte) (models.WebAuthnCredential, error) {
+	if relyingParty == nil {
+		return models.WebAuthnCredential{}, ErrPasskeysDisabled
+	}
+
+	var session webauthn.SessionData
+
+	err := json.Unmarshal(sessionData, &session)
+
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	if user.Handle == nil {
+		user.Handle = session.UserID
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	credential, err := relyingParty.CreateCredential(user, session, parsed)
+
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	return newWebAuthnCredential(user, credential), nil
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get. If
+// user is nil any discoverable passkey of the relying party is accepted.
+func BeginPasskeyLogin(user *PasskeyUser) (json.RawMessage, []byte, error) {
+	if relyingParty == nil {
+		return nil, nil, ErrPasskeysDisabled
+	}
+
+	option := webauthn.WithUserVerification(protocol.VerificationRequired)
+
+	if user == nil {
+		assertion, session, err := relyingParty.BeginDiscoverableLogin(option)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return marshalCeremony(assertion, session)
+	}
+
+	assertion, session, err := relyingParty.BeginLogin(*user, option)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return marshalCeremony(assertion, session)
+}
+
+// FinishPasskeyLogin verifies the assertion response. findUser loads the
+// owner of the credential, userHandle is empty if the authenticator didn't
+// return it. The returned credential carries the new sign counter, a counter
+// that didn't grow is reported as ErrPasskeyCloned.
+func FinishPasskeyLogin(sessionData, response []byte,
+	findUser func(credentialID, userHandle []byte) (PasskeyUser, error)) (models.WebAuthnCredential, error) {
+	if relyingParty == nil {
+		return models.WebAuthnCredential{}, ErrPasskeysDisabled
+	}
+
+	var session webauthn.SessionData
+
+	err := json.Unmarshal(sessionData, &session)
+
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	userHandle := parsed.Response.UserHandle
+
+	if session.UserID != nil {
+		userHandle = session.UserID
+	}
+
+	user, err := findUser(parsed.RawID, userHandle)
+
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	var credential *webauthn.Credential
+
+	if session.UserID == nil {
+		credential, err = relyingParty.ValidateDiscoverableLogin(func(_, _ []byte) (webauthn.User, error) {
+			return user, nil
+		}, session, parsed)
+	} else {
+		credential, err = relyingParty.ValidateLogin(user, session, parsed)
+	}
+
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	result := newWebAuthnCredential(user, credential)
+
+	if credential.Authenticator.CloneWarning {
+		return result, ErrPasskeyCloned
+	}
+
+	return result, nil
+}
+
+func newWebAuthnCredential(user PasskeyUser, credential *webauthn.Credential) models.WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return models.WebAuthnCredential{
+		ID:              credential.ID,
+		UserHandle:      user.Handle,
+		UserID:          user.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+}
+
+func marshalCeremony(options any, session *webauthn.SessionData) (json.RawMessage, []byte, error) {
+	encodedOptions, err := json.Marshal(options)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionData, err := json.Marshal(session)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodedOptions, sessionData, nil
+}
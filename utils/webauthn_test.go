@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"DiaSync/config"
+	"DiaSync/models"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	testRPID   = "diasync.test"
+	testOrigin = "https://diasync.test"
+)
+
+// softAuthenticator is a platform authenticator holding a single ES256
+// passkey. It performs user verification on every ceremony.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID, err := randomBytes(16)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(t *testing.T, data string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.counter)
+}
+
+func clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{"type": ceremonyType, "challenge": challenge, "origin": testOrigin})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// create answers navigator.credentials.create with "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options json.RawMessage) []byte {
+	var creation struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+
+	if err := json.Unmarshal(options, &creation); err != nil {
+		t.Fatal(err)
+	}
+
+	a.userHandle = decode(t, creation.PublicKey.User.ID)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user present, user verified, attested credential data included
+	authData := a.authenticatorData(0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.respond(t, map[string]string{
+		"clientDataJSON":    encode(clientData(t, "webauthn.create", creation.PublicKey.Challenge)),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get, incrementing the sign counter first
+// unless replay is set.
+func (a *softAuthenticator) get(t *testing.T, options json.RawMessage, replay bool) []byte {
+	var assertion struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+
+	if err := json.Unmarshal(options, &assertion); err != nil {
+		t.Fatal(err)
+	}
+
+	if !replay {
+		a.counter++
+	}
+
+	authData := a.authenticatorData(0x05)
+	data := clientData(t, "webauthn.get", assertion.PublicKey.Challenge)
+	clientDataHash := sha256.Sum256(data)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.respond(t, map[string]string{
+		"clientDataJSON":    encode(data),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) respond(t *testing.T, response map[string]string) []byte {
+	body, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	InitWebAuthn(config.WebAuthn{RPID: testRPID, RPDisplayName: "DiaSync", RPOrigins: []string{testOrigin}})
+	defer InitWebAuthn(config.WebAuthn{})
+
+	handle, err := NewPasskeyUserHandle()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := PasskeyUser{Handle: handle, ID: "0b0e6a3c-5f4e-4d0a-9a37-2f1c8f0b6a11", Email: "dmitrkozyrev2@gmail.com"}
+	authenticator := newSoftAuthenticator(t)
+
+	options, session, err := BeginPasskeyRegistration(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := FinishPasskeyRegistration(user, session, authenticator.create(t, options))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(credential.ID, authenticator.credentialID) || !bytes.Equal(credential.UserHandle, handle) {
+		t.Errorf("unexpected credential %+v", credential)
+	}
+
+	if !bytes.Equal(authenticator.userHandle, handle) || credential.UserID != user.ID {
+		t.Errorf("got user handle %x for %s", authenticator.userHandle, credential.UserID)
+	}
+
+	user.Credentials = []models.WebAuthnCredential{credential}
+
+	findUser := func(credentialID, userHandle []byte) (PasskeyUser, error) {
+		if !bytes.Equal(credentialID, credential.ID) || !bytes.Equal(userHandle, handle) {
+			return PasskeyUser{}, errors.New("unknown passkey")
+		}
+
+		return user, nil
+	}
+
+	// discoverable login, the user is found by the returned user handle
+	options, session, err = BeginPasskeyLogin(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := FinishPasskeyLogin(session, authenticator.get(t, options, false), findUser)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if used.SignCount != 1 {
+		t.Errorf("got sign count %d, want 1", used.SignCount)
+	}
+
+	user.Credentials[0].SignCount = used.SignCount
+
+	// login for a known user
+	options, session, err = BeginPasskeyLogin(&user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used, err = FinishPasskeyLogin(session, authenticator.get(t, options, false), findUser)
+
+	if err != nil || used.SignCount != 2 {
+		t.Fatalf("got %d %v, want 2", used.SignCount, err)
+	}
+
+	user.Credentials[0].SignCount = used.SignCount
+
+	// a cloned authenticator doesn't know the counter moved on
+	options, session, _ = BeginPasskeyLogin(nil)
+
+	if _, err := FinishPasskeyLogin(session, authenticator.get(t, options, true), findUser); err != ErrPasskeyCloned {
+		t.Errorf("got %v, want %v", err, ErrPasskeyCloned)
+	}
+
+	// a response is bound to the challenge it was made for
+	options, _, _ = BeginPasskeyLogin(nil)
+	_, otherSession, _ := BeginPasskeyLogin(nil)
+
+	if _, err := FinishPasskeyLogin(otherSession, authenticator.get(t, options, false), findUser); err != ErrInvalidPasskey {
+		t.Errorf("got %v, want %v", err, ErrInvalidPasskey)
+	}
+
+	// another key can't sign for the registered passkey
+	options, session, _ = BeginPasskeyLogin(nil)
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID, impostor.userHandle, impostor.counter = authenticator.credentialID, handle, 10
+
+	if _, err := FinishPasskeyLogin(session, impostor.get(t, options, false), findUser); err != ErrInvalidPasskey {
+		t.Errorf("got %v, want %v", err, ErrInvalidPasskey)
+	}
+}
+
+func TestPasskeysDisabled(t *testing.T) {
+	if _, _, err := BeginPasskeyLogin(nil); err != ErrPasskeysDisabled {
+		t.Errorf("got %v, want %v", err, ErrPasskeysDisabled)
+	}
+
+	if _, _, err := BeginPasskeyRegistration(PasskeyUser{}); err != ErrPasskeysDisabled {
+		t.Errorf("got %v, want %v", err, ErrPasskeysDisabled)
+	}
+}